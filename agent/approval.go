@@ -0,0 +1,232 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ToolPolicy controls whether the agent may call a tool on its own.
+type ToolPolicy string
+
+const (
+	// PolicyAuto runs the tool without asking.
+	PolicyAuto ToolPolicy = "auto"
+	// PolicyConfirm pauses the run until the user approves or rejects the call.
+	PolicyConfirm ToolPolicy = "confirm"
+	// PolicyDeny never runs the tool, the model is told it is not allowed.
+	PolicyDeny ToolPolicy = "deny"
+)
+
+// DefaultToolPolicies asks before cloning repositories and running Go programs. open only reads the
+// workspace of the conversation.
+func DefaultToolPolicies() map[string]ToolPolicy {
+	return map[string]ToolPolicy{
+		"gitclone": PolicyConfirm,
+		ToolGoRun:  PolicyConfirm,
+	}
+}
+
+// ParseToolPolicies parses a name=policy list separated by commas, e.g. "open=deny,gitclone=auto".
+func ParseToolPolicies(raw string) (map[string]ToolPolicy, error) {
+	policies := map[string]ToolPolicy{}
+	for _, kv := range strings.Split(raw, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(kv, "=")
+		policy := ToolPolicy(strings.TrimSpace(value))
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid tool policy %q, want name=policy", kv)
+		}
+		switch policy {
+		case PolicyAuto, PolicyConfirm, PolicyDeny:
+		default:
+			return nil, fmt.Errorf("unknown policy %q for tool %s", policy, name)
+		}
+		policies[strings.TrimSpace(name)] = policy
+	}
+	return policies, nil
+}
+
+// toolPolicies returns the defaults overridden by TOOL_POLICIES.
+func toolPolicies() map[string]ToolPolicy {
+	policies := DefaultToolPolicies()
+	raw := os.Getenv("TOOL_POLICIES")
+	if raw == "" {
+		return policies
+	}
+	overrides, err := ParseToolPolicies(raw)
+	if err != nil {
+		log.Printf("[ToolPolicy] Ignoring TOOL_POLICIES: %v", err)
+		return policies
+	}
+	for name, p := range overrides {
+		policies[name] = p
+	}
+	return policies
+}
+
+// ApprovalRequest is the interrupt extra of a tool call waiting for the user.
+type ApprovalRequest struct {
+	ToolCallID string `json:"tool_call_id"`
+	Tool       string `json:"tool"`
+	Arguments  string `json:"arguments"`
+}
+
+// ToolDecision is the answer of the user to an ApprovalRequest.
+type ToolDecision struct {
+	Approved bool
+	Reason   string
+}
+
+func init() {
+	// 中断时检查点会序列化图中的数据
+	schema.RegisterName[*UserMessage]("myeino_user_message")
+	schema.RegisterName[*ApprovalRequest]("myeino_approval_request")
+}
+
+type decisionsKey struct{}
+
+type denyUnapprovedKey struct{}
+
+// WithToolDecisions passes the answers of the user, keyed by tool call ID, to a resumed run.
+func WithToolDecisions(ctx context.Context, decisions map[string]ToolDecision) context.Context {
+	return context.WithValue(ctx, decisionsKey{}, decisions)
+}
+
+// WithoutApprovals makes tools needing confirmation refuse to run instead of pausing the run,
+// for callers that cannot ask the user.
+func WithoutApprovals(ctx context.Context) context.Context {
+	return context.WithValue(ctx, denyUnapprovedKey{}, true)
+}
+
+// ApprovalRequests returns the tool calls waiting for the user in the interrupt error of a run,
+// and whether err is such an interrupt.
+func ApprovalRequests(err error) ([]*ApprovalRequest, bool) {
+	info, ok := compose.ExtractInterruptInfo(err)
+	if !ok {
+		return nil, false
+	}
+	var requests []*ApprovalRequest
+	collectApprovalRequests(info, &requests)
+	return requests, len(requests) > 0
+}
+
+func collectApprovalRequests(info *compose.InterruptInfo, requests *[]*ApprovalRequest) {
+	for _, extra := range info.RerunNodesExtra {
+		switch e := extra.(type) {
+		case *ApprovalRequest:
+			*requests = append(*requests, e)
+		case *compose.ToolsInterruptAndRerunExtra:
+			for _, id := range e.RerunTools {
+				if req, ok := e.RerunExtraMap[id].(*ApprovalRequest); ok {
+					*requests = append(*requests, req)
+				}
+			}
+		}
+	}
+	for _, sub := range info.SubGraphs {
+		collectApprovalRequests(sub, requests)
+	}
+}
+
+// policyTool applies a ToolPolicy to the calls of inner.
+type policyTool struct {
+	inner  tool.InvokableTool
+	name   string
+	policy ToolPolicy
+}
+
+// WithToolPolicies wraps the tools whose policy is not auto. Tools without a policy run on their own.
+func WithToolPolicies(ctx context.Context, tools []tool.BaseTool, policies map[string]ToolPolicy) ([]tool.BaseTool, error) {
+	wrapped := make([]tool.BaseTool, 0, len(tools))
+	for _, t := range tools {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+		policy, ok := policies[info.Name]
+		if !ok || policy == PolicyAuto {
+			wrapped = append(wrapped, t)
+			continue
+		}
+		inv, ok := t.(tool.InvokableTool)
+		if !ok {
+			return nil, fmt.Errorf("tool %s: policy %s needs an invokable tool", info.Name, policy)
+		}
+		wrapped = append(wrapped, &policyTool{inner: inv, name: info.Name, policy: policy})
+	}
+	return wrapped, nil
+}
+
+func (t *policyTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return t.inner.Info(ctx)
+}
+
+func (t *policyTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	if t.policy == PolicyDeny {
+		return fmt.Sprintf("The tool %s is disabled by the server policy.", t.name), nil
+	}
+
+	callID := compose.GetToolCallID(ctx)
+	decisions, _ := ctx.Value(decisionsKey{}).(map[string]ToolDecision)
+	if d, ok := decisions[callID]; ok {
+		if !d.Approved {
+			msg := fmt.Sprintf("The user rejected the call of %s.", t.name)
+			if d.Reason != "" {
+				msg += " Reason: " + d.Reason
+			}
+			return msg, nil
+		}
+		return t.inner.InvokableRun(ctx, argumentsInJSON, opts...)
+	}
+	if deny, _ := ctx.Value(denyUnapprovedKey{}).(bool); deny {
+		return fmt.Sprintf("The tool %s needs the approval of the user, which is not available here.", t.name), nil
+	}
+
+	// 暂停运行，恢复时本工具会被重新调用
+	return "", compose.NewInterruptAndRerunErr(&ApprovalRequest{
+		ToolCallID: callID,
+		Tool:       t.name,
+		Arguments:  argumentsInJSON,
+	})
+}
+
+// MemoryCheckPointStore keeps the checkpoints of paused runs in memory.
+type MemoryCheckPointStore struct {
+	mu          sync.Mutex
+	checkPoints map[string][]byte
+}
+
+func NewMemoryCheckPointStore() *MemoryCheckPointStore {
+	return &MemoryCheckPointStore{checkPoints: map[string][]byte{}}
+}
+
+func (s *MemoryCheckPointStore) Get(ctx context.Context, checkPointID string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.checkPoints[checkPointID]
+	return cp, ok, nil
+}
+
+func (s *MemoryCheckPointStore) Set(ctx context.Context, checkPointID string, checkPoint []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkPoints[checkPointID] = checkPoint
+	return nil
+}
+
+// Delete drops the checkpoint of a run that has ended.
+func (s *MemoryCheckPointStore) Delete(checkPointID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.checkPoints, checkPointID)
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/flow/agent/react"
+	"github.com/cloudwego/eino/schema"
+)
+
+// toolCallingModel calls the tool named toolName once, then answers with the tool result.
+type toolCallingModel struct {
+	toolName string
+}
+
+func (m *toolCallingModel) reply(in []*schema.Message) *schema.Message {
+	last := in[len(in)-1]
+	if last.Role == schema.Tool {
+		return schema.AssistantMessage("result: "+last.Content, nil)
+	}
+	return schema.AssistantMessage("", []schema.ToolCall{{
+		ID:       "call-1",
+		Function: schema.FunctionCall{Name: m.toolName, Arguments: `{"uri":"https://example.com"}`},
+	}})
+}
+
+func (m *toolCallingModel) Generate(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	return m.reply(in), nil
+}
+
+func (m *toolCallingModel) Stream(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return schema.StreamReaderFromArray([]*schema.Message{m.reply(in)}), nil
+}
+
+func (m *toolCallingModel) BindTools(tools []*schema.ToolInfo) error { return nil }
+
+type openReq struct {
+	URI string `json:"uri"`
+}
+
+// buildApprovalGraph mirrors BuildEinoAgent: the ReAct agent runs inside a lambda of the outer graph.
+func buildApprovalGraph(t *testing.T, policy ToolPolicy, calls *atomic.Int32, store compose.CheckPointStore) compose.Runnable[*UserMessage, *schema.Message] {
+	t.Helper()
+	ctx := context.Background()
+	open, err := utils.InferTool("open", "open a uri", func(ctx context.Context, req *openReq) (string, error) {
+		calls.Add(1)
+		return "opened " + req.URI, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools, err := WithToolPolicies(ctx, []tool.BaseTool{open}, map[string]ToolPolicy{"open": policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &react.AgentConfig{Model: &toolCallingModel{toolName: "open"}}
+	config.ToolsConfig.Tools = tools
+	ra, err := react.NewAgent(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lba, err := compose.AnyLambda(ra.Generate, ra.Stream, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := compose.NewGraph[*UserMessage, *schema.Message]()
+	_ = g.AddLambdaNode("ToMessages", compose.InvokableLambda(func(ctx context.Context, in *UserMessage) ([]*schema.Message, error) {
+		return []*schema.Message{schema.UserMessage(in.Query)}, nil
+	}))
+	_ = g.AddLambdaNode("ReactAgent", lba)
+	_ = g.AddEdge(compose.START, "ToMessages")
+	_ = g.AddEdge("ToMessages", "ReactAgent")
+	_ = g.AddEdge("ReactAgent", compose.END)
+	r, err := g.Compile(ctx, compose.WithCheckPointStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func readAll(t *testing.T, sr *schema.StreamReader[*schema.Message]) string {
+	t.Helper()
+	defer sr.Close()
+	var b strings.Builder
+	for {
+		chunk, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			return b.String()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.WriteString(chunk.Content)
+	}
+}
+
+func TestToolApprovalInterruptAndResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		decision  ToolDecision
+		wantCalls int32
+		want      string
+	}{
+		{"approved", ToolDecision{Approved: true}, 1, "result: opened https://example.com"},
+		{"rejected", ToolDecision{Reason: "not now"}, 0, "result: The user rejected the call of open. Reason: not now"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			store := NewMemoryCheckPointStore()
+			r := buildApprovalGraph(t, PolicyConfirm, &calls, store)
+			ctx := context.Background()
+			in := &UserMessage{ID: "c1", Query: "open example.com"}
+
+			_, err := r.Stream(ctx, in, compose.WithCheckPointID("run-1"))
+			requests, ok := ApprovalRequests(err)
+			if !ok {
+				t.Fatalf("run not paused for approval: %v", err)
+			}
+			if len(requests) != 1 || requests[0].Tool != "open" || requests[0].ToolCallID != "call-1" {
+				t.Fatalf("unexpected requests: %+v", requests)
+			}
+			if calls.Load() != 0 {
+				t.Fatal("tool ran before approval")
+			}
+
+			ctx = WithToolDecisions(ctx, map[string]ToolDecision{"call-1": tt.decision})
+			sr, err := r.Stream(ctx, in, compose.WithCheckPointID("run-1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readAll(t, sr); got != tt.want {
+				t.Errorf("answer = %q, want %q", got, tt.want)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("tool called %d times, want %d", calls.Load(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestToolPolicyDenyAndWithoutApprovals(t *testing.T) {
+	var calls atomic.Int32
+	r := buildApprovalGraph(t, PolicyDeny, &calls, NewMemoryCheckPointStore())
+	sr, err := r.Stream(context.Background(), &UserMessage{Query: "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, sr); !strings.Contains(got, "disabled by the server policy") {
+		t.Errorf("answer = %q", got)
+	}
+
+	r = buildApprovalGraph(t, PolicyConfirm, &calls, NewMemoryCheckPointStore())
+	sr, err = r.Stream(WithoutApprovals(context.Background()), &UserMessage{Query: "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, sr); !strings.Contains(got, "needs the approval of the user") {
+		t.Errorf("answer = %q", got)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("tool called %d times", calls.Load())
+	}
+}
+
+func TestParseToolPolicies(t *testing.T) {
+	got, err := ParseToolPolicies(" open=deny, gitclone=auto ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["open"] != PolicyDeny || got["gitclone"] != PolicyAuto {
+		t.Errorf("unexpected policies: %v", got)
+	}
+	for _, raw := range []string{"open", "open=maybe", "=deny"} {
+		if _, err := ParseToolPolicies(raw); err == nil {
+			t.Errorf("%q accepted", raw)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package agent
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/google/uuid"
+	rds "github.com/redis/go-redis/v9"
+)
+
+const (
+	// KnowledgeVersionKey is bumped by the indexing pipeline every time documents are stored.
+	// Cached answers remember the version they were produced under and are ignored once it changes.
+	KnowledgeVersionKey = "eino:kb:version"
+
+	CachePrefix    = "eino:cache:"
+	CacheIndexName = "vector_index"
+
+	cacheQueryField    = "query"
+	cacheAnswerField   = "answer"
+	cacheVersionField  = "kb_version"
+	cacheVectorField   = "query_vector"
+	cacheDistanceField = "distance"
+	cacheCreatedField  = "created_at"
+)
+
+// SemanticCacheConfig configures the semantic response cache in front of the EinoAgent graph.
+type SemanticCacheConfig struct {
+	Client    *rds.Client
+	Embedding embedding.Embedder
+	// Threshold is the minimum cosine similarity (1 - distance) for a cached answer to be reused.
+	Threshold float64
+	// TTL bounds how long an answer stays cached even if the knowledge base never changes.
+	TTL time.Duration
+}
+
+// CacheEntry is a previously generated answer returned by a cache hit.
+type CacheEntry struct {
+	Query     string
+	Answer    string
+	Score     float64
+	CreatedAt string
+}
+
+// SemanticCache looks up answers to semantically similar questions in a dedicated Redis vector index.
+type SemanticCache struct {
+	config *SemanticCacheConfig
+	index  cacheIndex
+	now    func() time.Time
+}
+
+// cachedAnswer is an answer as kept in the cache index.
+type cachedAnswer struct {
+	ID       string
+	Tenant   string
+	Query    string
+	Answer   string
+	Version  string
+	Vector   []float64
+	Created  time.Time
+	Distance float64
+}
+
+// cacheIndex keeps the cached answers, the default is a RediSearch vector index.
+type cacheIndex interface {
+	// Nearest returns the answer of tenant closest to vector with its cosine distance, nil when there is none.
+	Nearest(ctx context.Context, tenant string, vector []float64) (*cachedAnswer, error)
+	Put(ctx context.Context, answer *cachedAnswer, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+	// KnowledgeVersion returns the version of the knowledge base, see KnowledgeVersionKey.
+	KnowledgeVersion(ctx context.Context) (string, error)
+	Close() error
+}
+
+func defaultSemanticCacheConfig(ctx context.Context) (*SemanticCacheConfig, error) {
+	// TODO Modify component configuration here.
+	eb, err := newEmbedding(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config := &SemanticCacheConfig{
+		Client: rds.NewClient(&rds.Options{
+			Addr:     "localhost:6479",
+			Protocol: 2,
+		}),
+		Embedding: eb,
+		Threshold: 0.95,
+		TTL:       7 * 24 * time.Hour,
+	}
+	return config, nil
+}
+
+// NewSemanticCache creates a semantic cache, falling back to the default config when config is nil.
+func NewSemanticCache(ctx context.Context, config *SemanticCacheConfig) (*SemanticCache, error) {
+	var err error
+	if config == nil {
+		config, err = defaultSemanticCacheConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Client == nil {
+		return nil, fmt.Errorf("redis client cannot be empty")
+	}
+	return newSemanticCache(config, &redisCacheIndex{client: config.Client, name: CachePrefix + CacheIndexName})
+}
+
+func newSemanticCache(config *SemanticCacheConfig, index cacheIndex) (*SemanticCache, error) {
+	if config.Embedding == nil {
+		return nil, fmt.Errorf("embedding cannot be empty")
+	}
+	if config.Threshold <= 0 || config.Threshold > 1 {
+		return nil, fmt.Errorf("threshold must be in (0, 1], got %v", config.Threshold)
+	}
+	return &SemanticCache{config: config, index: index, now: time.Now}, nil
+}
+
+// Lookup returns the cached answer closest to query, or nil when no entry is similar enough, it has
+// expired or the knowledge base has been re-indexed since the answer was produced.
+func (c *SemanticCache) Lookup(ctx context.Context, query string) (*CacheEntry, error) {
+	vector, err := c.embed(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Answers are only shared within a tenant, they may be built from tenant-specific documents.
+	doc, err := c.index.Nearest(ctx, TenantOf(ctx), vector)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	score := 1 - doc.Distance
+	if score < c.config.Threshold {
+		return nil, nil
+	}
+
+	version, err := c.index.KnowledgeVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Redis expires the entries after TTL, the check also covers entries stored with a longer TTL.
+	expired := c.config.TTL > 0 && c.now().Sub(doc.Created) >= c.config.TTL
+	if doc.Version != version || expired {
+		// Stale answer, produced before the knowledge base was re-indexed.
+		if err := c.index.Delete(ctx, doc.ID); err != nil {
+			log.Printf("[SemanticCache] Failed to delete stale entry %s: %v", doc.ID, err)
+		}
+		return nil, nil
+	}
+
+	return &CacheEntry{
+		Query:     doc.Query,
+		Answer:    doc.Answer,
+		Score:     score,
+		CreatedAt: doc.Created.Format(time.RFC3339),
+	}, nil
+}
+
+// Store caches answer for query under the current knowledge base version. Answers produced with tools
+// must not be stored, they may depend on the user or the conversation, see ToolCallRecorder.
+func (c *SemanticCache) Store(ctx context.Context, query, answer string) error {
+	if strings.TrimSpace(query) == "" || strings.TrimSpace(answer) == "" {
+		return nil
+	}
+
+	vector, err := c.embed(ctx, query)
+	if err != nil {
+		return err
+	}
+	version, err := c.index.KnowledgeVersion(ctx)
+	if err != nil {
+		return err
+	}
+	return c.index.Put(ctx, &cachedAnswer{
+		ID:      CachePrefix + uuid.New().String(),
+		Tenant:  TenantOf(ctx),
+		Query:   query,
+		Answer:  answer,
+		Version: version,
+		Vector:  vector,
+		Created: c.now(),
+	}, c.config.TTL)
+}
+
+func (c *SemanticCache) embed(ctx context.Context, query string) ([]float64, error) {
+	vectors, err := c.config.Embedding.EmbedStrings(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return nil, fmt.Errorf("invalid embedding result for query, got %d vectors", len(vectors))
+	}
+	return vectors[0], nil
+}
+
+// Close closes the cache's Redis client.
+func (c *SemanticCache) Close() error {
+	return c.index.Close()
+}
+
+// ToolCallRecorder records the tools called in a run. Answers produced with tools are not cached:
+// tools may read data of the user or the conversation, e.g. tasks, workspace files or HTTP services.
+// Retrievers are not tools, answers built from the knowledge base alone stay cacheable.
+type ToolCallRecorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+// Handler returns the callback handler to run the agent with.
+func (r *ToolCallRecorder) Handler() callbacks.Handler {
+	return callbacks.NewHandlerBuilder().
+		OnStartFn(func(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
+			if info != nil && info.Component == components.ComponentOfTool {
+				r.mu.Lock()
+				r.names = append(r.names, info.Name)
+				r.mu.Unlock()
+			}
+			return ctx
+		}).
+		Build()
+}
+
+// Names returns the names of the tools called so far.
+func (r *ToolCallRecorder) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.names)
+}
+
+// redisCacheIndex keeps the cached answers in hashes indexed by a RediSearch vector index.
+type redisCacheIndex struct {
+	client *rds.Client
+	name   string
+
+	tenantOnce sync.Once
+}
+
+func (x *redisCacheIndex) Nearest(ctx context.Context, tenant string, vector []float64) (*cachedAnswer, error) {
+	searchQuery := fmt.Sprintf("(@%s:{%s})=>[KNN 1 @%s $vec AS %s]",
+		TenantField, EscapeTag(tenant), cacheVectorField, cacheDistanceField)
+	result, err := x.client.FTSearchWithArgs(ctx, x.name, searchQuery, &rds.FTSearchOptions{
+		Return: []rds.FTSearchReturn{
+			{FieldName: cacheQueryField},
+			{FieldName: cacheAnswerField},
+			{FieldName: cacheVersionField},
+			{FieldName: cacheCreatedField},
+			{FieldName: cacheDistanceField},
+		},
+		SortBy:         []rds.FTSearchSortBy{{FieldName: cacheDistanceField, Asc: true}},
+		Limit:          1,
+		DialectVersion: 2,
+		Params:         map[string]any{"vec": vectorToBytes(vector)},
+	}).Result()
+	if err != nil {
+		// The index is created lazily on the first Store, so an empty cache is not an error.
+		if strings.Contains(err.Error(), "no such index") || strings.Contains(err.Error(), "Unknown index name") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(result.Docs) == 0 {
+		return nil, nil
+	}
+
+	doc := result.Docs[0]
+	distance, err := strconv.ParseFloat(doc.Fields[cacheDistanceField], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid distance %q: %w", doc.Fields[cacheDistanceField], err)
+	}
+	created, _ := time.Parse(time.RFC3339, doc.Fields[cacheCreatedField])
+	return &cachedAnswer{
+		ID:       doc.ID,
+		Tenant:   tenant,
+		Query:    doc.Fields[cacheQueryField],
+		Answer:   doc.Fields[cacheAnswerField],
+		Version:  doc.Fields[cacheVersionField],
+		Created:  created,
+		Distance: distance,
+	}, nil
+}
+
+func (x *redisCacheIndex) Put(ctx context.Context, answer *cachedAnswer, ttl time.Duration) error {
+	if err := x.ensureIndex(ctx, len(answer.Vector)); err != nil {
+		return err
+	}
+	pipe := x.client.TxPipeline()
+	pipe.HSet(ctx, answer.ID, map[string]any{
+		cacheQueryField:   answer.Query,
+		cacheAnswerField:  answer.Answer,
+		cacheVersionField: answer.Version,
+		cacheVectorField:  vectorToBytes(answer.Vector),
+		cacheCreatedField: answer.Created.Format(time.RFC3339),
+		TenantField:       answer.Tenant,
+	})
+	if ttl > 0 {
+		pipe.Expire(ctx, answer.ID, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (x *redisCacheIndex) Delete(ctx context.Context, id string) error {
+	return x.client.Del(ctx, id).Err()
+}
+
+func (x *redisCacheIndex) KnowledgeVersion(ctx context.Context) (string, error) {
+	version, err := x.client.Get(ctx, KnowledgeVersionKey).Result()
+	if errors.Is(err, rds.Nil) {
+		return "0", nil
+	}
+	return version, err
+}
+
+func (x *redisCacheIndex) ensureIndex(ctx context.Context, dimension int) error {
+	// 检查是否存在索引
+	if _, err := x.client.Do(ctx, "FT.INFO", x.name).Result(); err == nil {
+		// Indexes created before tenant isolation lack the tenant field.
+		x.tenantOnce.Do(func() {
+			if err := EnsureTenantField(ctx, x.client, x.name); err != nil {
+				log.Printf("[SemanticCache] %v", err)
+			}
+		})
+		return nil
+	} else if !strings.Contains(err.Error(), "Unknown index name") && !strings.Contains(err.Error(), "no such index") {
+		return fmt.Errorf("failed to check if cache index exists: %w", err)
+	}
+
+	createIndexArgs := []any{
+		"FT.CREATE", x.name,
+		"ON", "HASH",
+		"PREFIX", "1", CachePrefix,
+		"SCHEMA",
+		cacheQueryField, "TEXT",
+		cacheVersionField, "TAG",
+		TenantField, "TAG",
+		cacheVectorField, "VECTOR", "FLAT",
+		"6",
+		"TYPE", "FLOAT32",
+		"DIM", dimension,
+		"DISTANCE_METRIC", "COSINE",
+	}
+	if err := x.client.Do(ctx, createIndexArgs...).Err(); err != nil {
+		// Another instance may have created it concurrently.
+		if strings.Contains(err.Error(), "Index already exists") {
+			return nil
+		}
+		return fmt.Errorf("failed to create cache index: %w", err)
+	}
+	return nil
+}
+
+func (x *redisCacheIndex) Close() error {
+	return x.client.Close()
+}
+
+// BumpKnowledgeVersion invalidates every cached answer. The indexing pipeline calls it after storing documents.
+func BumpKnowledgeVersion(ctx context.Context, client *rds.Client) (int64, error) {
+	return client.Incr(ctx, KnowledgeVersionKey).Result()
+}
+
+func vectorToBytes(vector []float64) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(v)))
+	}
+	return buf
+}
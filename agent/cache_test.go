@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/embedding"
+	"myeino/util"
+)
+
+// fakeEmbedder returns the vector listed for each query.
+type fakeEmbedder map[string][]float64
+
+func (e fakeEmbedder) EmbedStrings(ctx context.Context, texts []string, opts ...embedding.Option) ([][]float64, error) {
+	vectors := make([][]float64, 0, len(texts))
+	for _, text := range texts {
+		v, ok := e[text]
+		if !ok {
+			return nil, fmt.Errorf("no vector for %q", text)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+// memoryCacheIndex searches the answers by cosine distance like the Redis index.
+type memoryCacheIndex struct {
+	answers map[string]*cachedAnswer
+	version string
+}
+
+func (x *memoryCacheIndex) Nearest(ctx context.Context, tenant string, vector []float64) (*cachedAnswer, error) {
+	var nearest *cachedAnswer
+	for _, a := range x.answers {
+		if a.Tenant != tenant {
+			continue
+		}
+		found := *a
+		found.Distance = 1 - cosine(a.Vector, vector)
+		if nearest == nil || found.Distance < nearest.Distance {
+			nearest = &found
+		}
+	}
+	return nearest, nil
+}
+
+func (x *memoryCacheIndex) Put(ctx context.Context, answer *cachedAnswer, ttl time.Duration) error {
+	x.answers[answer.ID] = answer
+	return nil
+}
+
+func (x *memoryCacheIndex) Delete(ctx context.Context, id string) error {
+	delete(x.answers, id)
+	return nil
+}
+
+func (x *memoryCacheIndex) KnowledgeVersion(ctx context.Context) (string, error) {
+	return x.version, nil
+}
+
+func (x *memoryCacheIndex) Close() error {
+	return nil
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func TestSemanticCache(t *testing.T) {
+	embedder := fakeEmbedder{
+		"How do I build a graph?": {1, 0, 0},
+		"how to build a graph":    {0.99, 0.14, 0}, // 相似度约 0.99
+		"graph building tips":     {0.9, 0.43, 0},  // 相似度约 0.90，低于阈值
+		"what is a retriever":     {0, 1, 0},
+	}
+	stored := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		tenant string
+		query  string
+		after  time.Duration
+		bump   bool
+		hit    bool
+	}{
+		{name: "same question", tenant: "acme", query: "How do I build a graph?", hit: true},
+		{name: "similar question", tenant: "acme", query: "how to build a graph", after: time.Hour, hit: true},
+		{name: "below threshold", tenant: "acme", query: "graph building tips"},
+		{name: "other question", tenant: "acme", query: "what is a retriever"},
+		{name: "other tenant", tenant: "globex", query: "How do I build a graph?"},
+		{name: "no tenant", query: "How do I build a graph?"},
+		{name: "expired", tenant: "acme", query: "How do I build a graph?", after: 24 * time.Hour},
+		{name: "knowledge re-indexed", tenant: "acme", query: "How do I build a graph?", bump: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := &memoryCacheIndex{answers: map[string]*cachedAnswer{}, version: "1"}
+			cache, err := newSemanticCache(&SemanticCacheConfig{Embedding: embedder, Threshold: 0.95, TTL: 24 * time.Hour}, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := stored
+			cache.now = func() time.Time { return now }
+			acme := util.WithTenantID(context.Background(), "acme")
+			if err := cache.Store(acme, "How do I build a graph?", "Use compose.NewGraph."); err != nil {
+				t.Fatal(err)
+			}
+
+			now = stored.Add(tt.after)
+			if tt.bump {
+				index.version = "2"
+			}
+			ctx := context.Background()
+			if tt.tenant != "" {
+				ctx = util.WithTenantID(ctx, tt.tenant)
+			}
+			entry, err := cache.Lookup(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := entry != nil; got != tt.hit {
+				t.Fatalf("hit = %v, want %v (%+v)", got, tt.hit, entry)
+			}
+			if tt.hit && (entry.Answer != "Use compose.NewGraph." || entry.Score < 0.95) {
+				t.Errorf("entry = %+v", entry)
+			}
+			// 过期或知识库更新后的答案被删除
+			if (tt.after >= 24*time.Hour || tt.bump) && len(index.answers) != 0 {
+				t.Errorf("stale answer kept: %d answers", len(index.answers))
+			}
+		})
+	}
+}
+
+func TestToolCallRecorder(t *testing.T) {
+	recorder := &ToolCallRecorder{}
+	handler := recorder.Handler()
+	ctx := context.Background()
+	handler.OnStart(ctx, &callbacks.RunInfo{Name: "retriever", Component: components.ComponentOfRetriever}, nil)
+	if names := recorder.Names(); len(names) != 0 {
+		t.Errorf("retriever recorded as a tool call: %v", names)
+	}
+	handler.OnStart(ctx, &callbacks.RunInfo{Name: "list_tasks", Component: components.ComponentOfTool}, nil)
+	if names := recorder.Names(); len(names) != 1 || names[0] != "list_tasks" {
+		t.Errorf("names = %v", names)
+	}
+}
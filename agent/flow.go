@@ -2,8 +2,10 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"fmt"
+	"myeino/util"
+	"os"
+	"strconv"
 
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/flow/agent"
@@ -11,24 +13,26 @@ import (
 	"github.com/cloudwego/eino/schema"
 )
 
+var reactAgentLogger = util.With(util.F("component", "ReactAgent"))
+
 // loggedGenerate wraps the react agent Generate function with logging
 func loggedGenerate(originalGenerate func(context.Context, []*schema.Message, ...agent.AgentOption) (*schema.Message, error)) func(context.Context, []*schema.Message, ...agent.AgentOption) (*schema.Message, error) {
 	return func(ctx context.Context, input []*schema.Message, opts ...agent.AgentOption) (*schema.Message, error) {
+		logger := reactAgentLogger.WithContext(ctx).With(util.F("call", "generate"))
+
 		// Log input
-		inputJSON, _ := json.MarshalIndent(input, "", "  ")
-		log.Printf("[ReactAgent] Input: %d messages: %s", len(input), string(inputJSON))
+		logMessages(logger, "Input", input)
 
 		// Call original function
 		output, err := originalGenerate(ctx, input, opts...)
 
 		// Log output
 		if err != nil {
-			log.Printf("[ReactAgent] Error: %v", err)
+			logger.With(util.F("error", util.Redact(err.Error()))).Error("Generate failed")
 			return nil, err
 		}
 
-		outputJSON, _ := json.MarshalIndent(output, "", "  ")
-		log.Printf("[ReactAgent] Output: %s", string(outputJSON))
+		logMessages(logger, "Output", []*schema.Message{output})
 
 		return output, nil
 	}
@@ -37,48 +41,41 @@ func loggedGenerate(originalGenerate func(context.Context, []*schema.Message, ..
 // loggedStream wraps the react agent Stream function with logging
 func loggedStream(originalStream func(context.Context, []*schema.Message, ...agent.AgentOption) (*schema.StreamReader[*schema.Message], error)) func(context.Context, []*schema.Message, ...agent.AgentOption) (*schema.StreamReader[*schema.Message], error) {
 	return func(ctx context.Context, input []*schema.Message, opts ...agent.AgentOption) (*schema.StreamReader[*schema.Message], error) {
-		// Log input messages
-		inputJSON, _ := json.MarshalIndent(input, "", "  ")
-		log.Printf("[ReactAgent-Stream] === DETAILED MODEL CALL PARAMETERS ===")
-		log.Printf("[ReactAgent-Stream] Input Messages Count: %d", len(input))
-		log.Printf("[ReactAgent-Stream] Input Messages: %s", string(inputJSON))
-
-		// Log agent options
-		log.Printf("[ReactAgent-Stream] Agent Options Count: %d", len(opts))
-		for i, opt := range opts {
-			log.Printf("[ReactAgent-Stream] Agent Option[%d]: %T", i, opt)
-		}
+		logger := reactAgentLogger.WithContext(ctx).With(util.F("call", "stream"))
 
-		// Log context details
+		// Log input messages and call parameters
+		fields := []util.Field{util.F("option_count", len(opts))}
 		if deadline, ok := ctx.Deadline(); ok {
-			log.Printf("[ReactAgent-Stream] Context Deadline: %v", deadline)
-		} else {
-			log.Printf("[ReactAgent-Stream] Context Deadline: No deadline set")
+			fields = append(fields, util.F("deadline", deadline))
 		}
-
-		// Log context values (be careful not to log sensitive data)
-		log.Printf("[ReactAgent-Stream] Context Type: %T", ctx)
+		logMessages(logger, "Input", input, fields...)
 
 		// Call original function
-		log.Printf("[ReactAgent-Stream] === CALLING ORIGINAL STREAM FUNCTION ===")
 		reader, err := originalStream(ctx, input, opts...)
 
 		// Log output
 		if err != nil {
-			log.Printf("[ReactAgent-Stream] === STREAM CALL FAILED ===")
-			log.Printf("[ReactAgent-Stream] Error Type: %T", err)
-			log.Printf("[ReactAgent-Stream] Error: %v", err)
+			logger.With(util.F("error", util.Redact(err.Error())), util.F("error_type", fmt.Sprintf("%T", err))).Error("Stream failed")
 			return nil, err
 		}
 
-		log.Printf("[ReactAgent-Stream] === STREAM CALL SUCCESSFUL ===")
-		log.Printf("[ReactAgent-Stream] Stream Reader Type: %T", reader)
-		log.Printf("[ReactAgent-Stream] Output: Stream reader created successfully")
+		logger.Info("Stream started")
 
 		return reader, nil
 	}
 }
 
+// defaultMaxStep allows about 10 rounds of tool calls, each round takes a model step and a tools step.
+const defaultMaxStep = 22
+
+// agentMaxStep reads AGENT_MAX_STEP, the step budget of the react agent; a run exceeding it fails.
+func agentMaxStep() int {
+	if n, err := strconv.Atoi(os.Getenv("AGENT_MAX_STEP")); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxStep
+}
+
 // newLambda2 component initialization function of node 'ReactAgent' in graph 'EinoAgent'
 func newLambda2(ctx context.Context) (lba *compose.Lambda, err error) {
 	// TODO Modify component configuration here.
@@ -92,7 +89,19 @@ func newLambda2(ctx context.Context) (lba *compose.Lambda, err error) {
 	if err != nil {
 		return nil, err
 	}
-	config.ToolsConfig.Tools = tools
+	execConfig := toolExecConfig()
+	if execConfig.Output.SummarizeAbove > 0 {
+		// 摘要用单独的模型实例，不绑定工具
+		summaryModel, err := newChatModel(ctx)
+		if err != nil {
+			return nil, err
+		}
+		execConfig.Output.Summarizer = NewModelSummarizer(summaryModel)
+	}
+	if config.ToolsConfig, err = toolsNodeConfig(ctx, tools, execConfig); err != nil {
+		return nil, err
+	}
+	config.MaxStep = agentMaxStep()
 	ins, err := react.NewAgent(ctx, config)
 	if err != nil {
 		return nil, err
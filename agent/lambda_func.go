@@ -2,30 +2,35 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"myeino/util"
 	"time"
 )
 
+var lambdaLogger = util.Default()
+
 // newLambda component initialization function of node 'InputToQuery' in graph 'EinoAgent'
 func newInputToQuery(ctx context.Context, input *UserMessage, opts ...any) (output string, err error) {
+	logger := lambdaLogger.WithContext(ctx).With(util.F("component", "InputToQuery"))
+
 	// Log input
-	inputJSON, _ := json.MarshalIndent(input, "", "  ")
-	log.Printf("[InputToQuery] Input: %s", string(inputJSON))
+	logger.With(util.F("id", input.ID), util.F("query_len", len(input.Query)), util.F("history", len(input.History))).Info("Input")
 
 	output = input.Query
 
 	// Log output
-	log.Printf("[InputToQuery] Output: %s", output)
+	if logger.Enabled(util.DEBUG) {
+		logger.With(util.F("query", util.Redact(output))).Debug("Output content")
+	}
 
 	return output, nil
 }
 
 // newLambda1 component initialization function of node 'InputToHistory' in graph 'EinoAgent'
 func newInputToHistory(ctx context.Context, input *UserMessage, opts ...any) (output map[string]any, err error) {
+	logger := lambdaLogger.WithContext(ctx).With(util.F("component", "InputToHistory"))
+
 	// Log input
-	inputJSON, _ := json.MarshalIndent(input, "", "  ")
-	log.Printf("[InputToHistory] Input: %s", string(inputJSON))
+	logMessages(logger, "Input history", input.History, util.F("id", input.ID), util.F("query_len", len(input.Query)))
 
 	output = map[string]any{
 		"content": input.Query,
@@ -34,8 +39,9 @@ func newInputToHistory(ctx context.Context, input *UserMessage, opts ...any) (ou
 	}
 
 	// Log output
-	outputJSON, _ := json.MarshalIndent(output, "", "  ")
-	log.Printf("[InputToHistory] Output: %s", string(outputJSON))
+	if logger.Enabled(util.DEBUG) {
+		logger.With(util.F("content", util.Redact(input.Query)), util.F("date", output["date"])).Debug("Output content")
+	}
 
 	return output, nil
 }
@@ -0,0 +1,22 @@
+package agent
+
+// Close releases the Redis connections, the workspace and the MCP servers shared by the graphs built with BuildEinoAgent.
+func Close() error {
+	workspaceOnce.Do(func() {})
+	if sharedWorkspace != nil {
+		_ = sharedWorkspace.Close()
+	}
+	toolRegistryOnce.Do(func() {})
+	if mcpServers != nil {
+		_ = mcpServers.Close()
+	}
+	taskStoreOnce.Do(func() {})
+	if taskClient != nil {
+		_ = taskClient.Close()
+	}
+	retrieverClientOnce.Do(func() {})
+	if retrieverClient == nil {
+		return nil
+	}
+	return retrieverClient.Close()
+}
@@ -2,64 +2,80 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components"
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/schema"
-	"log"
+	"myeino/util"
 )
 
-// LoggingChatModel 是一个包装器，用于记录所有的模型调用参数
+var chatModelLogger = util.With(util.F("component", "LoggingChatModel"))
+
+// LoggingChatModel 是一个包装器，用于记录所有的模型调用参数。
+// 回调和组件类型沿用内层模型，用量只记录一次
 type LoggingChatModel struct {
-	inner model.ChatModel
+	inner model.BaseChatModel
 }
 
 func (lcm *LoggingChatModel) Generate(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.Message, error) {
-	log.Printf("[LoggingChatModel] === GENERATE CALL ===")
-	log.Printf("[LoggingChatModel] Input Messages: %d", len(in))
-	for i, msg := range in {
-		log.Printf("[LoggingChatModel] Message[%d]: Role=%s, Content(len=%d)", i, msg.Role, len(msg.Content))
-		if len(msg.Content) > 500 {
-			log.Printf("[LoggingChatModel] Message[%d] Content Preview: %s...", i, msg.Content[:500])
-		} else {
-			log.Printf("[LoggingChatModel] Message[%d] Content: %s", i, msg.Content)
-		}
+	logger := chatModelLogger.WithContext(ctx).With(util.F("call", "generate"))
+	logMessages(logger, "Input", in, util.F("option_count", len(opts)))
+
+	out, err := lcm.inner.Generate(ctx, in, opts...)
+	if err != nil {
+		logger.With(util.F("error", util.Redact(err.Error())), util.F("error_type", fmt.Sprintf("%T", err))).Error("Generate failed")
+		return nil, err
 	}
-	log.Printf("[LoggingChatModel] Options Count: %d", len(opts))
-	return lcm.inner.Generate(ctx, in, opts...)
+
+	logMessages(logger, "Output", []*schema.Message{out})
+	return out, nil
 }
 
 func (lcm *LoggingChatModel) Stream(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
-	log.Printf("[LoggingChatModel] === STREAM CALL ===")
-	log.Printf("[LoggingChatModel] Input Messages: %d", len(in))
-	for i, msg := range in {
-		log.Printf("[LoggingChatModel] Message[%d]: Role=%s, Content(len=%d)", i, msg.Role, len(msg.Content))
-		if len(msg.Content) > 500 {
-			log.Printf("[LoggingChatModel] Message[%d] Content Preview: %s...", i, msg.Content[:500])
-		} else {
-			log.Printf("[LoggingChatModel] Message[%d] Content: %s", i, msg.Content)
-		}
-		if len(msg.ToolCalls) > 0 {
-			log.Printf("[LoggingChatModel] Message[%d] ToolCalls: %d", i, len(msg.ToolCalls))
-		}
-	}
-	log.Printf("[LoggingChatModel] Options Count: %d", len(opts))
-	for i, opt := range opts {
-		log.Printf("[LoggingChatModel] Option[%d]: %T", i, opt)
-	}
+	logger := chatModelLogger.WithContext(ctx).With(util.F("call", "stream"))
+	logMessages(logger, "Input", in, util.F("option_count", len(opts)))
 
-	log.Printf("[LoggingChatModel] === CALLING INNER STREAM ===")
 	stream, err := lcm.inner.Stream(ctx, in, opts...)
 	if err != nil {
-		log.Printf("[LoggingChatModel] === STREAM CALL FAILED ===")
-		log.Printf("[LoggingChatModel] Error Type: %T", err)
-		log.Printf("[LoggingChatModel] Error: %v", err)
+		logger.With(util.F("error", util.Redact(err.Error())), util.F("error_type", fmt.Sprintf("%T", err))).Error("Stream failed")
 		return nil, err
 	}
 
-	log.Printf("[LoggingChatModel] === STREAM CALL SUCCESSFUL ===")
+	logger.Info("Stream started")
 	return stream, nil
 }
 
+func (lcm *LoggingChatModel) BindTools(tools []*schema.ToolInfo) error {
+	cm, ok := lcm.inner.(model.ChatModel)
+	if !ok {
+		return fmt.Errorf("%T does not support BindTools", lcm.inner)
+	}
+	return cm.BindTools(tools)
+}
+
+// WithTools returns the inner model bound to tools, wrapped again.
+func (lcm *LoggingChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	tcm, ok := lcm.inner.(model.ToolCallingChatModel)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support WithTools", lcm.inner)
+	}
+	inner, err := tcm.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	return &LoggingChatModel{inner: inner}, nil
+}
+
+func (lcm *LoggingChatModel) GetType() string {
+	typ, _ := components.GetType(lcm.inner)
+	return typ
+}
+
+func (lcm *LoggingChatModel) IsCallbacksEnabled() bool {
+	return components.IsCallbacksEnabled(lcm.inner)
+}
+
 func newChatModel(ctx context.Context) (cm model.ChatModel, err error) {
 	// TODO Modify component configuration here.
 	maxTokens := 4096
@@ -69,28 +85,23 @@ func newChatModel(ctx context.Context) (cm model.ChatModel, err error) {
 		MaxTokens: &maxTokens, // 添加 max_tokens 参数，使用指针
 	}
 
-	// 详细打印模型配置参数
-	log.Printf("[ChatModel] === DETAILED MODEL CONFIGURATION ===")
-	log.Printf("[ChatModel] Model Name: %s", config.Model)
-	log.Printf("[ChatModel] Base URL: %s", config.BaseURL)
-	log.Printf("[ChatModel] API Key (first 10 chars): %s...", config.APIKey[:10])
+	logger := chatModelLogger.WithContext(ctx)
+	maxTokensField := util.F("max_tokens", "not set")
 	if config.MaxTokens != nil {
-		log.Printf("[ChatModel] Max Tokens: %d", *config.MaxTokens)
-	} else {
-		log.Printf("[ChatModel] Max Tokens: Not set")
+		maxTokensField = util.F("max_tokens", *config.MaxTokens)
 	}
-	log.Printf("[ChatModel] Config Type: %T", config)
+	logger.With(
+		util.F("model", config.Model),
+		util.F("base_url", config.BaseURL),
+		util.F("api_key", util.MaskSecret(config.APIKey)),
+		maxTokensField,
+	).Debug("Model configuration")
 
 	innerCm, err := openai.NewChatModel(ctx, config)
 	if err != nil {
-		log.Printf("[ChatModel] Model creation failed: %v", err)
+		logger.With(util.F("error", util.Redact(err.Error()))).Error("Model creation failed")
 		return nil, err
 	}
-
-	log.Printf("[ChatModel] Model created successfully, Type: %T", innerCm)
-
-	// 返回包装的日志模型
-	cm = innerCm
-	log.Printf("[ChatModel] Wrapped with LoggingChatModel")
-	return cm, nil
+	logger.With(util.F("type", fmt.Sprintf("%T", innerCm))).Debug("Model created, wrapped with LoggingChatModel")
+	return &LoggingChatModel{inner: innerCm}, nil
 }
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// bindableModel records the tools it is bound to and runs its own callbacks, like the OpenAI model.
+type bindableModel struct {
+	fakeChatModel
+	tools []*schema.ToolInfo
+}
+
+func (m *bindableModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return &bindableModel{tools: tools}, nil
+}
+
+func (m *bindableModel) GetType() string          { return "ToolCalling" }
+func (m *bindableModel) IsCallbacksEnabled() bool { return true }
+
+func TestLoggingChatModelPassesThrough(t *testing.T) {
+	cm := &LoggingChatModel{inner: &bindableModel{}}
+	if typ, _ := components.GetType(cm); typ != "ToolCalling" {
+		t.Errorf("type = %q", typ)
+	}
+	// 内层模型自己执行回调，包装器再执行一次会重复记录用量
+	if !components.IsCallbacksEnabled(cm) {
+		t.Error("callbacks of the inner model are not used")
+	}
+
+	tools := []*schema.ToolInfo{{Name: "search"}}
+	bound, err := cm.WithTools(tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, ok := bound.(*LoggingChatModel)
+	if !ok {
+		t.Fatalf("WithTools returned %T", bound)
+	}
+	if inner := wrapped.inner.(*bindableModel); len(inner.tools) != 1 || inner.tools[0].Name != "search" {
+		t.Errorf("tools = %v", inner.tools)
+	}
+	if err := cm.BindTools(tools); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := (&LoggingChatModel{inner: &fakeChatModel{}}).WithTools(tools); err == nil {
+		t.Error("expected an error for a model without WithTools")
+	}
+}
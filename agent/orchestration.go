@@ -7,7 +7,9 @@ import (
 	"github.com/cloudwego/eino/schema"
 )
 
-func BuildEinoAgent(ctx context.Context) (r compose.Runnable[*UserMessage, *schema.Message], err error) {
+// BuildEinoAgent builds the RAG + ReAct graph. Pass compose.WithCheckPointStore in opts to let runs
+// pause for tool approvals, see ApprovalRequests.
+func BuildEinoAgent(ctx context.Context, opts ...compose.GraphCompileOption) (r compose.Runnable[*UserMessage, *schema.Message], err error) {
 	const (
 		InputToQuery   = "InputToQuery"
 		InputToHistory = "InputToHistory"
@@ -40,7 +42,8 @@ func BuildEinoAgent(ctx context.Context) (r compose.Runnable[*UserMessage, *sche
 	_ = g.AddEdge(Retriever, ChatTemplate)
 	_ = g.AddEdge(InputToHistory, ChatTemplate)
 	_ = g.AddEdge(ChatTemplate, ReactAgent)
-	r, err = g.Compile(ctx, compose.WithGraphName("EinoAgent"), compose.WithNodeTriggerMode(compose.AllPredecessor))
+	opts = append([]compose.GraphCompileOption{compose.WithGraphName("EinoAgent"), compose.WithNodeTriggerMode(compose.AllPredecessor)}, opts...)
+	r, err = g.Compile(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -2,8 +2,8 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"myeino/util"
+	"sort"
 
 	"github.com/cloudwego/eino/components/prompt"
 	"github.com/cloudwego/eino/schema"
@@ -47,27 +47,37 @@ type ChatTemplateConfig struct {
 	Templates  []schema.MessagesTemplate
 }
 
+var chatTemplateLogger = util.With(util.F("component", "ChatTemplate"))
+
 // LoggedChatTemplate wraps a chat template to add logging
 type LoggedChatTemplate struct {
 	inner prompt.ChatTemplate
 }
 
 func (lct *LoggedChatTemplate) Format(ctx context.Context, input map[string]any, opts ...prompt.Option) ([]*schema.Message, error) {
-	// Log input
-	inputJSON, _ := json.MarshalIndent(input, "", "  ")
-	log.Printf("[ChatTemplate] Input: %s", string(inputJSON))
+	logger := chatTemplateLogger.WithContext(ctx)
+
+	// Log input, variable values may contain user content so only their names are logged at INFO
+	variables := make([]string, 0, len(input))
+	for k := range input {
+		variables = append(variables, k)
+	}
+	sort.Strings(variables)
+	logger.With(util.F("variables", variables)).Info("Input")
+	if logger.Enabled(util.DEBUG) {
+		logger.With(util.F("input", util.RedactAny(input))).Debug("Input content")
+	}
 
 	// Call inner chat template
 	messages, err := lct.inner.Format(ctx, input, opts...)
 
 	// Log output
 	if err != nil {
-		log.Printf("[ChatTemplate] Error: %v", err)
+		logger.With(util.F("error", util.Redact(err.Error()))).Error("Format failed")
 		return nil, err
 	}
 
-	outputJSON, _ := json.MarshalIndent(messages, "", "  ")
-	log.Printf("[ChatTemplate] Output: %d messages formatted: %s", len(messages), string(outputJSON))
+	logMessages(logger, "Output", messages)
 
 	return messages, nil
 }
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"github.com/cloudwego/eino/schema"
+	"myeino/util"
+)
+
+// Verbosity of the logging wrappers follows the logger level:
+// INFO logs metadata only (roles, lengths, counts), DEBUG additionally logs
+// full content after it has been passed through util.Redact.
+
+// messagesMeta summarizes messages without their content.
+func messagesMeta(msgs []*schema.Message) []map[string]any {
+	meta := make([]map[string]any, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+		meta = append(meta, map[string]any{
+			"role":        msg.Role,
+			"content_len": len(msg.Content),
+			"tool_calls":  len(msg.ToolCalls),
+		})
+	}
+	return meta
+}
+
+// redactedMessages returns message content with secrets and PII masked.
+func redactedMessages(msgs []*schema.Message) []map[string]any {
+	out := make([]map[string]any, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+		m := map[string]any{
+			"role":    msg.Role,
+			"content": util.Redact(msg.Content),
+		}
+		if len(msg.ToolCalls) > 0 {
+			calls := make([]map[string]any, 0, len(msg.ToolCalls))
+			for _, call := range msg.ToolCalls {
+				calls = append(calls, map[string]any{
+					"id":        call.ID,
+					"name":      call.Function.Name,
+					"arguments": util.Redact(call.Function.Arguments),
+				})
+			}
+			m["tool_calls"] = calls
+		}
+		if msg.ToolCallID != "" {
+			m["tool_call_id"] = msg.ToolCallID
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// logMessages logs metadata at INFO and redacted content at DEBUG.
+func logMessages(logger *util.Logger, msg string, msgs []*schema.Message, fields ...util.Field) {
+	fields = append(fields, util.F("count", len(msgs)), util.F("messages", messagesMeta(msgs)))
+	logger.With(fields...).Info(msg)
+	if logger.Enabled(util.DEBUG) {
+		logger.With(util.F("messages", redactedMessages(msgs))).Debug(msg + " content")
+	}
+}
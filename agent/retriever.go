@@ -2,64 +2,98 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	redispkg "github.com/cloudwego/eino-examples/quickstart/eino_assistant/pkg/redis"
 	"github.com/cloudwego/eino/schema"
 	rds "github.com/redis/go-redis/v9"
 	"log"
+	"myeino/util"
 	"strconv"
+	"sync"
 
 	"github.com/cloudwego/eino-ext/components/retriever/redis"
 	"github.com/cloudwego/eino/components/retriever"
 )
 
+var retrieverLogger = util.With(util.F("component", "Retriever"))
+
+var tenantFieldOnce sync.Once
+
+// The retriever is rebuilt for every agent run, its Redis client is shared so that connections are reused.
+var (
+	retrieverClientOnce sync.Once
+	retrieverClient     *rds.Client
+)
+
+func getRetrieverClient() *rds.Client {
+	retrieverClientOnce.Do(func() {
+		retrieverClient = rds.NewClient(&rds.Options{
+			Addr:     "localhost:6479",
+			Protocol: 2,
+		})
+	})
+	return retrieverClient
+}
+
 // LoggedRetriever wraps a retriever to add logging
 type LoggedRetriever struct {
 	inner retriever.Retriever
 }
 
 func (lr *LoggedRetriever) Retrieve(ctx context.Context, query string, opts ...retriever.Option) ([]*schema.Document, error) {
+	logger := retrieverLogger.WithContext(ctx)
+
 	// Log input
-	log.Printf("[Retriever] Input: query=%s", query)
+	logger.With(util.F("query_len", len(query))).Info("Input")
+	if logger.Enabled(util.DEBUG) {
+		logger.With(util.F("query", util.Redact(query))).Debug("Input content")
+	}
 
 	// Call inner retriever
 	docs, err := lr.inner.Retrieve(ctx, query, opts...)
 
 	// Log output
 	if err != nil {
-		log.Printf("[Retriever] Error: %v", err)
+		logger.With(util.F("error", util.Redact(err.Error()))).Error("Retrieve failed")
 		return nil, err
 	}
 
 	// Format documents for better logging
 	formattedDocs := make([]map[string]interface{}, len(docs))
 	for i, doc := range docs {
-		contentPreview := doc.Content
-		if len(doc.Content) > 100 {
-			contentPreview = doc.Content[:100] + "..."
-		}
 		formattedDocs[i] = map[string]interface{}{
-			"id":      doc.ID,
-			"content": contentPreview,
-			"score":   doc.Score(),
+			"id":          doc.ID,
+			"content_len": len(doc.Content),
+			"score":       doc.Score(),
 		}
 	}
+	logger.With(util.F("count", len(docs)), util.F("documents", formattedDocs)).Info("Output")
 
-	outputJSON, _ := json.MarshalIndent(formattedDocs, "", "  ")
-	log.Printf("[Retriever] Output: %d documents retrieved: %s", len(docs), string(outputJSON))
+	if logger.Enabled(util.DEBUG) {
+		for i, doc := range docs {
+			contentPreview := doc.Content
+			if len(doc.Content) > 100 {
+				contentPreview = doc.Content[:100] + "..."
+			}
+			formattedDocs[i]["content"] = util.Redact(contentPreview)
+		}
+		logger.With(util.F("documents", formattedDocs)).Debug("Output content")
+	}
 
 	return docs, nil
 }
 
+// NewRetriever builds the knowledge base retriever of the agent graph, scoped to the tenant of each request.
+func NewRetriever(ctx context.Context) (retriever.Retriever, error) {
+	return newRetriever(ctx)
+}
+
 // newRetriever component initialization function of node 'Retriever' in graph 'EinoAgent'
 func newRetriever(ctx context.Context) (rtr retriever.Retriever, err error) {
 	// TODO Modify component configuration here.
+	client := getRetrieverClient()
 	config := &redis.RetrieverConfig{
-		Client: rds.NewClient(&rds.Options{
-			Addr:     "localhost:6479",
-			Protocol: 2,
-		}),
+		Client:       client,
 		Index:        fmt.Sprintf("%s%s", redispkg.RedisPrefix, redispkg.IndexName),
 		Dialect:      2,
 		ReturnFields: []string{redispkg.ContentField, redispkg.MetadataField, redispkg.DistanceField},
@@ -98,7 +132,14 @@ func newRetriever(ctx context.Context) (rtr retriever.Retriever, err error) {
 		return nil, err
 	}
 
-	// Wrap with logging
-	rtr = &LoggedRetriever{inner: baseRetriever}
+	// 多租户检索依赖索引中的 tenant_id 字段
+	tenantFieldOnce.Do(func() {
+		if err := EnsureTenantField(ctx, client, config.Index); err != nil {
+			log.Printf("[Retriever] Tenant filtering may fail: %v", err)
+		}
+	})
+
+	// Wrap with tenant scoping and logging
+	rtr = &LoggedRetriever{inner: &TenantRetriever{inner: baseRetriever}}
 	return rtr, nil
 }
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino-ext/components/retriever/redis"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/schema"
+	rds "github.com/redis/go-redis/v9"
+	"myeino/util"
+)
+
+const (
+	// TenantField is the TAG field holding the owner tenant of indexed documents and cached answers.
+	TenantField = "tenant_id"
+	// PublicTenant marks documents visible to every tenant.
+	PublicTenant = "public"
+)
+
+// TenantOf returns the tenant of the request, PublicTenant when the server runs without authentication.
+func TenantOf(ctx context.Context) string {
+	if tenant := util.TenantIDFromContext(ctx); tenant != "" {
+		return tenant
+	}
+	return PublicTenant
+}
+
+// TenantFilter returns the RediSearch filter restricting results to the tenant of ctx and public documents.
+// It returns an empty filter when the request has no tenant, which keeps single-tenant deployments unchanged.
+func TenantFilter(ctx context.Context) string {
+	tenant := util.TenantIDFromContext(ctx)
+	if tenant == "" {
+		return ""
+	}
+	if tenant == PublicTenant {
+		return fmt.Sprintf("@%s:{%s}", TenantField, PublicTenant)
+	}
+	return fmt.Sprintf("@%s:{%s | %s}", TenantField, EscapeTag(tenant), PublicTenant)
+}
+
+// EscapeTag escapes RediSearch TAG query syntax in value.
+func EscapeTag(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 127) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// EnsureTenantField adds the tenant TAG field to an existing index. Documents indexed before
+// the field existed have no tenant and are only returned to requests without a tenant.
+func EnsureTenantField(ctx context.Context, client *rds.Client, index string) error {
+	err := client.Do(ctx, "FT.ALTER", index, "SCHEMA", "ADD", TenantField, "TAG").Err()
+	if err != nil && !strings.Contains(strings.ToLower(err.Error()), "duplicate") {
+		return fmt.Errorf("failed to add %s to index %s: %w", TenantField, index, err)
+	}
+	return nil
+}
+
+// TenantRetriever scopes every retrieval to the tenant of the request.
+type TenantRetriever struct {
+	inner retriever.Retriever
+}
+
+func (tr *TenantRetriever) Retrieve(ctx context.Context, query string, opts ...retriever.Option) ([]*schema.Document, error) {
+	if filter := TenantFilter(ctx); filter != "" {
+		opts = append(opts, redis.WithFilterQuery(filter))
+	}
+	return tr.inner.Retrieve(ctx, query, opts...)
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/schema"
+	"myeino/util"
+)
+
+func TestTenantFilter(t *testing.T) {
+	tests := []struct {
+		tenant string
+		want   string
+	}{
+		{"", ""},
+		{"acme", "@tenant_id:{acme | public}"},
+		{"public", "@tenant_id:{public}"},
+		{"acme-corp.io", `@tenant_id:{acme\-corp\.io | public}`},
+		{"a} | b", `@tenant_id:{a\}\ \|\ b | public}`},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.tenant != "" {
+			ctx = util.WithTenantID(ctx, tt.tenant)
+		}
+		if got := TenantFilter(ctx); got != tt.want {
+			t.Errorf("TenantFilter(%q) = %q, want %q", tt.tenant, got, tt.want)
+		}
+	}
+}
+
+type optsRecorder struct {
+	opts []retriever.Option
+}
+
+func (r *optsRecorder) Retrieve(ctx context.Context, query string, opts ...retriever.Option) ([]*schema.Document, error) {
+	r.opts = opts
+	return nil, nil
+}
+
+func TestTenantRetrieverAddsFilter(t *testing.T) {
+	inner := &optsRecorder{}
+	tr := &TenantRetriever{inner: inner}
+
+	if _, err := tr.Retrieve(context.Background(), "q"); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.opts) != 0 {
+		t.Errorf("unexpected filter without tenant")
+	}
+
+	if _, err := tr.Retrieve(util.WithTenantID(context.Background(), "acme"), "q"); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.opts) != 1 {
+		t.Errorf("expected tenant filter option, got %d options", len(inner.opts))
+	}
+}
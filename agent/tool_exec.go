@@ -0,0 +1,279 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ToolExecConfig bounds the tool calls of an agent run. The calls of one model turn run in parallel.
+type ToolExecConfig struct {
+	// MaxConcurrency limits the tool calls running at once in a run, 1 runs them one after another.
+	MaxConcurrency int
+	// Timeout bounds each tool call, Timeouts overrides it per tool name.
+	Timeout  time.Duration
+	Timeouts map[string]time.Duration
+	// Output shortens long results before they are given to the model, nil keeps them whole.
+	Output *OutputProcessor
+}
+
+// DefaultToolExecConfig runs up to 4 calls at once, for at most 2 minutes each, and shortens results
+// above about 4000 tokens.
+func DefaultToolExecConfig() *ToolExecConfig {
+	return &ToolExecConfig{
+		MaxConcurrency: 4,
+		Timeout:        2 * time.Minute,
+		Output:         &OutputProcessor{MaxTokens: 4000},
+	}
+}
+
+// toolExecConfig returns the defaults overridden by TOOL_MAX_CONCURRENCY, TOOL_TIMEOUT,
+// TOOL_TIMEOUTS (e.g. "gitclone=5m,duckduckgo_text_search=15s"), TOOL_OUTPUT_MAX_TOKENS and
+// TOOL_OUTPUT_SUMMARIZE_ABOVE, the size in tokens above which results are summarized by the model.
+// The full results are kept in the shared artifact store.
+func toolExecConfig() *ToolExecConfig {
+	config := DefaultToolExecConfig()
+	if n, err := strconv.Atoi(os.Getenv("TOOL_MAX_CONCURRENCY")); err == nil && n > 0 {
+		config.MaxConcurrency = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("TOOL_TIMEOUT")); err == nil && d > 0 {
+		config.Timeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("TOOL_OUTPUT_MAX_TOKENS")); err == nil && n > 0 {
+		config.Output.MaxTokens = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("TOOL_OUTPUT_SUMMARIZE_ABOVE")); err == nil && n > 0 {
+		config.Output.SummarizeAbove = n
+	}
+	config.Output.Artifacts = getArtifacts()
+	if raw := os.Getenv("TOOL_TIMEOUTS"); raw != "" {
+		timeouts, err := ParseToolTimeouts(raw)
+		if err != nil {
+			log.Printf("[ToolExec] Ignoring TOOL_TIMEOUTS: %v", err)
+		} else {
+			config.Timeouts = timeouts
+		}
+	}
+	return config
+}
+
+// ParseToolTimeouts parses a name=duration list separated by commas, e.g. "gitclone=5m,open=10s".
+func ParseToolTimeouts(raw string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, kv := range strings.Split(raw, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid tool timeout %q, want name=duration", kv)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q for tool %s", value, name)
+		}
+		timeouts[strings.TrimSpace(name)] = d
+	}
+	return timeouts, nil
+}
+
+// ToolError is the result given to the model for a failed tool call, so that it can retry,
+// use another tool or answer without it instead of failing the run.
+type ToolError struct {
+	Tool string `json:"tool"`
+	// Kind is timeout, error or panic.
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+func (e *ToolError) String() string {
+	data, _ := json.Marshal(map[string]*ToolError{"error": e})
+	return string(data)
+}
+
+func (e *ToolError) Error() string {
+	return fmt.Sprintf("tool %s failed (%s): %s", e.Tool, e.Kind, e.Message)
+}
+
+// toolsNodeConfig runs tools with the limits of config, calls of unknown tools are reported to the model.
+// read_artifact is added when config keeps artifacts.
+func toolsNodeConfig(ctx context.Context, tools []tool.BaseTool, config *ToolExecConfig) (compose.ToolsNodeConfig, error) {
+	if config.Output != nil && config.Output.Artifacts != nil {
+		readArtifact, err := NewReadArtifactTool(config.Output.Artifacts, config.Output.MaxTokens)
+		if err != nil {
+			return compose.ToolsNodeConfig{}, err
+		}
+		tools = append(slices.Clone(tools), readArtifact)
+	}
+	wrapped, err := WithToolLimits(ctx, tools, config)
+	if err != nil {
+		return compose.ToolsNodeConfig{}, err
+	}
+	return compose.ToolsNodeConfig{
+		Tools:               wrapped,
+		ExecuteSequentially: config.MaxConcurrency == 1,
+		UnknownToolsHandler: func(ctx context.Context, name, input string) (string, error) {
+			return (&ToolError{Tool: name, Kind: "error", Message: "no tool has this name"}).String(), nil
+		},
+	}, nil
+}
+
+// WithToolLimits wraps invokable tools with the limits of config. The tools share one concurrency limit,
+// wrap them again for every run.
+func WithToolLimits(ctx context.Context, tools []tool.BaseTool, config *ToolExecConfig) ([]tool.BaseTool, error) {
+	if config == nil {
+		config = DefaultToolExecConfig()
+	}
+	var slots chan struct{}
+	if config.MaxConcurrency > 0 {
+		slots = make(chan struct{}, config.MaxConcurrency)
+	}
+	wrapped := make([]tool.BaseTool, 0, len(tools))
+	for _, t := range tools {
+		inv, ok := t.(tool.InvokableTool)
+		if !ok {
+			wrapped = append(wrapped, t)
+			continue
+		}
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+		timeout := config.Timeout
+		if d, ok := config.Timeouts[info.Name]; ok {
+			timeout = d
+		}
+		wrapped = append(wrapped, &limitedTool{inner: inv, name: info.Name, slots: slots, timeout: timeout, output: config.Output})
+	}
+	return wrapped, nil
+}
+
+// limitedTool runs the calls of inner with a concurrency slot and a timeout, and shortens long results.
+// It runs the tool callbacks itself: failures are given to the model as results, the callbacks still
+// see them as errors.
+type limitedTool struct {
+	inner   tool.InvokableTool
+	name    string
+	slots   chan struct{}
+	timeout time.Duration
+	output  *OutputProcessor
+}
+
+func (t *limitedTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return t.inner.Info(ctx)
+}
+
+func (t *limitedTool) GetType() string {
+	typ, _ := components.GetType(t.inner)
+	return typ
+}
+
+func (t *limitedTool) IsCallbacksEnabled() bool {
+	return true
+}
+
+type toolOutput struct {
+	out string
+	err error
+}
+
+func (t *limitedTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	ctx = callbacks.OnStart(ctx, &tool.CallbackInput{ArgumentsInJSON: argumentsInJSON})
+	out, toolErr, err := t.run(ctx, argumentsInJSON, opts...)
+	switch {
+	case err != nil:
+		callbacks.OnError(ctx, err)
+		return "", err
+	case toolErr != nil:
+		callbacks.OnError(ctx, toolErr)
+		return toolErr.String(), nil
+	}
+	callbacks.OnEnd(ctx, &tool.CallbackOutput{Response: out})
+	return out, nil
+}
+
+// run calls inner, err interrupts the run while toolErr is a failure reported to the model.
+func (t *limitedTool) run(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (out string, toolErr *ToolError, err error) {
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		}
+	}
+
+	callCtx := ctx
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	// 工具不理会 ctx 时也按时返回，调用在后台结束，结束后才释放并发名额
+	done := make(chan toolOutput, 1)
+	go func() {
+		defer func() {
+			if t.slots != nil {
+				<-t.slots
+			}
+		}()
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("[ToolExec] Tool %s panicked: %v\n%s", t.name, p, debug.Stack())
+				done <- toolOutput{err: &panicError{value: p}}
+			}
+		}()
+		out, err := t.inner.InvokableRun(callCtx, argumentsInJSON, opts...)
+		done <- toolOutput{out: out, err: err}
+	}()
+
+	var res toolOutput
+	select {
+	case res = <-done:
+	case <-callCtx.Done():
+		res = toolOutput{err: callCtx.Err()}
+	}
+
+	if res.err != nil {
+		// 运行被中断或暂停等待确认时照常返回错误
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		if _, ok := compose.IsInterruptRerunError(res.err); ok {
+			return "", nil, res.err
+		}
+		toolErr := &ToolError{Tool: t.name, Kind: "error", Message: res.err.Error()}
+		var p *panicError
+		switch {
+		case errors.Is(callCtx.Err(), context.DeadlineExceeded):
+			toolErr.Kind, toolErr.Message = "timeout", fmt.Sprintf("the tool did not finish within %s", t.timeout)
+		case errors.As(res.err, &p):
+			toolErr.Kind = "panic"
+		}
+		log.Printf("[ToolExec] Tool %s failed (%s): %v", t.name, toolErr.Kind, res.err)
+		return "", toolErr, nil
+	}
+	return t.output.Process(ctx, t.name, res.out), nil, nil
+}
+
+type panicError struct {
+	value any
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("the tool crashed: %v", e.value)
+}
@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"myeino/telemetry"
+)
+
+// funcTool runs run for every call.
+type funcTool struct {
+	name string
+	run  func(ctx context.Context, args string) (string, error)
+}
+
+func (t *funcTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: t.name}, nil
+}
+
+func (t *funcTool) InvokableRun(ctx context.Context, args string, opts ...tool.Option) (string, error) {
+	return t.run(ctx, args)
+}
+
+func toolErrorOf(t *testing.T, out string) *ToolError {
+	t.Helper()
+	var res struct{ Error *ToolError }
+	if err := json.Unmarshal([]byte(out), &res); err != nil || res.Error == nil {
+		t.Fatalf("not a tool error: %q", out)
+	}
+	return res.Error
+}
+
+func TestToolsNodeLimits(t *testing.T) {
+	var running, peak atomic.Int32
+	slow := &funcTool{name: "slow", run: func(ctx context.Context, args string) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(50 * time.Millisecond)
+		return "done " + args, nil
+	}}
+	hang := &funcTool{name: "hang", run: func(ctx context.Context, args string) (string, error) {
+		// 不理会 ctx 的工具也按超时返回
+		time.Sleep(time.Second)
+		return "late", nil
+	}}
+	failing := &funcTool{name: "failing", run: func(ctx context.Context, args string) (string, error) {
+		return "", errors.New("backend unavailable")
+	}}
+	crashing := &funcTool{name: "crashing", run: func(ctx context.Context, args string) (string, error) {
+		panic("nil map")
+	}}
+	big := &funcTool{name: "big", run: func(ctx context.Context, args string) (string, error) {
+		return strings.Repeat("数据", 100), nil
+	}}
+
+	config := &ToolExecConfig{MaxConcurrency: 2, Timeout: time.Second, Timeouts: map[string]time.Duration{"hang": 100 * time.Millisecond}, Output: &OutputProcessor{MaxTokens: 16}}
+	ctx := context.Background()
+	nodeConfig, err := toolsNodeConfig(ctx, []tool.BaseTool{slow, hang, failing, crashing, big}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := compose.NewToolNode(ctx, &nodeConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []schema.ToolCall
+	for i, name := range []string{"slow", "slow", "slow", "slow", "hang", "failing", "crashing", "big", "missing"} {
+		calls = append(calls, schema.ToolCall{ID: string(rune('a' + i)), Function: schema.FunctionCall{Name: name, Arguments: `{}`}})
+	}
+	msgs, err := node.Invoke(ctx, schema.AssistantMessage("", calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]string{}
+	for _, m := range msgs {
+		results[m.ToolCallID] = m.Content
+	}
+
+	if peak.Load() != 2 {
+		t.Errorf("%d calls of slow ran at once, want 2", peak.Load())
+	}
+	if results["a"] != "done {}" {
+		t.Errorf("slow = %q", results["a"])
+	}
+	for id, kind := range map[string]string{"e": "timeout", "f": "error", "g": "panic", "i": "error"} {
+		if e := toolErrorOf(t, results[id]); e.Kind != kind {
+			t.Errorf("call %s: %+v, want %s", id, e, kind)
+		}
+	}
+	if out := results["h"]; !strings.Contains(out, "omitted") || !strings.Contains(out, "the full output is not kept") {
+		t.Errorf("big = %q", out)
+	}
+}
+
+func TestToolLimitsPassInterrupts(t *testing.T) {
+	interrupting := &funcTool{name: "confirm", run: func(ctx context.Context, args string) (string, error) {
+		return "", compose.NewInterruptAndRerunErr(&ApprovalRequest{Tool: "confirm"})
+	}}
+	tools, err := WithToolLimits(context.Background(), []tool.BaseTool{interrupting}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tools[0].(tool.InvokableTool).InvokableRun(context.Background(), `{}`)
+	if _, ok := compose.IsInterruptRerunError(err); !ok {
+		t.Errorf("interrupt turned into %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := tools[0].(tool.InvokableTool).InvokableRun(ctx, `{}`); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled run = %v", err)
+	}
+}
+
+func TestToolFailuresReachCallbacks(t *testing.T) {
+	ok := &funcTool{name: "ok", run: func(ctx context.Context, args string) (string, error) {
+		return "done", nil
+	}}
+	failing := &funcTool{name: "failing", run: func(ctx context.Context, args string) (string, error) {
+		return "", errors.New("backend unavailable")
+	}}
+	crashing := &funcTool{name: "crashing", run: func(ctx context.Context, args string) (string, error) {
+		panic("nil map")
+	}}
+	ctx := context.Background()
+	nodeConfig, err := toolsNodeConfig(ctx, []tool.BaseTool{ok, failing, crashing}, &ToolExecConfig{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := compose.NewToolNode(ctx, &nodeConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := compose.NewGraph[*schema.Message, []*schema.Message]()
+	_ = g.AddToolsNode("Tools", node)
+	_ = g.AddEdge(compose.START, "Tools")
+	_ = g.AddEdge("Tools", compose.END)
+	r, err := g.Compile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := prometheus.NewRegistry()
+	metrics, err := telemetry.NewMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []schema.ToolCall
+	for i, name := range []string{"ok", "failing", "crashing"} {
+		calls = append(calls, schema.ToolCall{ID: string(rune('a' + i)), Function: schema.FunctionCall{Name: name, Arguments: `{}`}})
+	}
+	if _, err := r.Invoke(ctx, schema.AssistantMessage("", calls), compose.WithCallbacks(metrics)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `
+# HELP einoagent_tool_errors_total Tool invocations that returned an error, by tool name.
+# TYPE einoagent_tool_errors_total counter
+einoagent_tool_errors_total{tool="crashing"} 1
+einoagent_tool_errors_total{tool="failing"} 1
+# HELP einoagent_tool_invocations_total Tool invocations by tool name.
+# TYPE einoagent_tool_invocations_total counter
+einoagent_tool_invocations_total{tool="crashing"} 1
+einoagent_tool_invocations_total{tool="failing"} 1
+einoagent_tool_invocations_total{tool="ok"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "einoagent_tool_errors_total", "einoagent_tool_invocations_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestToolLimitsHoldSlotUntilReturn(t *testing.T) {
+	release := make(chan struct{})
+	hang := &funcTool{name: "hang", run: func(ctx context.Context, args string) (string, error) {
+		<-release
+		return "late", nil
+	}}
+	fast := &funcTool{name: "fast", run: func(ctx context.Context, args string) (string, error) {
+		return "done", nil
+	}}
+	tools, err := WithToolLimits(context.Background(), []tool.BaseTool{hang, fast}, &ToolExecConfig{MaxConcurrency: 1, Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tools[0].(tool.InvokableTool).InvokableRun(context.Background(), `{}`)
+	if err != nil || toolErrorOf(t, out).Kind != "timeout" {
+		t.Fatalf("hang = %q, %v", out, err)
+	}
+
+	// the timed out call still runs, the next one waits for it
+	done := make(chan string, 1)
+	go func() {
+		out, _ := tools[1].(tool.InvokableTool).InvokableRun(context.Background(), `{}`)
+		done <- out
+	}()
+	select {
+	case out := <-done:
+		t.Fatalf("fast ran while hang was running: %q", out)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case out := <-done:
+		if out != "done" {
+			t.Errorf("fast = %q", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fast did not run after hang returned")
+	}
+}
+
+func TestParseToolTimeouts(t *testing.T) {
+	timeouts, err := ParseToolTimeouts("gitclone=5m, open=10s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeouts["gitclone"] != 5*time.Minute || timeouts["open"] != 10*time.Second {
+		t.Errorf("timeouts = %v", timeouts)
+	}
+	for _, raw := range []string{"gitclone", "open=soon", "open=-1s"} {
+		if _, err := ParseToolTimeouts(raw); err == nil {
+			t.Errorf("%q accepted", raw)
+		}
+	}
+}
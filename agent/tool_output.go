@@ -0,0 +1,278 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/cloudwego/eino/schema"
+	"myeino/util"
+)
+
+// ToolReadArtifact is the tool reading the full output of a shortened tool result.
+const ToolReadArtifact = "read_artifact"
+
+// maxSummaryInputTokens bounds the part of a result given to the summarizer, the middle of longer results is left out.
+const maxSummaryInputTokens = 16000
+
+// EstimateTokens estimates the tokens of s without a tokenizer: about 4 ASCII characters per token,
+// one token per other character, e.g. Chinese.
+func EstimateTokens(s string) int {
+	return (tokenUnits(s) + 3) / 4
+}
+
+// tokenUnits counts quarter tokens.
+func tokenUnits(s string) int {
+	units := 0
+	for _, r := range s {
+		units += runeUnits(r)
+	}
+	return units
+}
+
+func runeUnits(r rune) int {
+	if r < utf8.RuneSelf {
+		return 1
+	}
+	return 4
+}
+
+// headTail keeps about the first two thirds and the last third of maxTokens of s, cutting at line ends
+// when possible, and marks what was left out.
+func headTail(s string, maxTokens int) string {
+	budget := maxTokens * 4
+	headBudget := budget * 2 / 3
+	tailBudget := budget - headBudget
+
+	head, units := 0, 0
+	for i, r := range s {
+		if units += runeUnits(r); units > headBudget {
+			head = i
+			break
+		}
+	}
+	if units <= headBudget {
+		return s
+	}
+	tail, units := len(s), 0
+	for tail > head {
+		r, size := utf8.DecodeLastRuneInString(s[:tail])
+		if units += runeUnits(r); units > tailBudget {
+			break
+		}
+		tail -= size
+	}
+	// 尽量在换行处截断，保留完整的行
+	if i := strings.LastIndexByte(s[:head], '\n'); i > head/2 {
+		head = i + 1
+	}
+	if i := strings.IndexByte(s[tail:], '\n'); i >= 0 && i < (len(s)-tail)/2 {
+		tail += i + 1
+	}
+	omitted := EstimateTokens(s[head:tail])
+	return fmt.Sprintf("%s\n[... about %d tokens omitted ...]\n%s", strings.TrimSuffix(s[:head], "\n"), omitted, s[tail:])
+}
+
+// Summarizer condenses the output of a tool for the model.
+type Summarizer func(ctx context.Context, toolName, output string) (string, error)
+
+// NewModelSummarizer summarizes with a chat model, which must not have tools bound.
+func NewModelSummarizer(cm model.BaseChatModel) Summarizer {
+	return func(ctx context.Context, toolName, output string) (string, error) {
+		msg, err := cm.Generate(ctx, []*schema.Message{
+			schema.SystemMessage("You condense the output of a tool for an assistant that called it. " +
+				"Keep the facts, names, numbers, paths, identifiers and error messages the assistant may need, drop repetition and boilerplate. " +
+				"Answer with the condensed output only."),
+			schema.UserMessage(fmt.Sprintf("Output of the tool %s:\n\n%s", toolName, output)),
+		})
+		if err != nil {
+			return "", err
+		}
+		return msg.Content, nil
+	}
+}
+
+// OutputProcessor shortens long tool results before they are added to the messages of the run,
+// keeping the full result as an artifact the model can read with read_artifact.
+type OutputProcessor struct {
+	// MaxTokens is the estimated size above which a result is shortened.
+	MaxTokens int
+	// SummarizeAbove is the size above which the result is summarized instead of truncated,
+	// 0 never summarizes. It needs a Summarizer.
+	SummarizeAbove int
+	Summarizer     Summarizer
+	// Artifacts keeps the full results, nil drops them.
+	Artifacts *ArtifactStore
+}
+
+// Process returns out, or a shortened version of it when it is longer than MaxTokens.
+func (p *OutputProcessor) Process(ctx context.Context, toolName, out string) string {
+	if p == nil || p.MaxTokens <= 0 {
+		return out
+	}
+	tokens := EstimateTokens(out)
+	if tokens <= p.MaxTokens {
+		return out
+	}
+
+	note := fmt.Sprintf("The output of %s had about %d tokens and was shortened, the full output is not kept.", toolName, tokens)
+	if id, ok := p.Artifacts.Put(ctx, toolName, out); ok {
+		note = fmt.Sprintf("The output of %s had about %d tokens and was shortened. The full output is artifact %s, call %s to read it.",
+			toolName, tokens, id, ToolReadArtifact)
+	}
+
+	if p.SummarizeAbove > 0 && tokens > p.SummarizeAbove && p.Summarizer != nil {
+		summary, err := p.Summarizer(ctx, toolName, headTail(out, maxSummaryInputTokens))
+		if err == nil {
+			return fmt.Sprintf("[Summary. %s]\n%s", note, headTail(summary, p.MaxTokens))
+		}
+		if ctx.Err() == nil {
+			log.Printf("[ToolOutput] Failed to summarize the output of %s, truncating it: %v", toolName, err)
+		}
+	}
+	return fmt.Sprintf("%s\n[%s]", headTail(out, p.MaxTokens), note)
+}
+
+// Artifact is the full output of a tool call.
+type Artifact struct {
+	ID       string
+	Tool     string
+	TenantID string
+	UserID   string
+	Content  string
+	Created  time.Time
+}
+
+// ArtifactStore keeps artifacts in memory for TTL, dropping the oldest ones beyond MaxBytes.
+// Artifacts are only readable by the instance that stored them.
+type ArtifactStore struct {
+	ttl      time.Duration
+	maxBytes int
+
+	mu        sync.Mutex
+	artifacts map[string]*Artifact
+	// order lists the ids from the oldest
+	order []string
+	size  int
+}
+
+// NewArtifactStore creates a store, ttl defaults to 1h and maxBytes to 64MiB.
+func NewArtifactStore(ttl time.Duration, maxBytes int) *ArtifactStore {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	return &ArtifactStore{ttl: ttl, maxBytes: maxBytes, artifacts: map[string]*Artifact{}}
+}
+
+// Put stores content and returns its id, it returns false when content is larger than the store.
+func (s *ArtifactStore) Put(ctx context.Context, toolName, content string) (string, bool) {
+	if s == nil || len(content) > s.maxBytes {
+		return "", false
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	a := &Artifact{
+		ID:       "art_" + hex.EncodeToString(b),
+		Tool:     toolName,
+		TenantID: util.TenantIDFromContext(ctx),
+		UserID:   util.UserIDFromContext(ctx),
+		Content:  content,
+		Created:  time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 清理过期的和最早的 artifact，腾出空间
+	for len(s.order) > 0 {
+		oldest := s.artifacts[s.order[0]]
+		if time.Since(oldest.Created) < s.ttl && s.size+len(content) <= s.maxBytes {
+			break
+		}
+		s.size -= len(oldest.Content)
+		delete(s.artifacts, oldest.ID)
+		s.order = s.order[1:]
+	}
+	s.artifacts[a.ID] = a
+	s.order = append(s.order, a.ID)
+	s.size += len(content)
+	return a.ID, true
+}
+
+// Get returns an artifact of the tenant and the user of ctx.
+func (s *ArtifactStore) Get(ctx context.Context, id string) (*Artifact, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.artifacts[id]
+	if !ok || a.TenantID != util.TenantIDFromContext(ctx) || a.UserID != util.UserIDFromContext(ctx) ||
+		time.Since(a.Created) >= s.ttl {
+		return nil, false
+	}
+	return a, true
+}
+
+// ReadArtifactParams are the arguments of read_artifact.
+type ReadArtifactParams struct {
+	ID     string `json:"id" jsonschema:"description=Id of the artifact, e.g. art_0123456789abcdef"`
+	Offset int    `json:"offset,omitempty" jsonschema:"description=Byte offset to read from, the next_offset of the previous read, default 0"`
+}
+
+// NewReadArtifactTool reads artifacts in parts that fit in maxTokens with their header, so that
+// they are not shortened again.
+func NewReadArtifactTool(store *ArtifactStore, maxTokens int) (tool.InvokableTool, error) {
+	partTokens := max(maxTokens-64, maxTokens/2)
+	return utils.InferTool(ToolReadArtifact, "Read the full output of a tool call that was shortened, part by part.",
+		func(ctx context.Context, p *ReadArtifactParams) (string, error) {
+			a, ok := store.Get(ctx, p.ID)
+			if !ok {
+				return fmt.Sprintf("Artifact %s does not exist or has expired.", p.ID), nil
+			}
+			if p.Offset < 0 || p.Offset >= len(a.Content) {
+				return fmt.Sprintf("Offset %d is outside of artifact %s, which has %d bytes.", p.Offset, p.ID, len(a.Content)), nil
+			}
+			start := p.Offset
+			for start > 0 && !utf8.RuneStart(a.Content[start]) {
+				start--
+			}
+			end, units := start, 0
+			for i, r := range a.Content[start:] {
+				if units += runeUnits(r); units > partTokens*4 {
+					break
+				}
+				end = start + i + utf8.RuneLen(r)
+			}
+			header := fmt.Sprintf("[Artifact %s from %s, bytes %d-%d of %d", a.ID, a.Tool, start, end, len(a.Content))
+			if end < len(a.Content) {
+				header += ", next_offset " + strconv.Itoa(end)
+			}
+			return header + "]\n" + a.Content[start:end], nil
+		})
+}
+
+var (
+	artifactsOnce   sync.Once
+	sharedArtifacts *ArtifactStore
+)
+
+// getArtifacts configures the artifact store from TOOL_ARTIFACT_TTL (default 1h) and TOOL_ARTIFACT_MAX_BYTES (default 64MiB).
+func getArtifacts() *ArtifactStore {
+	artifactsOnce.Do(func() {
+		ttl, _ := time.ParseDuration(os.Getenv("TOOL_ARTIFACT_TTL"))
+		maxBytes, _ := strconv.Atoi(os.Getenv("TOOL_ARTIFACT_MAX_BYTES"))
+		sharedArtifacts = NewArtifactStore(ttl, maxBytes)
+	})
+	return sharedArtifacts
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"myeino/util"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	for s, want := range map[string]int{"": 0, "abcd": 1, "abcde": 2, "数据": 2, "ab数据": 3} {
+		if got := EstimateTokens(s); got != want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestHeadTail(t *testing.T) {
+	var lines []string
+	for i := range 1000 {
+		lines = append(lines, fmt.Sprintf("line %04d", i))
+	}
+	out := strings.Join(lines, "\n")
+	short := headTail(out, 300)
+	if !strings.HasPrefix(short, "line 0000\n") || !strings.HasSuffix(short, "line 0999") || !strings.Contains(short, "tokens omitted") {
+		t.Errorf("head or tail lost: %q", short)
+	}
+	// 截断在行尾，保留的行都是完整的
+	for _, line := range strings.Split(short, "\n") {
+		if !strings.HasPrefix(line, "line ") && !strings.HasPrefix(line, "[...") {
+			t.Errorf("partial line %q", line)
+		}
+	}
+	if tokens := EstimateTokens(short); tokens > 320 {
+		t.Errorf("shortened to %d tokens", tokens)
+	}
+	if got := headTail("short", 300); got != "short" {
+		t.Errorf("short output changed: %q", got)
+	}
+}
+
+var artifactID = regexp.MustCompile(`art_[0-9a-f]+`)
+
+func TestOutputProcessor(t *testing.T) {
+	store := NewArtifactStore(0, 0)
+	p := &OutputProcessor{MaxTokens: 100, Artifacts: store}
+	ctx := util.WithUserID(util.WithTenantID(context.Background(), "acme"), "alice")
+	out := strings.Repeat("0123456789abcdef\n", 200)
+
+	if got := p.Process(ctx, "open", "small"); got != "small" {
+		t.Errorf("small output changed: %q", got)
+	}
+	short := p.Process(ctx, "open", out)
+	id := artifactID.FindString(short)
+	if id == "" || !strings.Contains(short, ToolReadArtifact) {
+		t.Fatalf("no artifact in %q", short)
+	}
+
+	// 分段读取 artifact，拼接后与原输出一致
+	read, err := NewReadArtifactTool(store, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var full strings.Builder
+	offset := 0
+	for range 100 {
+		part, err := read.InvokableRun(ctx, fmt.Sprintf(`{"id":%q,"offset":%d}`, id, offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, content, _ := strings.Cut(part, "]\n")
+		full.WriteString(content)
+		next := regexp.MustCompile(`next_offset (\d+)`).FindStringSubmatch(header)
+		if next == nil {
+			break
+		}
+		fmt.Sscan(next[1], &offset)
+	}
+	if full.String() != out {
+		t.Errorf("artifact read back with %d of %d bytes", full.Len(), len(out))
+	}
+
+	if part, _ := read.InvokableRun(context.Background(), fmt.Sprintf(`{"id":%q}`, id)); !strings.Contains(part, "does not exist") {
+		t.Errorf("artifact of acme read without tenant: %q", part)
+	}
+	bob := util.WithUserID(util.WithTenantID(context.Background(), "acme"), "bob")
+	if part, _ := read.InvokableRun(bob, fmt.Sprintf(`{"id":%q}`, id)); !strings.Contains(part, "does not exist") {
+		t.Errorf("artifact of alice read by bob: %q", part)
+	}
+}
+
+func TestOutputProcessorSummarizes(t *testing.T) {
+	out := strings.Repeat("a long search result. ", 500)
+	var input string
+	p := &OutputProcessor{MaxTokens: 100, SummarizeAbove: 1000, Summarizer: func(ctx context.Context, toolName, output string) (string, error) {
+		input = output
+		return "the results are all the same", nil
+	}}
+	if got := p.Process(context.Background(), "search", out); !strings.HasSuffix(got, "\nthe results are all the same") || !strings.HasPrefix(got, "[Summary.") {
+		t.Errorf("summary = %q", got)
+	}
+	if input != out {
+		t.Error("summarizer did not get the output")
+	}
+
+	// 摘要失败时退回截断
+	p.Summarizer = func(ctx context.Context, toolName, output string) (string, error) {
+		return "", errors.New("model unavailable")
+	}
+	if got := p.Process(context.Background(), "search", out); !strings.Contains(got, "tokens omitted") {
+		t.Errorf("not truncated: %q", got)
+	}
+	// 低于摘要阈值的只截断
+	if got := p.Process(context.Background(), "search", out[:1000]); strings.HasPrefix(got, "[Summary.") {
+		t.Errorf("summarized below the threshold: %q", got)
+	}
+}
+
+func TestArtifactStoreEviction(t *testing.T) {
+	store := NewArtifactStore(0, 10)
+	first, _ := store.Put(context.Background(), "open", "123456")
+	second, _ := store.Put(context.Background(), "open", "789012")
+	if _, ok := store.Get(context.Background(), first); ok {
+		t.Error("oldest artifact kept beyond the size limit")
+	}
+	if _, ok := store.Get(context.Background(), second); !ok {
+		t.Error("newest artifact dropped")
+	}
+	if _, ok := store.Put(context.Background(), "open", "01234567890"); ok {
+		t.Error("artifact larger than the store kept")
+	}
+}
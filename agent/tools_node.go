@@ -2,52 +2,437 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/cloudwego/eino-examples/quickstart/eino_assistant/eino/einoagent"
+	"github.com/eino-contrib/jsonschema"
+	rds "github.com/redis/go-redis/v9"
+	"myeino/tool/gorun"
+	"myeino/tool/httptool"
+	"myeino/tool/mcptool"
+	"myeino/tool/registry"
+	"myeino/tool/task"
+	"myeino/tool/workspace"
 
 	"github.com/cloudwego/eino-ext/components/tool/duckduckgo/v2"
 	"github.com/cloudwego/eino/components/tool"
 )
 
-func GetTools(ctx context.Context) ([]tool.BaseTool, error) {
-	einoAssistantTool, err := einoagent.NewEinoAssistantTool(ctx)
-	if err != nil {
+// Tools names the built-in tools, the names are the ones the model sees.
+const (
+	ToolEinoAssistant = "eino_tool"
+	ToolTask          = "task_manager"
+	ToolOpen          = "open"
+	ToolGitClone      = "gitclone"
+	ToolDDGSearch     = "duckduckgo_text_search"
+	ToolGoRun         = gorun.ToolName
+)
+
+var (
+	toolRegistryOnce sync.Once
+	toolRegistry     *registry.Registry
+	toolRegistryErr  error
+)
+
+// ToolRegistry returns the factories of the tools the agent can use, other packages may register more.
+// It is built on first use: the go command is probed and HTTP_TOOLS and MCP_CONFIG_FILE are read.
+func ToolRegistry() (*registry.Registry, error) {
+	toolRegistryOnce.Do(func() {
+		toolRegistry, toolRegistryErr = newToolRegistry()
+	})
+	return toolRegistry, toolRegistryErr
+}
+
+func newToolRegistry() (*registry.Registry, error) {
+	r := registry.New()
+	r.MustRegister(ToolEinoAssistant, func(ctx context.Context, _ json.RawMessage) (tool.BaseTool, error) {
+		return einoagent.NewEinoAssistantTool(ctx)
+	})
+	// 任务工具是一组：add_task、update_task、list_tasks 和 delete_task
+	if err := r.RegisterGroup(ToolTask, func(ctx context.Context, _ json.RawMessage) ([]tool.BaseTool, error) {
+		store, err := getTaskStore()
+		if err != nil {
+			return nil, err
+		}
+		tools, err := task.NewTools(ctx, &task.Config{Store: store})
+		if err != nil {
+			return nil, err
+		}
+		built := make([]tool.BaseTool, 0, len(tools))
+		for _, t := range tools {
+			built = append(built, t)
+		}
+		return built, nil
+	}); err != nil {
+		return nil, err
+	}
+	// 文件和 git 工具限制在每个会话自己的工作目录中
+	r.MustRegister(ToolOpen, func(ctx context.Context, _ json.RawMessage) (tool.BaseTool, error) {
+		ws, err := getWorkspace()
+		if err != nil {
+			return nil, err
+		}
+		return workspace.NewOpenFileTool(ctx, ws)
+	})
+	r.MustRegister(ToolGitClone, func(ctx context.Context, _ json.RawMessage) (tool.BaseTool, error) {
+		ws, err := getWorkspace()
+		if err != nil {
+			return nil, err
+		}
+		return workspace.NewGitCloneFile(ctx, ws)
+	})
+	r.MustRegister(ToolDDGSearch, NewDDGSearch)
+	// 没有 go 命令或不能创建沙箱时不提供运行代码的工具
+	if err := gorun.Available(nil); err != nil {
+		log.Printf("[Tools] Skipping %s: %v", ToolGoRun, err)
+	} else {
+		r.MustRegister(ToolGoRun, NewGoRun)
+		goRunTools = []string{ToolGoRun}
+	}
+	var err error
+	if httpTools, err = registerHTTPTools(r); err != nil {
 		return nil, err
 	}
+	if mcpServers, mcpTools, err = registerMCPServers(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
 
-	toolTask, err := einoagent.NewTaskTool(ctx)
+// goRunTools has run_go_snippet when it can be used, httpTools names the tools loaded from HTTP_TOOLS.
+var (
+	goRunTools []string
+	httpTools  []string
+)
+
+// registerHTTPTools registers the operations of the REST services listed in HTTP_TOOLS, a comma separated
+// list of httptool config files. Use TOOL_POLICIES to confirm the calls that change data.
+func registerHTTPTools(r *registry.Registry) ([]string, error) {
+	var names []string
+	for _, path := range strings.Split(os.Getenv("HTTP_TOOLS"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		config, err := httptool.LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		tools, err := httptool.NewTools(context.Background(), config)
+		if err != nil {
+			return nil, fmt.Errorf("http tools %s: %w", path, err)
+		}
+		for _, t := range tools {
+			info, err := t.Info(context.Background())
+			if err != nil {
+				return nil, fmt.Errorf("http tools %s: %w", path, err)
+			}
+			if err := r.Register(info.Name, func(context.Context, json.RawMessage) (tool.BaseTool, error) {
+				return t, nil
+			}); err != nil {
+				return nil, fmt.Errorf("http tools %s: %w", path, err)
+			}
+			names = append(names, info.Name)
+		}
+		log.Printf("[Tools] Loaded %d http tools from %s", len(tools), path)
+	}
+	return names, nil
+}
+
+// mcpServers connects to the servers of MCP_CONFIG_FILE, mcpTools names their tool groups.
+var (
+	mcpServers *mcptool.Manager
+	mcpTools   []string
+)
+
+// registerMCPServers registers the tools of every server in MCP_CONFIG_FILE as one group named
+// "mcp:<server>". Servers are connected on first use, an unavailable server contributes no tools.
+func registerMCPServers(r *registry.Registry) (*mcptool.Manager, []string, error) {
+	path := os.Getenv("MCP_CONFIG_FILE")
+	if path == "" {
+		return mcptool.NewManager(nil), nil, nil
+	}
+	config, err := mcptool.LoadConfig(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	manager := mcptool.NewManager(config)
+	var names []string
+	for _, server := range manager.Servers() {
+		client := manager.Client(server)
+		name := "mcp:" + server
+		if err := r.RegisterGroup(name, func(ctx context.Context, _ json.RawMessage) ([]tool.BaseTool, error) {
+			tools, err := client.Tools(ctx)
+			if err != nil {
+				// 服务不可用时 agent 照常运行，只是没有这些工具
+				log.Printf("[Tools] Skipping %s: %v", name, err)
+				return nil, nil
+			}
+			return tools, nil
+		}); err != nil {
+			_ = manager.Close()
+			return nil, nil, err
+		}
+		names = append(names, name)
+	}
+	return manager, names, nil
+}
+
+// DefaultToolConfig enables the tools the assistant always had, the HTTP_TOOLS and the MCP servers,
+// web search and run_go_snippet can be enabled per conversation.
+func DefaultToolConfig() *registry.Config {
+	// 可用的工具在构建注册表时确定，构建失败时由 GetTools 返回错误
+	_, _ = ToolRegistry()
+	return &registry.Config{Selection: registry.Selection{
+		Enabled:  slices.Concat([]string{ToolEinoAssistant, ToolTask, ToolOpen, ToolGitClone}, httpTools, mcpTools),
+		Optional: slices.Concat([]string{ToolDDGSearch}, goRunTools),
+	}}
+}
 
-	toolOpen, err := einoagent.NewOpenFileTool(ctx)
+var (
+	toolConfigOnce sync.Once
+	toolConfig     *registry.Config
+)
+
+// ToolConfig returns the tool config read from TOOLS_CONFIG_FILE, or DefaultToolConfig.
+func ToolConfig() *registry.Config {
+	toolConfigOnce.Do(func() {
+		toolConfig = DefaultToolConfig()
+		path := os.Getenv("TOOLS_CONFIG_FILE")
+		if path == "" {
+			return
+		}
+		r, err := ToolRegistry()
+		if err != nil {
+			log.Printf("[Tools] Failed to build tool registry: %v", err)
+			return
+		}
+		config, err := registry.LoadConfig(path)
+		if err == nil {
+			err = config.Validate(r)
+		}
+		if err != nil {
+			log.Printf("[Tools] Failed to load tool config, using defaults: %v", err)
+			return
+		}
+		toolConfig = config
+	})
+	return toolConfig
+}
+
+// GetTools builds the tools enabled for the tenant and conversation of ctx, see registry.WithTools.
+func GetTools(ctx context.Context) ([]tool.BaseTool, error) {
+	r, err := ToolRegistry()
 	if err != nil {
 		return nil, err
 	}
-
-	toolGitClone, err := einoagent.NewGitCloneFile(ctx)
+	config := ToolConfig()
+	tools, err := r.Build(ctx, config, config.EnabledFor(ctx))
 	if err != nil {
 		return nil, err
 	}
+	// 访问外部网络的工具需要用户确认，见 TOOL_POLICIES
+	return WithToolPolicies(ctx, tools, toolPolicies())
+}
 
-	_, err = NewDDGSearch(ctx)
+// ToolDescription describes a tool available to a conversation.
+type ToolDescription struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Parameters  *jsonschema.Schema `json:"parameters,omitempty"`
+	// Group is the name to choose the tool by when it belongs to a group, e.g. "mcp:filesystem".
+	Group string `json:"group,omitempty"`
+	// Enabled reports whether the tool is on when the conversation does not choose its tools.
+	Enabled bool       `json:"enabled"`
+	Policy  ToolPolicy `json:"policy"`
+}
+
+// AvailableTools describes the tools the tenant of ctx may use.
+func AvailableTools(ctx context.Context) ([]*ToolDescription, error) {
+	r, err := ToolRegistry()
 	if err != nil {
 		return nil, err
 	}
-	return []tool.BaseTool{
-		einoAssistantTool,
-		toolTask,
-		toolOpen,
-		toolGitClone,
-		//toolDDGSearch,
-	}, nil
+	config := ToolConfig()
+	available := config.Available(ctx)
+	names := make([]string, 0, len(available))
+	for name := range available {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	policies := toolPolicies()
+	var descriptions []*ToolDescription
+	for _, name := range names {
+		// 一个名字可能对应一组工具，例如一个 MCP 服务的全部工具
+		tools, err := r.Build(ctx, config, []string{name})
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tools {
+			info, err := t.Info(ctx)
+			if err != nil {
+				return nil, err
+			}
+			d := &ToolDescription{
+				Name:        info.Name,
+				Description: info.Desc,
+				Enabled:     available[name],
+				Policy:      PolicyAuto,
+			}
+			if info.Name != name {
+				d.Group = name
+			}
+			if p, ok := policies[info.Name]; ok {
+				d.Policy = p
+			}
+			if info.ParamsOneOf != nil {
+				if d.Parameters, err = info.ParamsOneOf.ToJSONSchema(); err != nil {
+					return nil, fmt.Errorf("tool %s: %w", info.Name, err)
+				}
+			}
+			descriptions = append(descriptions, d)
+		}
+	}
+	return descriptions, nil
+}
+
+// The tools are rebuilt for every agent run, they share the workspace.
+var (
+	workspaceOnce   sync.Once
+	sharedWorkspace *workspace.Workspace
+	workspaceErr    error
+)
+
+// getWorkspace configures the workspace from WORKSPACE_ROOT (default data/workspace), WORKSPACE_MAX_FILE_BYTES,
+// WORKSPACE_MAX_REPO_BYTES, WORKSPACE_CLONE_TIMEOUT and WORKSPACE_TTL (default 168h, conversation directories
+// unused for that long are removed, a negative duration keeps them).
+func getWorkspace() (*workspace.Workspace, error) {
+	workspaceOnce.Do(func() {
+		config := &workspace.Config{Root: os.Getenv("WORKSPACE_ROOT")}
+		if v, err := strconv.ParseInt(os.Getenv("WORKSPACE_MAX_FILE_BYTES"), 10, 64); err == nil {
+			config.MaxFileBytes = v
+		}
+		if v, err := strconv.ParseInt(os.Getenv("WORKSPACE_MAX_REPO_BYTES"), 10, 64); err == nil {
+			config.MaxRepoBytes = v
+		}
+		if d, err := time.ParseDuration(os.Getenv("WORKSPACE_CLONE_TIMEOUT")); err == nil {
+			config.CloneTimeout = d
+		}
+		if d, err := time.ParseDuration(os.Getenv("WORKSPACE_TTL")); err == nil {
+			config.TTL = d
+		}
+		sharedWorkspace, workspaceErr = workspace.New(config)
+	})
+	return sharedWorkspace, workspaceErr
+}
+
+// RemoveWorkspace deletes the workspace directory of the conversation of ctx.
+func RemoveWorkspace(ctx context.Context) error {
+	ws, err := getWorkspace()
+	if err != nil {
+		return err
+	}
+	return ws.Remove(ctx)
+}
+
+var (
+	taskStoreOnce sync.Once
+	taskStore     task.Store
+	taskClient    *rds.Client
+	taskStoreErr  error
+)
+
+// getTaskStore configures the task store: TASK_STORE=redis keeps tasks in Redis at TASK_REDIS_ADDR
+// (default localhost:6479), otherwise they are kept in TASK_DIR/tasks.jsonl (default data/task).
+func getTaskStore() (task.Store, error) {
+	taskStoreOnce.Do(func() {
+		if os.Getenv("TASK_STORE") == "redis" {
+			addr := os.Getenv("TASK_REDIS_ADDR")
+			if addr == "" {
+				addr = "localhost:6479"
+			}
+			taskClient = rds.NewClient(&rds.Options{
+				Addr:     addr,
+				Protocol: 2,
+			})
+			taskStore = task.NewRedisStore(taskClient, "")
+			return
+		}
+		dir := os.Getenv("TASK_DIR")
+		if dir == "" {
+			dir = "data/task"
+		}
+		taskStore, taskStoreErr = task.NewFileStore(dir)
+	})
+	return taskStore, taskStoreErr
+}
+
+// ddgSettings are the settings of the duckduckgo_text_search tool.
+type ddgSettings struct {
+	MaxResults int    `json:"max_results"`
+	Region     string `json:"region"`
+	// Timeout of a search, e.g. "10s".
+	Timeout string `json:"timeout"`
 }
 
-func NewDDGSearch(ctx context.Context) (bt tool.BaseTool, err error) {
-	// TODO Modify component configuration here.
+func NewDDGSearch(ctx context.Context, raw json.RawMessage) (bt tool.BaseTool, err error) {
 	config := &duckduckgo.Config{}
+	if len(raw) > 0 {
+		var settings ddgSettings
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return nil, fmt.Errorf("invalid settings: %w", err)
+		}
+		config.MaxResults = settings.MaxResults
+		config.Region = duckduckgo.Region(settings.Region)
+		if settings.Timeout != "" {
+			if config.Timeout, err = time.ParseDuration(settings.Timeout); err != nil {
+				return nil, fmt.Errorf("invalid timeout: %w", err)
+			}
+		}
+	}
 	bt, err = duckduckgo.NewTextSearchTool(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 	return bt, nil
 }
+
+// goRunSettings are the settings of the run_go_snippet tool.
+type goRunSettings struct {
+	// RunTimeout of a program, e.g. "10s".
+	RunTimeout string `json:"run_timeout"`
+	MemoryMB   int    `json:"memory_mb"`
+}
+
+// NewGoRun creates run_go_snippet, the programs may import the modules of GO_SNIPPET_MODFILE
+// (default go.mod, the modules of this project).
+func NewGoRun(ctx context.Context, raw json.RawMessage) (tool.BaseTool, error) {
+	config := &gorun.Config{ModFile: os.Getenv("GO_SNIPPET_MODFILE")}
+	if config.ModFile == "" {
+		config.ModFile = "go.mod"
+	}
+	if len(raw) > 0 {
+		var settings goRunSettings
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return nil, fmt.Errorf("invalid settings: %w", err)
+		}
+		config.MemoryMB = settings.MemoryMB
+		if settings.RunTimeout != "" {
+			d, err := time.ParseDuration(settings.RunTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid run_timeout: %w", err)
+			}
+			config.RunTimeout = d
+		}
+	}
+	return gorun.NewTool(ctx, config)
+}
@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDefaultToolConfig(t *testing.T) {
+	tools, err := ToolRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DefaultToolConfig().Validate(tools); err != nil {
+		t.Fatal(err)
+	}
+	if config := DefaultToolConfig(); slices.Contains(config.Enabled, ToolGoRun) {
+		t.Errorf("%s enabled by default", ToolGoRun)
+	}
+	for name := range DefaultToolPolicies() {
+		// 没有 go 命令或沙箱时不注册 run_go_snippet
+		if name == ToolGoRun && len(goRunTools) == 0 {
+			continue
+		}
+		if !slices.Contains(tools.Names(), name) {
+			t.Errorf("policy for unknown tool %s", name)
+		}
+	}
+}
@@ -3,73 +3,297 @@ package agent
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/cloudwego/eino-examples/quickstart/eino_assistant/pkg/mem"
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
 	"io"
+	"log"
 	"myeino/agent"
+	"myeino/telemetry"
+	"myeino/usage"
+	"myeino/util"
+	"os"
+	"sync"
 )
 
 var memory = mem.GetDefaultMemory()
 
-func RunAgent(ctx context.Context, id string, msg string) (*schema.StreamReader[*schema.Message], error) {
-	runner, err := agent.BuildEinoAgent(ctx)
-	if err != nil {
-		return nil, err
+var metrics = telemetry.DefaultMetrics()
+
+var (
+	cacheOnce     sync.Once
+	semanticCache *agent.SemanticCache
+)
+
+// cachedChunkRunes controls how a cached answer is split into stream chunks,
+// so that clients still receive it incrementally over SSE.
+const cachedChunkRunes = 32
+
+// getSemanticCache returns the semantic response cache, or nil when it is disabled.
+// Set EINO_SEMANTIC_CACHE=true to enable it.
+func getSemanticCache() *agent.SemanticCache {
+	cacheOnce.Do(func() {
+		if os.Getenv("EINO_SEMANTIC_CACHE") != "true" {
+			return
+		}
+		c, err := agent.NewSemanticCache(context.Background(), nil)
+		if err != nil {
+			log.Printf("[SemanticCache] Disabled, failed to create cache: %v", err)
+			return
+		}
+		semanticCache = c
+		registerCloser(c)
+	})
+	return semanticCache
+}
+
+// ErrClientDisconnected interrupts a chat whose client went away before the answer was complete.
+var ErrClientDisconnected = errors.New("client disconnected")
+
+// Keys of Message.Extra marking an answer that was cut off before the model finished.
+const (
+	ExtraInterrupted     = "interrupted"
+	ExtraInterruptReason = "interrupt_reason"
+)
+
+// answerPipeCapacity buffers chunks between the recorder and the client writer.
+const answerPipeCapacity = 16
+
+// buildAgent builds the graph answering chats, tests replace it with a fake model.
+var buildAgent = agent.BuildEinoAgent
+
+// AgentRun is an answer being streamed by the agent.
+type AgentRun struct {
+	// Stream delivers the answer chunks, the caller must close it.
+	Stream *schema.StreamReader[*schema.Message]
+
+	interrupt context.CancelCauseFunc
+	recorded  chan struct{}
+	err       error
+}
+
+// Interrupt cancels the model stream and the running tools. The answer received so far is stored
+// with an interrupted marker. It has no effect once the answer has been fully received.
+func (r *AgentRun) Interrupt(cause error) {
+	r.interrupt(cause)
+}
+
+// Recorded is closed once the turn has been appended to the conversation history.
+func (r *AgentRun) Recorded() <-chan struct{} {
+	return r.recorded
+}
+
+// Err returns the cause that cut the answer off, nil when it is complete.
+// It must only be called once Recorded is closed.
+func (r *AgentRun) Err() error {
+	return r.err
+}
+
+func RunAgent(ctx context.Context, id string, msg string) (*AgentRun, error) {
+	ctx = conversationTools.apply(ctx, conversationKey(ctx, id))
+	conversation := memory.GetConversation(conversationKey(ctx, id), true)
+	metrics.ObserveMemoryOp("get_conversation")
+	history := conversation.GetMessages()
+
+	// The graph runs detached from the request ctx and only stops when interrupted, so that a request
+	// ctx cancelled right after the last chunk cannot turn a complete answer into an interrupted one.
+	runCtx, interrupt := context.WithCancelCause(context.WithoutCancel(ctx))
+
+	// Only the first turn of a conversation is cached, later turns depend on the history.
+	cache := getSemanticCache()
+	if len(history) > 0 {
+		cache = nil
 	}
 
-	conversation := memory.GetConversation(id, true)
+	var sr *schema.StreamReader[*schema.Message]
+	if cache != nil {
+		entry, err := cache.Lookup(runCtx, msg)
+		if err != nil {
+			log.Printf("[SemanticCache] Lookup failed, falling back to agent: %v", err)
+		} else if entry != nil {
+			log.Printf("[SemanticCache] Hit for chat ID: %s, score=%.4f, cached query: %s", id, entry.Score, entry.Query)
+			sr = cachedAnswerStream(entry.Answer)
+			cache = nil
+		}
+	}
 
 	userMessage := &agent.UserMessage{
 		ID:      id,
 		Query:   msg,
-		History: conversation.GetMessages(),
+		History: history,
 	}
-
-	sr, err := runner.Stream(ctx, userMessage, compose.WithCallbacks())
-	if err != nil {
-		return nil, err
+	// 运行在需要用户确认的工具调用处暂停时，从检查点恢复
+	checkPointID := util.NewRequestID()
+	var approvals []*agent.ApprovalRequest
+	// 用过工具的答案可能依赖用户或会话的数据，不缓存
+	toolCalls := &agent.ToolCallRecorder{}
+	if sr == nil {
+		var err error
+		sr, err = streamAgent(runCtx, userMessage, compose.WithCheckPointID(checkPointID), compose.WithCallbacks(toolCalls.Handler()))
+		if requests, paused := agent.ApprovalRequests(err); paused {
+			approvals, err = requests, nil
+		}
+		if err != nil {
+			checkPoints.Delete(checkPointID)
+			interrupt(err)
+			return nil, err
+		}
 	}
 
-	srs := sr.Copy(2)
+	out, w := schema.Pipe[*schema.Message](answerPipeCapacity)
+	run := &AgentRun{Stream: out, interrupt: interrupt, recorded: make(chan struct{})}
 
+	chats.recorders.Add(1)
 	go func() {
-		fullMsgs := make([]*schema.Message, 0)
-
-		defer func() {
-			// close stream
-			srs[1].Close()
+		defer chats.recorders.Done()
+		defer close(run.recorded)
+		// release the run ctx, the answer is complete or already cut off
+		defer interrupt(nil)
+		defer checkPoints.Delete(checkPointID)
 
-			// add history
-			conversation.Append(schema.UserMessage(msg))
+		var cause error
+		if len(approvals) > 0 {
+			sr, cause = resolveApprovals(runCtx, conversationKey(ctx, id), userMessage, checkPointID, approvals, w)
+		}
+		var chunks []*schema.Message
+		if cause == nil {
+			chunks, cause = forwardAnswer(runCtx, sr, w)
+		} else {
+			w.Close()
+		}
+		run.err = cause
+		fullMsg := recordAnswer(conversation, msg, chunks, cause)
+		if cause != nil {
+			log.Printf("[Chat] Answer interrupted for chat ID: %s after %d chunks: %v", id, len(chunks), cause)
+			return
+		}
 
-			fullMsg, err := schema.ConcatMessages(fullMsgs)
-			if err != nil {
-				fmt.Println(err)
+		if names := toolCalls.Names(); cache != nil && len(names) > 0 {
+			log.Printf("[SemanticCache] Not caching answer for chat ID: %s, it used tools %v", id, names)
+		} else if cache != nil && fullMsg != nil {
+			if err := cache.Store(context.WithoutCancel(ctx), msg, fullMsg.Content); err != nil {
+				log.Printf("[SemanticCache] Failed to store answer for chat ID: %s: %v", id, err)
 			}
+		}
+	}()
+
+	return run, nil
+}
+
+// streamAgent runs the agent graph with the registered callbacks and usage recording, plus opts.
+func streamAgent(ctx context.Context, userMessage *agent.UserMessage, opts ...compose.Option) (*schema.StreamReader[*schema.Message], error) {
+	runner, err := buildAgent(ctx, compose.WithCheckPointStore(checkPoints))
+	if err != nil {
+		return nil, err
+	}
 
-			conversation.Append(fullMsg)
-		}()
+	handlers := registeredCallbacks()
+	if usageStore != nil {
+		handlers = append(handlers, usage.NewRecorder(usageStore))
+	}
+	opts = append([]compose.Option{compose.WithCallbacks(handlers...)}, opts...)
+	return runner.Stream(ctx, userMessage, opts...)
+}
 
-	outer:
+type streamItem struct {
+	chunk *schema.Message
+	err   error
+}
+
+// pumpStream receives from sr in its own goroutine so that the caller can stop waiting on a stalled
+// stream. The goroutine owns sr and closes it on EOF, on error or once stop is closed; after an
+// interruption it exits as soon as the cancelled model or tool ends the stream.
+func pumpStream(sr *schema.StreamReader[*schema.Message], stop <-chan struct{}) <-chan streamItem {
+	items := make(chan streamItem)
+	go func() {
+		defer sr.Close()
 		for {
+			chunk, err := sr.Recv()
 			select {
-			case <-ctx.Done():
-				fmt.Println("context done", ctx.Err())
+			case items <- streamItem{chunk: chunk, err: err}:
+			case <-stop:
+				return
+			}
+			if err != nil {
 				return
-			default:
-				chunk, err := srs[1].Recv()
-				if err != nil {
-					if errors.Is(err, io.EOF) {
-						break outer
-					}
-				}
-
-				fullMsgs = append(fullMsgs, chunk)
 			}
 		}
 	}()
+	return items
+}
+
+// forwardAnswer copies sr to w until EOF and returns the chunks received. It returns early when ctx
+// is cancelled, the stream fails or the reader of w is closed, the error is then the interruption cause.
+// w is closed on return.
+func forwardAnswer(ctx context.Context, sr *schema.StreamReader[*schema.Message], w *schema.StreamWriter[*schema.Message]) ([]*schema.Message, error) {
+	defer w.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	items := pumpStream(sr, stop)
 
-	return srs[0], nil
+	var chunks []*schema.Message
+	for {
+		select {
+		case <-ctx.Done():
+			return chunks, context.Cause(ctx)
+		case item := <-items:
+			if errors.Is(item.err, io.EOF) {
+				return chunks, nil
+			}
+			if item.err != nil {
+				w.Send(nil, item.err)
+				return chunks, item.err
+			}
+			if item.chunk == nil {
+				continue
+			}
+			chunks = append(chunks, item.chunk)
+			if closed := w.Send(item.chunk, nil); closed {
+				return chunks, ErrClientDisconnected
+			}
+		}
+	}
+}
+
+// recordAnswer appends the turn to the conversation and returns the stored answer. An answer cut off
+// by cause keeps the content received so far and is marked with ExtraInterrupted; nothing but the
+// question is stored when no content arrived.
+func recordAnswer(conversation *mem.Conversation, query string, chunks []*schema.Message, cause error) *schema.Message {
+	conversation.Append(schema.UserMessage(query))
+	metrics.ObserveMemoryOp("append")
+
+	if len(chunks) == 0 {
+		return nil
+	}
+	fullMsg, err := schema.ConcatMessages(chunks)
+	if err != nil {
+		log.Printf("[Chat] Failed to concat answer chunks: %v", err)
+		return nil
+	}
+
+	if cause != nil {
+		extra := make(map[string]any, len(fullMsg.Extra)+2)
+		for k, v := range fullMsg.Extra {
+			extra[k] = v
+		}
+		extra[ExtraInterrupted] = true
+		extra[ExtraInterruptReason] = cause.Error()
+		fullMsg.Extra = extra
+	}
+
+	conversation.Append(fullMsg)
+	metrics.ObserveMemoryOp("append")
+	return fullMsg
+}
+
+// cachedAnswerStream replays a cached answer as a stream of assistant message chunks.
+func cachedAnswerStream(answer string) *schema.StreamReader[*schema.Message] {
+	runes := []rune(answer)
+	chunks := make([]*schema.Message, 0, len(runes)/cachedChunkRunes+1)
+	for start := 0; start < len(runes); start += cachedChunkRunes {
+		end := min(start+cachedChunkRunes, len(runes))
+		chunks = append(chunks, schema.AssistantMessage(string(runes[start:end]), nil))
+	}
+	return schema.StreamReaderFromArray(chunks)
 }
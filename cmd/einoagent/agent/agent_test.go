@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+	"myeino/agent"
+	"myeino/util"
+)
+
+// streamingModel streams chunks, then fails with err, waits for cancellation when block is set,
+// or keeps streaming until cancelled when endless is set. usage is reported on the last chunk.
+type streamingModel struct {
+	chunks    []string
+	usage     *schema.TokenUsage
+	err       error
+	block     bool
+	endless   bool
+	cancelled chan struct{}
+	once      sync.Once
+}
+
+func newStreamingModel(chunks ...string) *streamingModel {
+	return &streamingModel{chunks: chunks, cancelled: make(chan struct{})}
+}
+
+func (m *streamingModel) Generate(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	return schema.AssistantMessage(strings.Join(m.chunks, ""), nil), nil
+}
+
+func (m *streamingModel) Stream(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	sr, sw := schema.Pipe[*schema.Message](0)
+	go func() {
+		defer sw.Close()
+		for i, c := range m.chunks {
+			msg := schema.AssistantMessage(c, nil)
+			if i == len(m.chunks)-1 && m.usage != nil {
+				msg.ResponseMeta = &schema.ResponseMeta{Usage: m.usage}
+			}
+			if closed := sw.Send(msg, nil); closed {
+				return
+			}
+		}
+		switch {
+		case m.err != nil:
+			sw.Send(nil, m.err)
+		case m.block:
+			<-ctx.Done()
+			m.once.Do(func() { close(m.cancelled) })
+			sw.Send(nil, ctx.Err())
+		case m.endless:
+			for ctx.Err() == nil {
+				sw.Send(schema.AssistantMessage(".", nil), nil)
+			}
+			m.once.Do(func() { close(m.cancelled) })
+		}
+	}()
+	return sr, nil
+}
+
+func (m *streamingModel) BindTools(tools []*schema.ToolInfo) error { return nil }
+
+// useModel makes RunAgent answer with m instead of the real agent.
+func useModel(t *testing.T, m model.ChatModel) {
+	t.Helper()
+	orig := buildAgent
+	// 每个请求编译自己的图，同一个图不能并发编译
+	buildAgent = func(ctx context.Context, opts ...compose.GraphCompileOption) (compose.Runnable[*agent.UserMessage, *schema.Message], error) {
+		g := compose.NewGraph[*agent.UserMessage, *schema.Message]()
+		_ = g.AddLambdaNode("ToMessages", compose.InvokableLambda(func(ctx context.Context, in *agent.UserMessage) ([]*schema.Message, error) {
+			return append(in.History, schema.UserMessage(in.Query)), nil
+		}))
+		_ = g.AddChatModelNode("ChatModel", m)
+		_ = g.AddEdge(compose.START, "ToMessages")
+		_ = g.AddEdge("ToMessages", "ChatModel")
+		_ = g.AddEdge("ChatModel", compose.END)
+		return g.Compile(ctx, opts...)
+	}
+	t.Cleanup(func() {
+		// 等待仍在读取 buildAgent 的请求结束
+		chats.streams.Wait()
+		chats.recorders.Wait()
+		buildAgent = orig
+	})
+}
+
+func waitClosed(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+// newConversationID keeps tests independent of each other, the memory is shared by the package.
+func newConversationID(t *testing.T) string {
+	return t.Name() + "-" + util.NewRequestID()
+}
+
+func history(t *testing.T, id string) []*schema.Message {
+	t.Helper()
+	return memory.GetConversation(id, false).GetFullMessages()
+}
+
+func TestRunAgentRecordsCompleteAnswer(t *testing.T) {
+	useModel(t, newStreamingModel("Hello", " world"))
+
+	id := newConversationID(t)
+	run, err := RunAgent(context.Background(), id, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer run.Stream.Close()
+
+	var answer strings.Builder
+	for {
+		chunk, err := run.Stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer.WriteString(chunk.Content)
+	}
+	// The client has seen EOF, interrupting now must not mark the answer.
+	run.Interrupt(ErrClientDisconnected)
+	waitClosed(t, run.Recorded(), "history")
+
+	if answer.String() != "Hello world" {
+		t.Errorf("streamed answer = %q", answer.String())
+	}
+	msgs := history(t, id)
+	if len(msgs) != 2 || msgs[0].Content != "hi" || msgs[1].Content != "Hello world" {
+		t.Fatalf("unexpected history: %v", msgs)
+	}
+	if _, ok := msgs[1].Extra[ExtraInterrupted]; ok {
+		t.Errorf("complete answer marked as interrupted: %v", msgs[1].Extra)
+	}
+}
+
+func TestRunAgentInterruptCancelsModel(t *testing.T) {
+	m := newStreamingModel("Partial")
+	m.block = true
+	useModel(t, m)
+
+	id := newConversationID(t)
+	run, err := RunAgent(context.Background(), id, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer run.Stream.Close()
+
+	if chunk, err := run.Stream.Recv(); err != nil || chunk.Content != "Partial" {
+		t.Fatalf("first chunk = %v, %v", chunk, err)
+	}
+	run.Interrupt(ErrClientDisconnected)
+
+	waitClosed(t, m.cancelled, "model cancellation")
+	waitClosed(t, run.Recorded(), "history")
+
+	msgs := history(t, id)
+	if len(msgs) != 2 || msgs[1].Content != "Partial" {
+		t.Fatalf("unexpected history: %v", msgs)
+	}
+	if msgs[1].Extra[ExtraInterrupted] != true || msgs[1].Extra[ExtraInterruptReason] != ErrClientDisconnected.Error() {
+		t.Errorf("missing interrupted marker: %v", msgs[1].Extra)
+	}
+}
+
+func TestRunAgentStopsWhenStreamClosed(t *testing.T) {
+	m := newStreamingModel("A")
+	m.endless = true
+	useModel(t, m)
+
+	id := newConversationID(t)
+	run, err := RunAgent(context.Background(), id, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run.Stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	run.Stream.Close()
+
+	waitClosed(t, run.Recorded(), "history")
+	waitClosed(t, m.cancelled, "model cancellation")
+
+	msgs := history(t, id)
+	if len(msgs) != 2 || !strings.HasPrefix(msgs[1].Content, "A") || msgs[1].Extra[ExtraInterrupted] != true {
+		t.Fatalf("unexpected history: %v", msgs)
+	}
+}
+
+func TestRunAgentStreamError(t *testing.T) {
+	m := newStreamingModel("Par")
+	m.err = errors.New("upstream reset")
+	useModel(t, m)
+
+	id := newConversationID(t)
+	run, err := RunAgent(context.Background(), id, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer run.Stream.Close()
+
+	if _, err := run.Stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run.Stream.Recv(); err == nil || !strings.Contains(err.Error(), "upstream reset") {
+		t.Fatalf("expected the stream error, got %v", err)
+	}
+	waitClosed(t, run.Recorded(), "history")
+
+	msgs := history(t, id)
+	if len(msgs) != 2 || msgs[1].Content != "Par" || msgs[1].Extra[ExtraInterrupted] != true {
+		t.Fatalf("unexpected history: %v", msgs)
+	}
+	if reason, _ := msgs[1].Extra[ExtraInterruptReason].(string); !strings.Contains(reason, "upstream reset") {
+		t.Errorf("interrupt reason = %q", reason)
+	}
+}
+
+func TestInterruptCause(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrShuttingDown)
+	if err := interruptCause(ctx); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("shutdown cause = %v", err)
+	}
+
+	ctx, cancelReq := context.WithCancel(context.Background())
+	cancelReq()
+	if err := interruptCause(ctx); !errors.Is(err, ErrClientDisconnected) {
+		t.Errorf("disconnect cause = %v", err)
+	}
+}
+
+func TestDeleteChat(t *testing.T) {
+	id := newConversationID(t)
+	memory.GetConversation(id, true).Append(schema.UserMessage("hi"))
+
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.DELETE("/chat", HandleDeleteChat)
+	del := func(id string) int {
+		return ut.PerformRequest(engine, consts.MethodDelete, "/chat?id="+url.QueryEscape(id), nil).Code
+	}
+	if code := del(id); code != consts.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if msgs := history(t, id); len(msgs) != 0 {
+		t.Errorf("history still has %d messages", len(msgs))
+	}
+	if code := del(id); code != consts.StatusNotFound {
+		t.Errorf("second delete status = %d", code)
+	}
+	if code := del("../usage/x"); code != consts.StatusBadRequest {
+		t.Errorf("path id status = %d", code)
+	}
+}
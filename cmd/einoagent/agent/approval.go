@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"myeino/agent"
+	"myeino/middleware"
+	"myeino/util"
+)
+
+// approvalEvent is the SSE event asking the user to approve a tool call, its data is an ApprovalEvent.
+const approvalEvent = "approval"
+
+// extraApproval marks the answer chunk carrying an ApprovalEvent instead of text.
+const extraApproval = "approval_request"
+
+// ApprovalEvent asks the user to approve or reject a tool call. The reply names RequestID, see
+// HandleReply and the approve and deny messages of the WebSocket endpoint.
+type ApprovalEvent struct {
+	RequestID string `json:"request_id"`
+	Tool      string `json:"tool"`
+	Arguments string `json:"arguments"`
+}
+
+// checkPoints keeps the state of the runs paused for approval.
+var checkPoints = agent.NewMemoryCheckPointStore()
+
+var approvalTimeout = newApprovalTimeout()
+
+// newApprovalTimeout reads APPROVAL_TIMEOUT (default 5m), a call left unanswered is rejected after it.
+func newApprovalTimeout() time.Duration {
+	if d, ok := durationEnv("APPROVAL_TIMEOUT"); ok && d > 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// resolveApprovals asks the user about the tool calls the run is paused on and resumes the run with
+// the answers, until it streams its answer. The questions are sent to w as approval chunks.
+func resolveApprovals(ctx context.Context, convKey string, userMessage *agent.UserMessage, checkPointID string,
+	requests []*agent.ApprovalRequest, w *schema.StreamWriter[*schema.Message]) (*schema.StreamReader[*schema.Message], error) {
+	decisions := map[string]agent.ToolDecision{}
+	for {
+		for _, req := range requests {
+			d, err := askApproval(ctx, convKey, req, w)
+			if err != nil {
+				return nil, err
+			}
+			decisions[req.ToolCallID] = d
+		}
+
+		sr, err := streamAgent(agent.WithToolDecisions(ctx, decisions), userMessage, compose.WithCheckPointID(checkPointID))
+		var paused bool
+		if requests, paused = agent.ApprovalRequests(err); !paused {
+			return sr, err
+		}
+	}
+}
+
+// askApproval publishes req and waits for the reply of the user.
+func askApproval(ctx context.Context, convKey string, req *agent.ApprovalRequest, w *schema.StreamWriter[*schema.Message]) (agent.ToolDecision, error) {
+	requestID := util.NewRequestID()
+	replies := make(chan Reply, 1)
+	interactions.register(convKey, requestID, false, func(ctx context.Context, r Reply) error {
+		replies <- r
+		return nil
+	})
+	defer interactions.cancel(convKey, requestID)
+
+	ev := &ApprovalEvent{RequestID: requestID, Tool: req.Tool, Arguments: req.Arguments}
+	msg := &schema.Message{Role: schema.Assistant, Extra: map[string]any{extraApproval: ev}}
+	if closed := w.Send(msg, nil); closed {
+		return agent.ToolDecision{}, ErrClientDisconnected
+	}
+	log.Printf("[Approval] Waiting for approval of %s, request ID: %s", req.Tool, requestID)
+
+	timer := time.NewTimer(approvalTimeout)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return agent.ToolDecision{}, context.Cause(ctx)
+	case r := <-replies:
+		log.Printf("[Approval] Call of %s approved: %v, request ID: %s", req.Tool, r.Approved, requestID)
+		return agent.ToolDecision{Approved: r.Approved, Reason: r.Reason}, nil
+	case <-timer.C:
+		log.Printf("[Approval] No reply for the call of %s, rejecting it, request ID: %s", req.Tool, requestID)
+		return agent.ToolDecision{Reason: "the user did not answer in time"}, nil
+	}
+}
+
+// approvalOf returns the approval request carried by chunk, if any.
+func approvalOf(chunk *schema.Message) (*ApprovalEvent, bool) {
+	if chunk == nil {
+		return nil, false
+	}
+	ev, ok := chunk.Extra[extraApproval].(*ApprovalEvent)
+	return ev, ok
+}
+
+type replyRequest struct {
+	ID        string `json:"id"`
+	RequestID string `json:"request_id"`
+	Reply
+}
+
+// HandleReply delivers the answer of an SSE client to an approval or input request of its chat.
+// Body: {"id": conversation, "request_id": ..., "approved": true|false, "input": ..., "reason": ...}.
+func HandleReply(ctx context.Context, c *app.RequestContext) {
+	var req replyRequest
+	if err := json.Unmarshal(c.Request.Body(), &req); err != nil || req.ID == "" || req.RequestID == "" {
+		c.JSON(consts.StatusBadRequest, map[string]string{
+			"status": "error",
+			"error":  "missing id or request_id",
+		})
+		return
+	}
+	if userID := string(c.GetHeader("X-User-ID")); userID != "" && middleware.PrincipalFromContext(ctx) == nil {
+		ctx = util.WithUserID(ctx, userID)
+	}
+
+	err := interactions.resolve(ctx, conversationKey(ctx, req.ID), req.RequestID, req.Reply)
+	switch {
+	case errors.Is(err, ErrInputNotExpected):
+		c.JSON(consts.StatusBadRequest, map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+	case errors.Is(err, ErrNoPendingRequest):
+		c.JSON(consts.StatusNotFound, map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+	case err != nil:
+		c.JSON(consts.StatusInternalServerError, map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+	default:
+		c.JSON(consts.StatusOK, map[string]string{"status": "ok"})
+	}
+}
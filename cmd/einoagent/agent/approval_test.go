@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/flow/agent/react"
+	"github.com/cloudwego/eino/schema"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+	"myeino/agent"
+)
+
+// openToolModel asks to open a page, then answers with the tool result.
+type openToolModel struct{}
+
+func (m *openToolModel) reply(in []*schema.Message) *schema.Message {
+	if last := in[len(in)-1]; last.Role == schema.Tool {
+		return schema.AssistantMessage("Tool said: "+last.Content, nil)
+	}
+	return schema.AssistantMessage("", []schema.ToolCall{{
+		ID:       "call-open",
+		Function: schema.FunctionCall{Name: "open", Arguments: `{"uri":"https://example.com"}`},
+	}})
+}
+
+func (m *openToolModel) Generate(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	return m.reply(in), nil
+}
+
+func (m *openToolModel) Stream(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return schema.StreamReaderFromArray([]*schema.Message{m.reply(in)}), nil
+}
+
+func (m *openToolModel) BindTools(tools []*schema.ToolInfo) error { return nil }
+
+// useConfirmedTool makes RunAgent call an "open" tool needing approval, it returns the number of calls.
+func useConfirmedTool(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	calls := &atomic.Int32{}
+	orig := buildAgent
+	buildAgent = func(ctx context.Context, opts ...compose.GraphCompileOption) (compose.Runnable[*agent.UserMessage, *schema.Message], error) {
+		open, err := utils.InferTool("open", "open a uri", func(ctx context.Context, req map[string]any) (string, error) {
+			calls.Add(1)
+			return "opened", nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		tools, err := agent.WithToolPolicies(ctx, []tool.BaseTool{open}, map[string]agent.ToolPolicy{"open": agent.PolicyConfirm})
+		if err != nil {
+			return nil, err
+		}
+		config := &react.AgentConfig{Model: &openToolModel{}}
+		config.ToolsConfig.Tools = tools
+		ra, err := react.NewAgent(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		lba, err := compose.AnyLambda(ra.Generate, ra.Stream, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		g := compose.NewGraph[*agent.UserMessage, *schema.Message]()
+		_ = g.AddLambdaNode("ToMessages", compose.InvokableLambda(func(ctx context.Context, in *agent.UserMessage) ([]*schema.Message, error) {
+			return append(in.History, schema.UserMessage(in.Query)), nil
+		}))
+		_ = g.AddLambdaNode("ReactAgent", lba)
+		_ = g.AddEdge(compose.START, "ToMessages")
+		_ = g.AddEdge("ToMessages", "ReactAgent")
+		_ = g.AddEdge("ReactAgent", compose.END)
+		return g.Compile(ctx, opts...)
+	}
+	t.Cleanup(func() { buildAgent = orig })
+	return calls
+}
+
+func TestChatWSApproval(t *testing.T) {
+	calls := useConfirmedTool(t)
+	conn := dialWS(t, startWSServer(t))
+
+	id := newConversationID(t)
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsChat, ID: id, Message: "open example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := readEvent(t, conn); ev.Type != "started" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	ev := readEvent(t, conn)
+	if ev.Type != approvalEvent {
+		t.Fatalf("expected an approval request, got %+v", ev)
+	}
+	var req ApprovalEvent
+	if err := json.Unmarshal([]byte(ev.Data), &req); err != nil || req.Tool != "open" || req.RequestID != ev.RequestID {
+		t.Fatalf("unexpected approval request %q: %v", ev.Data, err)
+	}
+	if calls.Load() != 0 {
+		t.Fatal("tool ran before approval")
+	}
+
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsApprove, ID: id, RequestID: req.RequestID}); err != nil {
+		t.Fatal(err)
+	}
+	var text string
+	for {
+		ev := readEvent(t, conn)
+		if ev.Type == doneEvent {
+			if ev.Data != "complete" {
+				t.Errorf("turn ended with %q", ev.Data)
+			}
+			break
+		}
+		text += ev.Data
+	}
+	if text != "Tool said: opened" || calls.Load() != 1 {
+		t.Errorf("answer = %q after %d calls", text, calls.Load())
+	}
+}
+
+func TestHandleReplyRejectsToolCall(t *testing.T) {
+	calls := useConfirmedTool(t)
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.POST("/reply", HandleReply)
+	reply := func(body string) int {
+		return ut.PerformRequest(engine, consts.MethodPost, "/reply", &ut.Body{Body: strings.NewReader(body), Len: len(body)}).Code
+	}
+
+	id := newConversationID(t)
+	run, err := RunAgent(context.Background(), id, "open example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer run.Stream.Close()
+
+	chunk, err := run.Stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, ok := approvalOf(chunk)
+	if !ok {
+		t.Fatalf("expected an approval request, got %v", chunk)
+	}
+
+	if code := reply(`{"id":"` + id + `","request_id":"unknown","approved":true}`); code != consts.StatusNotFound {
+		t.Errorf("reply to an unknown request: status %d", code)
+	}
+	if code := reply(`{"id":"` + id + `"}`); code != consts.StatusBadRequest {
+		t.Errorf("reply without request_id: status %d", code)
+	}
+	if code := reply(`{"id":"` + id + `","request_id":"` + req.RequestID + `","approved":false,"reason":"no"}`); code != consts.StatusOK {
+		t.Fatalf("reply: status %d", code)
+	}
+
+	var answer strings.Builder
+	for {
+		chunk, err := run.Stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer.WriteString(chunk.Content)
+	}
+	if !strings.Contains(answer.String(), "The user rejected the call of open. Reason: no") || calls.Load() != 0 {
+		t.Errorf("answer = %q after %d calls", answer.String(), calls.Load())
+	}
+
+	waitClosed(t, run.Recorded(), "history")
+	if msgs := history(t, id); len(msgs) != 2 || run.Err() != nil {
+		t.Errorf("unexpected history %v, err %v", msgs, run.Err())
+	}
+}
+
+func TestApprovalInterruptedWhileWaiting(t *testing.T) {
+	useConfirmedTool(t)
+	id := newConversationID(t)
+	run, err := RunAgent(context.Background(), id, "open example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer run.Stream.Close()
+	if chunk, err := run.Stream.Recv(); err != nil || chunk.Extra[extraApproval] == nil {
+		t.Fatalf("expected an approval request, got %v, %v", chunk, err)
+	}
+
+	run.Interrupt(ErrCanceledByUser)
+	waitClosed(t, run.Recorded(), "history")
+	if !errors.Is(run.Err(), ErrCanceledByUser) {
+		t.Errorf("err = %v", run.Err())
+	}
+	if msgs := history(t, id); len(msgs) != 1 {
+		t.Errorf("unexpected history: %v", msgs)
+	}
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"myeino/middleware"
+)
+
+// newAuth creates the authentication middleware, or returns nil when no credentials are configured.
+// The access_token query parameter is only accepted on queryTokenPaths, see middleware.AuthWithQueryToken.
+// AUTH_API_KEYS_FILE is a JSON array of {"key", "tenant_id", "user_id", "roles"};
+// AUTH_JWT_SECRET enables HMAC-signed JWTs, checked against AUTH_JWT_ISSUER and AUTH_JWT_AUDIENCE when set.
+func newAuth(queryTokenPaths ...string) app.HandlerFunc {
+	var authenticators []middleware.Authenticator
+
+	if path := os.Getenv("AUTH_API_KEYS_FILE"); path != "" {
+		keys, err := middleware.LoadAPIKeys(path)
+		if err != nil {
+			log.Fatalf("[Auth] %v", err)
+		}
+		a, err := middleware.NewAPIKeyAuthenticator(keys)
+		if err != nil {
+			log.Fatalf("[Auth] %v", err)
+		}
+		authenticators = append(authenticators, a)
+		log.Printf("[Auth] Loaded %d API keys", len(keys))
+	}
+
+	if secret := os.Getenv("AUTH_JWT_SECRET"); secret != "" {
+		a, err := middleware.NewJWTAuthenticator(&middleware.JWTConfig{
+			Secret:   []byte(secret),
+			Issuer:   os.Getenv("AUTH_JWT_ISSUER"),
+			Audience: os.Getenv("AUTH_JWT_AUDIENCE"),
+			Leeway:   30 * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("[Auth] %v", err)
+		}
+		authenticators = append(authenticators, a)
+		log.Printf("[Auth] JWT authentication enabled")
+	}
+
+	if len(authenticators) == 0 {
+		log.Printf("[Auth] No credentials configured, the agent API is open to anyone")
+		return nil
+	}
+	return middleware.AuthWithQueryToken(queryTokenPaths, authenticators...)
+}
+
+// conversationKey namespaces a client-chosen conversation ID by tenant and user,
+// so that callers can only reach their own conversations. Without authentication the ID is used as is.
+func conversationKey(ctx context.Context, id string) string {
+	p := middleware.PrincipalFromContext(ctx)
+	if p == nil {
+		return id
+	}
+	// QueryEscape never leaves ':' unescaped, so the key cannot be forged by choosing an ID.
+	return strings.Join([]string{url.QueryEscape(p.TenantID), url.QueryEscape(p.UserID), url.QueryEscape(id)}, ":")
+}
@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/cloudwego/eino/callbacks"
+)
+
+var (
+	handlersMu sync.RWMutex
+	handlers   []callbacks.Handler
+)
+
+// RegisterCallbacks adds handlers (tracing, metrics, ...) that are attached to every agent run.
+// It is meant to be called during startup, before the server starts serving requests.
+func RegisterCallbacks(hs ...callbacks.Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers = append(handlers, hs...)
+}
+
+func registeredCallbacks() []callbacks.Handler {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	return append([]callbacks.Handler(nil), handlers...)
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNoPendingRequest is returned when a reply names no request the agent is waiting on.
+var ErrNoPendingRequest = errors.New("no pending request")
+
+// ErrInputNotExpected is returned when input answers a request that only takes approve or deny.
+var ErrInputNotExpected = errors.New("the request does not take input")
+
+// Reply is the user's answer to a question asked by the agent mid-run,
+// an approval of a tool call or some human input.
+type Reply struct {
+	Approved bool   `json:"approved"`
+	Input    string `json:"input,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// interactionRegistry holds the questions the agent is waiting on. Requests are keyed by
+// conversationKey, so that users can only answer the questions of their own conversations.
+type interactionRegistry struct {
+	mu      sync.Mutex
+	pending map[string]*pendingRequest
+}
+
+type pendingRequest struct {
+	// input tells whether the request asks for text, approvals only take approve or deny
+	input   bool
+	resolve func(context.Context, Reply) error
+}
+
+var interactions = newInteractionRegistry()
+
+func newInteractionRegistry() *interactionRegistry {
+	return &interactionRegistry{pending: map[string]*pendingRequest{}}
+}
+
+// register waits for a reply to requestID, resolve is called at most once. Replies carrying Input
+// are only delivered if input is set.
+func (r *interactionRegistry) register(conversationKey, requestID string, input bool, resolve func(context.Context, Reply) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[conversationKey+"/"+requestID] = &pendingRequest{input: input, resolve: resolve}
+}
+
+// cancel drops a request that no longer needs a reply.
+func (r *interactionRegistry) cancel(conversationKey, requestID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, conversationKey+"/"+requestID)
+}
+
+// resolve delivers reply to the pending request.
+func (r *interactionRegistry) resolve(ctx context.Context, conversationKey, requestID string, reply Reply) error {
+	r.mu.Lock()
+	key := conversationKey + "/" + requestID
+	req, ok := r.pending[key]
+	if !ok {
+		r.mu.Unlock()
+		return ErrNoPendingRequest
+	}
+	// a misplaced answer leaves the request pending
+	if reply.Input != "" && !req.input {
+		r.mu.Unlock()
+		return ErrInputNotExpected
+	}
+	delete(r.pending, key)
+	r.mu.Unlock()
+
+	return req.resolve(ctx, reply)
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"myeino/agent"
+)
+
+// recorderFlushTimeout bounds how long Shutdown waits for history writes once streams are done.
+const recorderFlushTimeout = 5 * time.Second
+
+// ErrShuttingDown is returned for chats started after Shutdown began.
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// chatTracker keeps track of in-flight chats so that shutdown can drain them.
+type chatTracker struct {
+	mu       sync.Mutex
+	draining bool
+	// active is keyed by a sequence number, request IDs come from clients and may repeat.
+	active map[uint64]*activeChat
+	nextID uint64
+
+	// streams counts chats whose response is still being streamed.
+	streams sync.WaitGroup
+	// recorders counts goroutines appending answers to memory.
+	recorders sync.WaitGroup
+}
+
+type activeChat struct {
+	// requestID is only logged.
+	requestID      string
+	conversationID string
+	started        time.Time
+	cancel         context.CancelCauseFunc
+}
+
+var chats = newChatTracker()
+
+func newChatTracker() *chatTracker {
+	return &chatTracker{active: map[uint64]*activeChat{}}
+}
+
+// closers are closed once every chat is drained.
+var (
+	closersMu sync.Mutex
+	closers   []io.Closer
+)
+
+// registerCloser closes c (typically a Redis client) during Shutdown.
+func registerCloser(c io.Closer) {
+	closersMu.Lock()
+	defer closersMu.Unlock()
+	closers = append(closers, c)
+}
+
+// begin registers a chat, the returned ctx is cancelled with ErrShuttingDown if the chat is interrupted by shutdown.
+// done must be called once the response has been fully written.
+func (t *chatTracker) begin(ctx context.Context, requestID, conversationID string) (context.Context, func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return nil, nil, ErrShuttingDown
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	id := t.nextID
+	t.nextID++
+	t.active[id] = &activeChat{requestID: requestID, conversationID: conversationID, started: time.Now(), cancel: cancel}
+	t.streams.Add(1)
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			// ctx is not cancelled here, the history recorder may still be reading the stream.
+			t.mu.Lock()
+			delete(t.active, id)
+			t.mu.Unlock()
+			t.streams.Done()
+		})
+	}
+	return ctx, done, nil
+}
+
+// ShutdownReport describes how in-flight chats ended during shutdown.
+type ShutdownReport struct {
+	// InFlight is the number of chats being streamed when shutdown began.
+	InFlight int
+	// Interrupted lists the conversations cut off by the drain deadline.
+	Interrupted []string
+}
+
+// Shutdown stops accepting new chats and waits for in-flight streams until ctx is done.
+// Chats still running at the deadline are cancelled, so that their partial answers are recorded.
+// It then waits for history writes and closes the Redis clients.
+func Shutdown(ctx context.Context) *ShutdownReport {
+	// answers whose client went away are not waited for, nobody can reconnect any more
+	turns.drain(ErrShuttingDown)
+	report := chats.drain(ctx)
+
+	closersMu.Lock()
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			log.Printf("[Shutdown] Failed to close %T: %v", c, err)
+		}
+	}
+	closers = nil
+	closersMu.Unlock()
+	if err := agent.Close(); err != nil {
+		log.Printf("[Shutdown] Failed to close agent clients: %v", err)
+	}
+
+	log.Printf("[Shutdown] Done, %d chats completed, %d interrupted",
+		report.InFlight-len(report.Interrupted), len(report.Interrupted))
+	return report
+}
+
+// drain rejects new chats, waits for in-flight ones until ctx is done, cancels the rest
+// and waits for their history to be written.
+func (t *chatTracker) drain(ctx context.Context) *ShutdownReport {
+	t.mu.Lock()
+	t.draining = true
+	report := &ShutdownReport{InFlight: len(t.active)}
+	t.mu.Unlock()
+
+	log.Printf("[Shutdown] Draining %d in-flight chats", report.InFlight)
+
+	if !waitTimeout(ctx, &t.streams) {
+		t.mu.Lock()
+		for _, chat := range t.active {
+			report.Interrupted = append(report.Interrupted, chat.conversationID)
+			log.Printf("[Shutdown] Interrupting chat ID: %s, Request ID: %s, running for %s",
+				chat.conversationID, chat.requestID, time.Since(chat.started).Round(time.Second))
+			chat.cancel(ErrShuttingDown)
+		}
+		t.mu.Unlock()
+		sort.Strings(report.Interrupted)
+		log.Printf("[Shutdown] Drain deadline reached, interrupted %d chats: %v", len(report.Interrupted), report.Interrupted)
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), recorderFlushTimeout)
+	defer cancel()
+	if !waitTimeout(flushCtx, &t.recorders) {
+		log.Printf("[Shutdown] Timed out waiting for conversation history writes")
+	}
+	return report
+}
+
+// waitTimeout waits for wg, returning false if ctx is done first.
+func waitTimeout(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	// The package level memory and usage stores create data/ relative to the package directory.
+	_ = os.RemoveAll("data")
+	os.Exit(code)
+}
+
+func TestDrainWaitsForInFlightChats(t *testing.T) {
+	tracker := newChatTracker()
+	_, done, err := tracker.begin(context.Background(), "r1", "conv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	report := tracker.drain(ctx)
+	if report.InFlight != 1 || len(report.Interrupted) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	if _, _, err := tracker.begin(context.Background(), "r2", "conv-2"); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("expected new chats to be rejected, got %v", err)
+	}
+}
+
+func TestDrainInterruptsChatsAtDeadline(t *testing.T) {
+	tracker := newChatTracker()
+	chatCtx, done, err := tracker.begin(context.Background(), "r1", "conv-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, fastDone, err := tracker.begin(context.Background(), "r2", "conv-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastDone()
+
+	// The chat ends once it notices the cancellation, and its recorder writes the partial answer.
+	recorded := make(chan struct{})
+	tracker.recorders.Add(1)
+	go func() {
+		defer tracker.recorders.Done()
+		<-chatCtx.Done()
+		done()
+		close(recorded)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report := tracker.drain(ctx)
+
+	if report.InFlight != 1 || len(report.Interrupted) != 1 || report.Interrupted[0] != "conv-1" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	select {
+	case <-recorded:
+	default:
+		t.Error("drain returned before the recorder finished")
+	}
+}
+
+func TestDrainTracksChatsWithTheSameRequestID(t *testing.T) {
+	tracker := newChatTracker()
+	var ctxs []context.Context
+	for _, conv := range []string{"conv-1", "conv-2"} {
+		// 请求 ID 由客户端提供，可能重复
+		ctx, done, err := tracker.begin(context.Background(), "r1", conv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctxs = append(ctxs, ctx)
+		go func() {
+			<-ctx.Done()
+			done()
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report := tracker.drain(ctx)
+	if report.InFlight != 2 || len(report.Interrupted) != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	for i, ctx := range ctxs {
+		if !errors.Is(context.Cause(ctx), ErrShuttingDown) {
+			t.Errorf("chat %d not interrupted: %v", i, context.Cause(ctx))
+		}
+	}
+}
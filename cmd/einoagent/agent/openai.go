@@ -0,0 +1,473 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/sse"
+	"myeino/agent"
+	"myeino/middleware"
+	"myeino/telemetry"
+	"myeino/util"
+)
+
+// OpenAIModelID is the model name of the assistant in the OpenAI compatible API.
+const OpenAIModelID = "eino-assistant"
+
+// modelCreated is reported as the creation time of the model.
+var modelCreated = time.Now().Unix()
+
+// usageWaitTimeout bounds how long a response waits for the usage of the last model call.
+const usageWaitTimeout = time.Second
+
+// openAIMessage is a message of the chat completions API. Content is a string or an array of parts,
+// only the text parts are kept.
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+func (m *openAIMessage) text() (string, error) {
+	if len(m.Content) == 0 || string(m.Content) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return "", errors.New("content must be a string or an array of parts")
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String(), nil
+}
+
+type chatCompletionRequest struct {
+	Model         string          `json:"model"`
+	Messages      []openAIMessage `json:"messages"`
+	Stream        bool            `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+	N    int    `json:"n,omitempty"`
+	User string `json:"user,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type openAIDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int          `json:"index"`
+	Message      *openAIDelta `json:"message,omitempty"`
+	Delta        *openAIDelta `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+type chatCompletion struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+type openAIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+func writeOpenAIError(c *app.RequestContext, status int, typ, code, message string) {
+	e := &openAIError{Message: message, Type: typ}
+	if code != "" {
+		e.Code = &code
+	}
+	c.JSON(status, map[string]any{"error": e})
+}
+
+// BindOpenAIRoutes serves the assistant through the OpenAI chat completions API, so that OpenAI
+// clients can use it unchanged with their base URL pointed at the group (usually /v1).
+func BindOpenAIRoutes(r *route.RouterGroup) error {
+	if auth := newAuth(); auth != nil {
+		r.Use(auth)
+	}
+	r.GET("/models", HandleListModels)
+	r.POST("/chat/completions", chatRateLimit(), HandleChatCompletions)
+	return nil
+}
+
+// HandleListModels lists the single model served by the assistant.
+func HandleListModels(ctx context.Context, c *app.RequestContext) {
+	c.JSON(consts.StatusOK, map[string]any{
+		"object": "list",
+		"data": []map[string]any{{
+			"id":       OpenAIModelID,
+			"object":   "model",
+			"created":  modelCreated,
+			"owned_by": "einoagent",
+		}},
+	})
+}
+
+// toUserMessage turns the messages of a request into the agent input: the last message is the
+// question, the previous ones the history. The conversation memory is not used, OpenAI clients
+// send the whole conversation with each request.
+func toUserMessage(id string, messages []openAIMessage) (*agent.UserMessage, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("messages must not be empty")
+	}
+	last := messages[len(messages)-1]
+	if last.Role != "user" {
+		return nil, errors.New("the last message must be a user message")
+	}
+	query, err := last.text()
+	if err != nil {
+		return nil, fmt.Errorf("messages[%d]: %w", len(messages)-1, err)
+	}
+
+	var history []*schema.Message
+	for i, m := range messages[:len(messages)-1] {
+		content, err := m.text()
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		switch m.Role {
+		case "system", "developer":
+			history = append(history, schema.SystemMessage(content))
+		case "user":
+			history = append(history, schema.UserMessage(content))
+		case "assistant":
+			if content != "" {
+				history = append(history, schema.AssistantMessage(content, nil))
+			}
+		case "tool", "function":
+			// 工具调用由本服务的 agent 执行，客户端的工具结果无法使用
+		default:
+			return nil, fmt.Errorf("messages[%d]: unknown role %q", i, m.Role)
+		}
+	}
+	return &agent.UserMessage{ID: id, Query: query, History: history}, nil
+}
+
+// HandleChatCompletions answers a chat completion request with the RAG + ReAct agent, as a
+// chat.completion object or, with stream set, as chat.completion.chunk server-sent events.
+func HandleChatCompletions(ctx context.Context, c *app.RequestContext) {
+	var req chatCompletionRequest
+	if err := json.Unmarshal(c.Request.Body(), &req); err != nil {
+		metrics.ObserveChatRequest("bad_request")
+		writeOpenAIError(c, consts.StatusBadRequest, "invalid_request_error", "", "invalid JSON body: "+err.Error())
+		return
+	}
+	if req.Model != OpenAIModelID {
+		metrics.ObserveChatRequest("bad_request")
+		writeOpenAIError(c, consts.StatusNotFound, "invalid_request_error", "model_not_found",
+			fmt.Sprintf("The model %q does not exist", req.Model))
+		return
+	}
+	if req.N > 1 {
+		metrics.ObserveChatRequest("bad_request")
+		writeOpenAIError(c, consts.StatusBadRequest, "invalid_request_error", "", "n must be 1")
+		return
+	}
+
+	requestID := string(c.GetHeader("X-Request-ID"))
+	if requestID == "" {
+		requestID = util.NewRequestID()
+	}
+	c.Header("X-Request-ID", requestID)
+	// 每个请求都是独立的会话，用于用量统计
+	id := "openai-" + requestID
+	userMessage, err := toUserMessage(id, req.Messages)
+	if err != nil {
+		metrics.ObserveChatRequest("bad_request")
+		writeOpenAIError(c, consts.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+
+	ctx = util.WithRequestID(ctx, requestID)
+	ctx = util.WithConversationID(ctx, id)
+	if middleware.PrincipalFromContext(ctx) == nil {
+		userID := string(c.GetHeader("X-User-ID"))
+		if userID == "" {
+			userID = req.User
+		}
+		if userID != "" {
+			ctx = util.WithUserID(ctx, userID)
+		}
+	}
+
+	ctx, done, err := chats.begin(ctx, requestID, id)
+	if err != nil {
+		metrics.ObserveChatRequest("unavailable")
+		c.Header("Retry-After", "5")
+		writeOpenAIError(c, consts.StatusServiceUnavailable, "server_error", "", err.Error())
+		return
+	}
+	defer done()
+
+	log.Printf("[OpenAI] Starting completion, Request ID: %s, Messages: %d, Stream: %v", requestID, len(req.Messages), req.Stream)
+	collector := newUsageCollector()
+	// 无法向 OpenAI 客户端请求确认，需要确认的工具不会执行
+	sr, err := streamAgent(agent.WithoutApprovals(ctx), userMessage, compose.WithCallbacks(collector))
+	if err != nil {
+		log.Printf("[OpenAI] Error running agent: %v", err)
+		metrics.ObserveChatRequest("error")
+		writeOpenAIError(c, consts.StatusInternalServerError, "server_error", "", err.Error())
+		return
+	}
+	metrics.ObserveChatRequest("ok")
+
+	completion := &chatCompletion{
+		ID:      "chatcmpl-" + requestID,
+		Created: time.Now().Unix(),
+		Model:   OpenAIModelID,
+	}
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		err = streamCompletion(ctx, sr, newSSEStream(c), completion, collector, includeUsage)
+		c.Flush()
+	} else {
+		err = generateCompletion(ctx, c, sr, completion, collector)
+	}
+	if err != nil && !errors.Is(err, ErrClientDisconnected) {
+		log.Printf("[OpenAI] Completion %s failed: %v", completion.ID, err)
+	}
+}
+
+// generateCompletion waits for the whole answer and writes it as a chat.completion object.
+func generateCompletion(ctx context.Context, c *app.RequestContext, sr *schema.StreamReader[*schema.Message], completion *chatCompletion, collector *usageCollector) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	items := pumpStream(sr, stop)
+
+	var content strings.Builder
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case item := <-items:
+			if item.err != nil && !errors.Is(item.err, io.EOF) {
+				writeOpenAIError(c, consts.StatusInternalServerError, "server_error", "", item.err.Error())
+				return item.err
+			}
+			if item.err == nil {
+				if item.chunk != nil {
+					content.WriteString(item.chunk.Content)
+				}
+				continue
+			}
+
+			stopReason := "stop"
+			completion.Object = "chat.completion"
+			completion.Choices = []openAIChoice{{
+				Message:      &openAIDelta{Role: "assistant", Content: content.String()},
+				FinishReason: &stopReason,
+			}}
+			completion.Usage = collector.wait(usageWaitTimeout)
+			c.JSON(consts.StatusOK, completion)
+			return nil
+		}
+	}
+}
+
+// streamCompletion publishes every chunk of sr as a chat.completion.chunk event, then the final chunk,
+// the usage when requested and the [DONE] marker. Errors after the first chunk are sent as an error event.
+func streamCompletion(ctx context.Context, sr *schema.StreamReader[*schema.Message], pub eventPublisher, completion *chatCompletion, collector *usageCollector, includeUsage bool) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	items := pumpStream(sr, stop)
+
+	completion.Object = "chat.completion.chunk"
+	publish := func(choices []openAIChoice, usage *openAIUsage) error {
+		chunk := *completion
+		chunk.Choices = choices
+		chunk.Usage = usage
+		data, err := json.Marshal(&chunk)
+		if err != nil {
+			return err
+		}
+		if err := pub.Publish(openAIEvent(data)); err != nil {
+			return fmt.Errorf("%w: %v", ErrClientDisconnected, err)
+		}
+		return nil
+	}
+	delta := func(d *openAIDelta, finishReason *string) []openAIChoice {
+		return []openAIChoice{{Delta: d, FinishReason: finishReason}}
+	}
+
+	if err := publish(delta(&openAIDelta{Role: "assistant"}, nil), nil); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case item := <-items:
+			if item.err != nil && !errors.Is(item.err, io.EOF) {
+				data, _ := json.Marshal(map[string]any{"error": &openAIError{Message: item.err.Error(), Type: "server_error"}})
+				_ = pub.Publish(openAIEvent(data))
+				return item.err
+			}
+			if item.err == nil {
+				if item.chunk == nil || item.chunk.Content == "" {
+					continue
+				}
+				if err := publish(delta(&openAIDelta{Content: item.chunk.Content}, nil), nil); err != nil {
+					return err
+				}
+				continue
+			}
+
+			stopReason := "stop"
+			if err := publish(delta(&openAIDelta{}, &stopReason), nil); err != nil {
+				return err
+			}
+			if includeUsage {
+				usage := collector.wait(usageWaitTimeout)
+				if usage == nil {
+					usage = &openAIUsage{}
+				}
+				if err := publish([]openAIChoice{}, usage); err != nil {
+					return err
+				}
+			}
+			if err := pub.Publish(openAIEvent([]byte("[DONE]"))); err != nil {
+				return fmt.Errorf("%w: %v", ErrClientDisconnected, err)
+			}
+			return nil
+		}
+	}
+}
+
+// openAIEvent writes data as "data: <data>" like the OpenAI API, some clients require the space
+// which sse.Encode omits. SSE parsers strip it.
+func openAIEvent(data []byte) *sse.Event {
+	return &sse.Event{Data: append([]byte(" "), data...)}
+}
+
+// usageCollector is an eino callbacks.Handler summing the token usage of the chat model calls of a run,
+// including the calls made inside the ReAct loop.
+type usageCollector struct {
+	mu      sync.Mutex
+	usage   openAIUsage
+	found   bool
+	pending sync.WaitGroup
+}
+
+func newUsageCollector() *usageCollector {
+	return &usageCollector{}
+}
+
+func (u *usageCollector) add(tu *model.TokenUsage) {
+	if tu == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.found = true
+	u.usage.PromptTokens += tu.PromptTokens
+	u.usage.CompletionTokens += tu.CompletionTokens
+	u.usage.TotalTokens += tu.TotalTokens
+}
+
+// wait returns the usage once the streamed model outputs have been drained, or what is known after timeout.
+// It is nil when the model reported no usage.
+func (u *usageCollector) wait(timeout time.Duration) *openAIUsage {
+	drained := make(chan struct{})
+	go func() {
+		u.pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(timeout):
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.found {
+		return nil
+	}
+	usage := u.usage
+	return &usage
+}
+
+func (u *usageCollector) OnStart(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
+	return ctx
+}
+
+func (u *usageCollector) OnEnd(ctx context.Context, info *callbacks.RunInfo, output callbacks.CallbackOutput) context.Context {
+	if info != nil && info.Component == components.ComponentOfChatModel {
+		u.add(telemetry.TokenUsageOf(output))
+	}
+	return ctx
+}
+
+func (u *usageCollector) OnError(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+	return ctx
+}
+
+func (u *usageCollector) OnStartWithStreamInput(ctx context.Context, info *callbacks.RunInfo, input *schema.StreamReader[callbacks.CallbackInput]) context.Context {
+	input.Close()
+	return ctx
+}
+
+func (u *usageCollector) OnEndWithStreamOutput(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[callbacks.CallbackOutput]) context.Context {
+	if info == nil || info.Component != components.ComponentOfChatModel {
+		output.Close()
+		return ctx
+	}
+
+	// 用量在最后一个分片中返回，需要读完整个流
+	u.pending.Add(1)
+	go func() {
+		defer u.pending.Done()
+		defer output.Close()
+		var usage *model.TokenUsage
+		for {
+			chunk, err := output.Recv()
+			if err != nil {
+				break
+			}
+			if tu := telemetry.TokenUsageOf(chunk); tu != nil {
+				usage = tu
+			}
+		}
+		u.add(usage)
+	}()
+	return ctx
+}
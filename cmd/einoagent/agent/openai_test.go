@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func performCompletion(t *testing.T, body string) *ut.ResponseRecorder {
+	t.Helper()
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.POST("/v1/chat/completions", HandleChatCompletions)
+	return ut.PerformRequest(engine, consts.MethodPost, "/v1/chat/completions",
+		&ut.Body{Body: strings.NewReader(body), Len: len(body)},
+		ut.Header{Key: "Content-Type", Value: "application/json"})
+}
+
+func TestChatCompletion(t *testing.T) {
+	m := newStreamingModel("Eino is", " a framework.")
+	m.usage = &schema.TokenUsage{PromptTokens: 10, CompletionTokens: 4, TotalTokens: 14}
+	useModel(t, m)
+
+	w := performCompletion(t, `{"model":"eino-assistant","messages":[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":[{"type":"text","text":"What is "},{"type":"text","text":"Eino?"}]}]}`)
+	if w.Code != consts.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var got chatCompletion
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Object != "chat.completion" || !strings.HasPrefix(got.ID, "chatcmpl-") || got.Model != OpenAIModelID {
+		t.Errorf("unexpected completion: %+v", got)
+	}
+	if len(got.Choices) != 1 || got.Choices[0].Message.Content != "Eino is a framework." || *got.Choices[0].FinishReason != "stop" {
+		t.Errorf("unexpected choices: %+v", got.Choices)
+	}
+	if got.Usage == nil || got.Usage.TotalTokens != 14 || got.Usage.PromptTokens != 10 {
+		t.Errorf("usage = %+v", got.Usage)
+	}
+}
+
+func TestChatCompletionStream(t *testing.T) {
+	m := newStreamingModel("Hello", " there")
+	m.usage = &schema.TokenUsage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+	useModel(t, m)
+	addr := startTestServer(t, func(h *server.Hertz) {
+		h.POST("/v1/chat/completions", HandleChatCompletions)
+	})
+
+	body := `{"model":"eino-assistant","stream":true,"stream_options":{"include_usage":true},
+		"messages":[{"role":"user","content":"hi"}]}`
+	resp, err := http.Post("http://"+addr+"/v1/chat/completions", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	var chunks []chatCompletion
+	var done bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk chatCompletion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done {
+		t.Fatal("stream ended without [DONE]")
+	}
+
+	// role, two deltas, finish, usage
+	if len(chunks) != 5 {
+		t.Fatalf("got %d chunks: %+v", len(chunks), chunks)
+	}
+	if chunks[0].Object != "chat.completion.chunk" || chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Errorf("unexpected first chunk: %+v", chunks[0])
+	}
+	if text := chunks[1].Choices[0].Delta.Content + chunks[2].Choices[0].Delta.Content; text != "Hello there" {
+		t.Errorf("streamed text = %q", text)
+	}
+	if fr := chunks[3].Choices[0].FinishReason; fr == nil || *fr != "stop" {
+		t.Errorf("unexpected finish chunk: %+v", chunks[3])
+	}
+	if last := chunks[4]; len(last.Choices) != 0 || last.Usage == nil || last.Usage.TotalTokens != 5 {
+		t.Errorf("unexpected usage chunk: %+v", last)
+	}
+}
+
+func TestChatCompletionRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"invalid json", `{`, consts.StatusBadRequest, ""},
+		{"unknown model", `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`, consts.StatusNotFound, "model_not_found"},
+		{"no messages", `{"model":"eino-assistant","messages":[]}`, consts.StatusBadRequest, ""},
+		{"last not user", `{"model":"eino-assistant","messages":[{"role":"assistant","content":"hi"}]}`, consts.StatusBadRequest, ""},
+		{"several choices", `{"model":"eino-assistant","n":2,"messages":[{"role":"user","content":"hi"}]}`, consts.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := performCompletion(t, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			var resp struct {
+				Error openAIError `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error.Message == "" {
+				t.Fatalf("not an OpenAI error: %s", w.Body.String())
+			}
+			if tt.code != "" && (resp.Error.Code == nil || *resp.Error.Code != tt.code) {
+				t.Errorf("code = %v, want %s", resp.Error.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestToUserMessage(t *testing.T) {
+	msgs := []openAIMessage{
+		{Role: "system", Content: json.RawMessage(`"You help."`)},
+		{Role: "user", Content: json.RawMessage(`"first"`)},
+		{Role: "assistant", Content: json.RawMessage(`null`)},
+		{Role: "tool", Content: json.RawMessage(`"42"`)},
+		{Role: "assistant", Content: json.RawMessage(`"answer"`)},
+		{Role: "user", Content: json.RawMessage(`"second"`)},
+	}
+	um, err := toUserMessage("c1", msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if um.ID != "c1" || um.Query != "second" || len(um.History) != 3 {
+		t.Fatalf("unexpected message: %+v", um)
+	}
+	if um.History[0].Role != schema.System || um.History[2].Content != "answer" {
+		t.Errorf("unexpected history: %v", um.History)
+	}
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	rds "github.com/redis/go-redis/v9"
+	"myeino/middleware"
+)
+
+var limits = newLimits()
+
+// newLimits loads the rate limits and token quotas from RATE_LIMIT_FILE, or uses the defaults.
+func newLimits() *middleware.Limits {
+	path := os.Getenv("RATE_LIMIT_FILE")
+	if path == "" {
+		return middleware.NewLimits(nil)
+	}
+	settings, err := middleware.LoadLimitSettings(path)
+	if err != nil {
+		log.Printf("[RateLimit] Failed to load limits, using defaults: %v", err)
+		return middleware.NewLimits(nil)
+	}
+	return middleware.NewLimits(settings)
+}
+
+var (
+	chatLimiterOnce sync.Once
+	chatLimiterVal  *middleware.RateLimiter
+)
+
+// chatRateLimit returns the rate limiting middleware shared by all the chat endpoints,
+// so that switching API does not reset the buckets.
+func chatRateLimit() app.HandlerFunc {
+	return chatLimiter().Middleware()
+}
+
+// chatLimiter returns the limiter behind chatRateLimit, WebSocket messages are checked with it.
+func chatLimiter() *middleware.RateLimiter {
+	chatLimiterOnce.Do(func() {
+		chatLimiterVal = newRateLimiter()
+	})
+	return chatLimiterVal
+}
+
+// newRateLimiter creates the chat rate limiter.
+// RATE_LIMIT_BACKEND=redis shares buckets between instances through RATE_LIMIT_REDIS_ADDR (default localhost:6479).
+func newRateLimiter() *middleware.RateLimiter {
+	var limiter middleware.Limiter = middleware.NewMemoryLimiter()
+	if os.Getenv("RATE_LIMIT_BACKEND") == "redis" {
+		addr := os.Getenv("RATE_LIMIT_REDIS_ADDR")
+		if addr == "" {
+			addr = "localhost:6479"
+		}
+		client := rds.NewClient(&rds.Options{
+			Addr:     addr,
+			Protocol: 2,
+		})
+		registerCloser(client)
+		limiter = middleware.NewRedisLimiter(client, "")
+	}
+
+	return middleware.NewRateLimiter(&middleware.RateLimitConfig{
+		Limiter: limiter,
+		Limits:  limits,
+		Usage:   usageStore,
+	})
+}
+
+// requireAdmin only lets through principals with the admin role, or requests carrying
+// ADMIN_TOKEN in X-Admin-Token. Without either the admin API is disabled.
+func requireAdmin(ctx context.Context, c *app.RequestContext) {
+	if p := middleware.PrincipalFromContext(ctx); p != nil && p.HasRole(middleware.RoleAdmin) {
+		c.Next(ctx)
+		return
+	}
+	token := os.Getenv("ADMIN_TOKEN")
+	given := c.GetHeader("X-Admin-Token")
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), given) != 1 {
+		c.AbortWithStatusJSON(consts.StatusForbidden, map[string]string{
+			"status": "error",
+			"error":  "admin access required",
+		})
+		return
+	}
+	c.Next(ctx)
+}
+
+// HandleGetLimits returns the current rate limits and token quotas.
+func HandleGetLimits(ctx context.Context, c *app.RequestContext) {
+	c.JSON(consts.StatusOK, limits.Get())
+}
+
+// HandleSetLimits replaces the rate limits and token quotas, and saves them to RATE_LIMIT_FILE if set.
+func HandleSetLimits(ctx context.Context, c *app.RequestContext) {
+	var settings middleware.LimitSettings
+	if err := json.Unmarshal(c.Request.Body(), &settings); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]string{
+			"status": "error",
+			"error":  "invalid limits: " + err.Error(),
+		})
+		return
+	}
+	if err := limits.Set(&settings); err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	if path := os.Getenv("RATE_LIMIT_FILE"); path != "" {
+		data, _ := json.MarshalIndent(&settings, "", "  ")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			log.Printf("[RateLimit] Failed to save limits to %s: %v", path, err)
+		}
+	}
+	log.Printf("[RateLimit] Limits updated: default=%+v, daily_token_quota=%d", settings.Default, settings.DailyTokenQuota)
+	c.JSON(consts.StatusOK, limits.Get())
+}
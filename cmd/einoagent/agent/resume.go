@@ -0,0 +1,451 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hertz-contrib/sse"
+	rds "github.com/redis/go-redis/v9"
+)
+
+// doneEvent ends every turn, its data is the outcome: complete or interrupted.
+// Clients should close their EventSource on it, otherwise the browser reconnects.
+const doneEvent = "done"
+
+// resumePollInterval is how often a follower polls the store for a turn produced by another instance.
+const resumePollInterval = 250 * time.Millisecond
+
+var errTurnNotFound = errors.New("turn not found or expired")
+
+// ResumeEvent is a published SSE event of a turn. Seq starts at 1 and has no gaps.
+type ResumeEvent struct {
+	Seq   int    `json:"seq"`
+	Event string `json:"event,omitempty"`
+	Data  string `json:"data"`
+}
+
+// EventStore keeps the events of each turn for a retention window so that clients can resume.
+// Events of a turn are appended in Seq order by a single producer.
+type EventStore interface {
+	Append(ctx context.Context, key string, event *ResumeEvent) error
+	// After returns the events with a Seq greater than after.
+	// ok is false when the turn is unknown or has expired.
+	After(ctx context.Context, key string, after int) (events []*ResumeEvent, ok bool, err error)
+}
+
+// MemoryEventStore keeps turns in process memory, suitable for a single instance.
+type MemoryEventStore struct {
+	mu        sync.Mutex
+	retention time.Duration
+	turns     map[string]*memoryTurn
+	appends   int
+	now       func() time.Time
+}
+
+type memoryTurn struct {
+	events  []*ResumeEvent
+	expires time.Time
+}
+
+// NewMemoryEventStore creates a store forgetting turns retention after their last event.
+func NewMemoryEventStore(retention time.Duration) *MemoryEventStore {
+	return &MemoryEventStore{retention: retention, turns: map[string]*memoryTurn{}, now: time.Now}
+}
+
+func (m *MemoryEventStore) Append(_ context.Context, key string, event *ResumeEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.appends++
+	if m.appends%256 == 0 {
+		for k, t := range m.turns {
+			if now.After(t.expires) {
+				delete(m.turns, k)
+			}
+		}
+	}
+
+	t, ok := m.turns[key]
+	if !ok || now.After(t.expires) {
+		t = &memoryTurn{}
+		m.turns[key] = t
+	}
+	t.events = append(t.events, event)
+	t.expires = now.Add(m.retention)
+	return nil
+}
+
+func (m *MemoryEventStore) After(_ context.Context, key string, after int) ([]*ResumeEvent, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.turns[key]
+	if !ok || m.now().After(t.expires) {
+		return nil, false, nil
+	}
+	after = max(after, 0)
+	if after >= len(t.events) {
+		return nil, true, nil
+	}
+	return append([]*ResumeEvent(nil), t.events[after:]...), true, nil
+}
+
+// RedisEventStore keeps turns in Redis lists, so that a turn can be replayed by any instance.
+type RedisEventStore struct {
+	client    *rds.Client
+	prefix    string
+	retention time.Duration
+}
+
+// NewRedisEventStore creates a store keeping turns under prefix, e.g. "eino:sse:".
+func NewRedisEventStore(client *rds.Client, prefix string, retention time.Duration) *RedisEventStore {
+	if prefix == "" {
+		prefix = "eino:sse:"
+	}
+	return &RedisEventStore{client: client, prefix: prefix, retention: retention}
+}
+
+func (r *RedisEventStore) Append(ctx context.Context, key string, event *ResumeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	pipe := r.client.TxPipeline()
+	pipe.RPush(ctx, r.prefix+key, data)
+	pipe.PExpire(ctx, r.prefix+key, r.retention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store event: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisEventStore) After(ctx context.Context, key string, after int) ([]*ResumeEvent, bool, error) {
+	after = max(after, 0)
+	pipe := r.client.Pipeline()
+	length := pipe.LLen(ctx, r.prefix+key)
+	items := pipe.LRange(ctx, r.prefix+key, int64(after), -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, false, fmt.Errorf("failed to read events: %w", err)
+	}
+	if length.Val() == 0 {
+		return nil, false, nil
+	}
+
+	events := make([]*ResumeEvent, 0, len(items.Val()))
+	for _, item := range items.Val() {
+		var ev ResumeEvent
+		if err := json.Unmarshal([]byte(item), &ev); err != nil {
+			return nil, false, fmt.Errorf("malformed event in %s: %w", key, err)
+		}
+		events = append(events, &ev)
+	}
+	return events, true, nil
+}
+
+// turnRegistry produces the SSE events of answers independently of the connections reading them.
+// A turn whose last client went away keeps running for the grace period, so that a reconnect
+// with Last-Event-ID continues it; after that the run is interrupted.
+type turnRegistry struct {
+	store  EventStore
+	grace  time.Duration
+	policy *FlushPolicy
+
+	mu       sync.Mutex
+	turns    map[string]*liveTurn
+	draining bool
+}
+
+// liveTurn is a turn produced by this instance.
+type liveTurn struct {
+	run *AgentRun
+	// notify is closed and replaced whenever an event is stored.
+	notify      chan struct{}
+	subscribers int
+	grace       *time.Timer
+}
+
+var turns = newTurnRegistry()
+
+// newTurnRegistry configures resumable streams from the environment:
+// SSE_RESUME_STORE=redis shares turns between instances through SSE_RESUME_REDIS_ADDR (default localhost:6479),
+// SSE_RESUME_RETENTION (default 5m) bounds how long finished turns can be replayed and
+// SSE_RESUME_GRACE (default 30s) how long a turn without clients waits for a reconnect, 0 interrupts it at once.
+// Live turns are only continued by the instance producing them, replaying needs the Redis store elsewhere.
+func newTurnRegistry() *turnRegistry {
+	retention := 5 * time.Minute
+	if d, ok := durationEnv("SSE_RESUME_RETENTION"); ok {
+		retention = d
+	}
+	grace := 30 * time.Second
+	if d, ok := durationEnv("SSE_RESUME_GRACE"); ok {
+		grace = d
+	}
+
+	var store EventStore = NewMemoryEventStore(retention)
+	if os.Getenv("SSE_RESUME_STORE") == "redis" {
+		addr := os.Getenv("SSE_RESUME_REDIS_ADDR")
+		if addr == "" {
+			addr = "localhost:6479"
+		}
+		client := rds.NewClient(&rds.Options{
+			Addr:     addr,
+			Protocol: 2,
+		})
+		registerCloser(client)
+		store = NewRedisEventStore(client, "", retention)
+	}
+	return newTurns(store, grace, flushPolicy)
+}
+
+func newTurns(store EventStore, grace time.Duration, policy *FlushPolicy) *turnRegistry {
+	return &turnRegistry{store: store, grace: grace, policy: policy, turns: map[string]*liveTurn{}}
+}
+
+// turnKey identifies a turn of a conversation, conversationKey keeps tenants and users apart.
+func turnKey(conversationKey, turnID string) string {
+	return conversationKey + "/" + turnID
+}
+
+// eventID is the SSE id of an event, sent back by browsers in Last-Event-ID.
+func eventID(turnID string, seq int) string {
+	return turnID + ":" + strconv.Itoa(seq)
+}
+
+// parseEventID splits a Last-Event-ID into the turn and the last sequence number received.
+func parseEventID(id string) (turnID string, seq int, ok bool) {
+	i := strings.LastIndexByte(id, ':')
+	if i <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.Atoi(id[i+1:])
+	if err != nil || seq < 0 {
+		return "", 0, false
+	}
+	return id[:i], seq, true
+}
+
+// start produces the events of run under key in the background.
+func (r *turnRegistry) start(key string, run *AgentRun) {
+	t := &liveTurn{run: run, notify: make(chan struct{})}
+	r.mu.Lock()
+	r.turns[key] = t
+	r.mu.Unlock()
+
+	go r.produce(key, t)
+}
+
+func (r *turnRegistry) produce(key string, t *liveTurn) {
+	pub := &turnPublisher{registry: r, key: key, turn: t}
+	// heartbeats are sent per connection by follow
+	policy := *r.policy
+	policy.Heartbeat = 0
+
+	if err := streamAnswer(context.Background(), t.run.Stream, pub, &policy); err != nil {
+		log.Printf("[Chat] Failed to buffer answer for turn %s: %v", key, err)
+		t.run.Interrupt(err)
+	}
+	<-t.run.Recorded()
+
+	outcome := "complete"
+	if t.run.Err() != nil {
+		outcome = "interrupted"
+	}
+	if err := pub.Publish(&sse.Event{Event: doneEvent, Data: []byte(outcome)}); err != nil {
+		log.Printf("[Chat] Failed to store end of turn %s: %v", key, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t.grace != nil {
+		t.grace.Stop()
+	}
+	delete(r.turns, key)
+	// wake up followers waiting on a turn that is no longer live
+	close(t.notify)
+}
+
+// turnPublisher numbers the events of a turn and stores them.
+type turnPublisher struct {
+	registry *turnRegistry
+	key      string
+	turn     *liveTurn
+	seq      int
+}
+
+func (p *turnPublisher) Publish(event *sse.Event) error {
+	ev := &ResumeEvent{Seq: p.seq + 1, Event: event.Event, Data: string(event.Data)}
+	if err := p.registry.store.Append(context.Background(), p.key, ev); err != nil {
+		return err
+	}
+	p.seq = ev.Seq
+
+	r := p.registry
+	r.mu.Lock()
+	close(p.turn.notify)
+	p.turn.notify = make(chan struct{})
+	r.mu.Unlock()
+	return nil
+}
+
+func (p *turnPublisher) Comment(string) error {
+	return nil
+}
+
+// interrupt stops the run of a live turn, it reports whether the turn is running here.
+func (r *turnRegistry) interrupt(key string, cause error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.turns[key]
+	if ok {
+		t.run.Interrupt(cause)
+	}
+	return ok
+}
+
+// exists reports whether the turn can be resumed.
+func (r *turnRegistry) exists(ctx context.Context, key string) (bool, error) {
+	r.mu.Lock()
+	_, live := r.turns[key]
+	r.mu.Unlock()
+	if live {
+		return true, nil
+	}
+	_, ok, err := r.store.After(ctx, key, 0)
+	return ok, err
+}
+
+// wakeup returns a channel closed on the next event of a live turn, nil when the turn is not live here.
+func (r *turnRegistry) wakeup(key string) <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.turns[key]; ok {
+		return t.notify
+	}
+	return nil
+}
+
+// follow publishes the events of the turn after seq until its done event, sending heartbeats
+// while the answer is idle. The connection counts as a client of the turn while following.
+func (r *turnRegistry) follow(ctx context.Context, key, turnID string, after int, pub eventPublisher) error {
+	r.attach(key)
+	detachCause := ErrClientDisconnected
+	defer func() {
+		r.detach(key, detachCause)
+	}()
+
+	var heartbeat *time.Timer
+	var beat <-chan time.Time
+	if r.policy.Heartbeat > 0 {
+		heartbeat = time.NewTimer(r.policy.Heartbeat)
+		defer heartbeat.Stop()
+		beat = heartbeat.C
+	}
+
+	for {
+		// taken before reading the store, so that no event is missed in between
+		wake := r.wakeup(key)
+		events, ok, err := r.store.After(ctx, key, after)
+		if err != nil {
+			return err
+		}
+		if !ok && wake == nil {
+			return errTurnNotFound
+		}
+
+		for _, ev := range events {
+			err := pub.Publish(&sse.Event{ID: eventID(turnID, ev.Seq), Event: ev.Event, Data: []byte(ev.Data)})
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrClientDisconnected, err)
+			}
+			if heartbeat != nil {
+				heartbeat.Reset(r.policy.Heartbeat)
+			}
+			after = ev.Seq
+			if ev.Event == doneEvent {
+				detachCause = nil
+				return nil
+			}
+		}
+
+		var poll <-chan time.Time
+		if wake == nil {
+			poll = time.After(resumePollInterval)
+		}
+		select {
+		case <-ctx.Done():
+			detachCause = interruptCause(ctx)
+			return context.Cause(ctx)
+		case <-wake:
+		case <-poll:
+		case <-beat:
+			if err := pub.Comment("keep-alive"); err != nil {
+				return fmt.Errorf("%w: %v", ErrClientDisconnected, err)
+			}
+			heartbeat.Reset(r.policy.Heartbeat)
+		}
+	}
+}
+
+func (r *turnRegistry) attach(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.turns[key]
+	if !ok {
+		return
+	}
+	t.subscribers++
+	if t.grace != nil {
+		t.grace.Stop()
+		t.grace = nil
+	}
+}
+
+// detach removes a client of the turn. Once no client is left the run is interrupted with cause,
+// after the grace period unless the server is shutting down. A nil cause means the client read
+// the whole turn.
+func (r *turnRegistry) detach(key string, cause error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.turns[key]
+	if !ok {
+		return
+	}
+	t.subscribers--
+	if t.subscribers > 0 || cause == nil {
+		return
+	}
+
+	if r.draining || r.grace <= 0 || errors.Is(cause, ErrShuttingDown) {
+		t.run.Interrupt(cause)
+		return
+	}
+	log.Printf("[Chat] No client left for turn %s, waiting %s for a reconnect", key, r.grace)
+	t.grace = time.AfterFunc(r.grace, func() {
+		t.run.Interrupt(cause)
+	})
+}
+
+// drain interrupts turns waiting for a reconnect; turns losing their last client from now on
+// are interrupted at once.
+func (r *turnRegistry) drain(cause error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draining = true
+	for _, t := range r.turns {
+		if t.subscribers == 0 {
+			if t.grace != nil {
+				t.grace.Stop()
+			}
+			t.run.Interrupt(cause)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseEventID(t *testing.T) {
+	tests := []struct {
+		id   string
+		turn string
+		seq  int
+		ok   bool
+	}{
+		{id: "abc:3", turn: "abc", seq: 3, ok: true},
+		{id: "a:b:0", turn: "a:b", seq: 0, ok: true},
+		{id: "abc", ok: false},
+		{id: ":3", ok: false},
+		{id: "abc:x", ok: false},
+		{id: "abc:-1", ok: false},
+	}
+	for _, tt := range tests {
+		turn, seq, ok := parseEventID(tt.id)
+		if turn != tt.turn || seq != tt.seq || ok != tt.ok {
+			t.Errorf("parseEventID(%q) = %q, %d, %v", tt.id, turn, seq, ok)
+		}
+	}
+	if turn, seq, _ := parseEventID(eventID("t-1", 7)); turn != "t-1" || seq != 7 {
+		t.Errorf("eventID does not round trip: %s %d", turn, seq)
+	}
+}
+
+func TestMemoryEventStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryEventStore(time.Minute)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		if err := store.Append(ctx, "k", &ResumeEvent{Seq: i, Data: "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, ok, _ := store.After(ctx, "k", 1)
+	if !ok || len(events) != 2 || events[0].Seq != 2 || events[1].Seq != 3 {
+		t.Fatalf("After(1) = %v, %v", events, ok)
+	}
+	if events, ok, _ := store.After(ctx, "k", 3); !ok || len(events) != 0 {
+		t.Errorf("After(3) = %v, %v", events, ok)
+	}
+	if _, ok, _ := store.After(ctx, "unknown", 0); ok {
+		t.Error("unknown turn should not be found")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := store.After(ctx, "k", 0); ok {
+		t.Error("turn should have expired")
+	}
+}
+
+func startTestTurn(t *testing.T, reg *turnRegistry, turnID string) string {
+	t.Helper()
+	id := newConversationID(t)
+	run, err := RunAgent(context.Background(), id, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := turnKey(id, turnID)
+	reg.start(key, run)
+	return key
+}
+
+func TestTurnReplayAfterLastEventID(t *testing.T) {
+	useModel(t, newStreamingModel("One.", "Two.", "Three."))
+	reg := newTurns(NewMemoryEventStore(time.Minute), time.Minute, &FlushPolicy{Boundaries: "."})
+	key := startTestTurn(t, reg, "turn")
+
+	pub := &recordingPublisher{}
+	if err := reg.follow(context.Background(), key, "turn", 0, pub); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"One.", "Two.", "Three.", "complete"}; !reflect.DeepEqual(pub.events, want) {
+		t.Errorf("events = %q, want %q", pub.events, want)
+	}
+	if want := []string{"turn:1", "turn:2", "turn:3", "turn:4"}; !reflect.DeepEqual(pub.ids, want) {
+		t.Errorf("ids = %q, want %q", pub.ids, want)
+	}
+
+	// A client that saw the second event reconnects.
+	resumed := &recordingPublisher{}
+	if err := reg.follow(context.Background(), key, "turn", 2, resumed); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Three.", "complete"}; !reflect.DeepEqual(resumed.events, want) {
+		t.Errorf("resumed events = %q, want %q", resumed.events, want)
+	}
+}
+
+func TestTurnInterruptedAfterGrace(t *testing.T) {
+	m := newStreamingModel("Partial.")
+	m.block = true
+	useModel(t, m)
+	reg := newTurns(NewMemoryEventStore(time.Minute), 20*time.Millisecond, &FlushPolicy{Boundaries: "."})
+	key := startTestTurn(t, reg, "turn")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pub := &recordingPublisher{}
+	errc := make(chan error, 1)
+	go func() { errc <- reg.follow(ctx, key, "turn", 0, pub) }()
+	eventually(t, func() bool {
+		events, _ := pub.snapshot()
+		return len(events) == 1
+	}, "the first event")
+	cancel()
+	if err := waitResult(t, errc); !errors.Is(err, context.Canceled) {
+		t.Fatalf("follow err = %v", err)
+	}
+
+	waitClosed(t, m.cancelled, "the run to be interrupted after the grace period")
+
+	resumed := &recordingPublisher{}
+	if err := reg.follow(context.Background(), key, "turn", 1, resumed); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"interrupted"}; !reflect.DeepEqual(resumed.events, want) {
+		t.Errorf("resumed events = %q, want %q", resumed.events, want)
+	}
+}
+
+func TestTurnReconnectWithinGrace(t *testing.T) {
+	m := newStreamingModel("Partial.")
+	m.block = true
+	useModel(t, m)
+	grace := 50 * time.Millisecond
+	reg := newTurns(NewMemoryEventStore(time.Minute), grace, &FlushPolicy{Boundaries: "."})
+	key := startTestTurn(t, reg, "turn")
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- reg.follow(first, key, "turn", 0, &recordingPublisher{}) }()
+	time.Sleep(10 * time.Millisecond)
+	cancelFirst()
+	waitResult(t, errc)
+
+	second, cancelSecond := context.WithCancelCause(context.Background())
+	go func() { errc <- reg.follow(second, key, "turn", 1, &recordingPublisher{}) }()
+
+	select {
+	case <-m.cancelled:
+		t.Fatal("run interrupted although the client reconnected")
+	case <-time.After(3 * grace):
+	}
+
+	// Shutdown interrupts right away, without a grace period.
+	cancelSecond(ErrShuttingDown)
+	waitResult(t, errc)
+	waitClosed(t, m.cancelled, "the run to be interrupted on shutdown")
+}
+
+func TestTurnNotFound(t *testing.T) {
+	reg := newTurns(NewMemoryEventStore(time.Minute), time.Minute, &FlushPolicy{})
+	if found, err := reg.exists(context.Background(), "nope"); err != nil || found {
+		t.Errorf("exists = %v, %v", found, err)
+	}
+	if err := reg.follow(context.Background(), "nope", "turn", 0, &recordingPublisher{}); !errors.Is(err, errTurnNotFound) {
+		t.Errorf("follow err = %v", err)
+	}
+}
@@ -7,22 +7,45 @@ import (
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 	"github.com/cloudwego/hertz/pkg/route"
 	"github.com/hertz-contrib/sse"
-	"io"
+	"io/fs"
 	"log"
+	"myeino/agent"
+	"myeino/middleware"
+	"myeino/util"
 	"strings"
-	"time"
 )
 
 func BindRoutes(r *route.RouterGroup) error {
-	// API 路由
-	r.GET("/api/chat", HandleChat)
+	// API 路由，配置了凭证时需要认证；浏览器的 EventSource 和 WebSocket 不能设置请求头，
+	// 只有这两个流式接口接受 access_token 查询参数
+	api := r.Group("/api")
+	if auth := newAuth(api.BasePath()+"/chat", api.BasePath()+"/chat/ws"); auth != nil {
+		api.Use(auth)
+	}
+	rateLimit := chatRateLimit()
+	api.GET("/chat", rateLimit, HandleChat)
+	api.GET("/chat/ws", rateLimit, HandleChatWS)
+	api.DELETE("/chat", HandleDeleteChat)
+	api.POST("/chat/reply", HandleReply)
+	api.GET("/tools", HandleListTools)
+	api.GET("/usage", HandleUsage)
+
+	// 管理接口
+	api.GET("/admin/limits", requireAdmin, HandleGetLimits)
+	api.PUT("/admin/limits", requireAdmin, HandleSetLimits)
 	return nil
 }
 
 func HandleChat(ctx context.Context, c *app.RequestContext) {
 	id := c.Query("id")
 	message := c.Query("message")
-	if id == "" || message == "" {
+	// 浏览器重连时会带上 Last-Event-ID，此时续传原回答而不是重新提问
+	lastEventID := sse.GetLastEventID(c)
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	if id == "" || (message == "" && lastEventID == "") {
+		metrics.ObserveChatRequest("bad_request")
 		c.JSON(consts.StatusBadRequest, map[string]string{
 			"status": "error",
 			"error":  "missing id or message parameter",
@@ -30,9 +53,44 @@ func HandleChat(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	log.Printf("[Chat] Starting chat with ID: %s, Message: %s\n", id, message)
+	requestID := string(c.GetHeader("X-Request-ID"))
+	if requestID == "" {
+		requestID = util.NewRequestID()
+	}
+	c.Header("X-Request-ID", requestID)
+	ctx = util.WithRequestID(ctx, requestID)
+	ctx = util.WithConversationID(ctx, id)
+	// 未启用认证时允许客户端通过 X-User-ID 标识用户，启用后以认证结果为准
+	if userID := string(c.GetHeader("X-User-ID")); userID != "" && middleware.PrincipalFromContext(ctx) == nil {
+		ctx = util.WithUserID(ctx, userID)
+	}
+
+	// tools=a,b 选择会话可用的工具，之后的消息沿用
+	if c.QueryArgs().Has("tools") {
+		conversationTools.set(conversationKey(ctx, id), parseToolList(c.Query("tools")))
+	}
+
+	ctx, done, err := chats.begin(ctx, requestID, id)
+	if err != nil {
+		metrics.ObserveChatRequest("unavailable")
+		c.Header("Retry-After", "5")
+		c.JSON(consts.StatusServiceUnavailable, map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+		return
+	}
+	defer done()
+
+	if lastEventID != "" {
+		resumeChat(ctx, c, id, lastEventID)
+		return
+	}
+
+	log.Printf("[Chat] Starting chat with ID: %s, Request ID: %s, Message length: %d\n", id, requestID, len(message))
+	util.WithContext(ctx).With(util.F("message", util.Redact(message))).Debug("[Chat] Message content")
 
-	sr, err := RunAgent(ctx, id, message)
+	key, turnID, err := startTurn(ctx, id, message)
 	if err != nil {
 		log.Printf("[Chat] Error running agent: %v\n", err)
 		log.Printf("[Chat] Error type: %T\n", err)
@@ -49,80 +107,127 @@ func HandleChat(ctx context.Context, c *app.RequestContext) {
 			}
 		}
 
+		metrics.ObserveChatRequest("error")
+		c.JSON(consts.StatusInternalServerError, map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+		return
+	}
+	metrics.ObserveChatRequest("ok")
+
+	followChat(ctx, c, id, key, turnID, 0)
+}
+
+// startTurn runs the agent for message. The answer is produced and buffered in the background,
+// so that a client losing its connection can resume it with Last-Event-ID.
+func startTurn(ctx context.Context, id, message string) (key, turnID string, err error) {
+	run, err := RunAgent(ctx, id, message)
+	if err != nil {
+		return "", "", err
+	}
+	turnID = util.NewRequestID()
+	key = turnKey(conversationKey(ctx, id), turnID)
+	turns.start(key, run)
+	return key, turnID, nil
+}
+
+// resumeChat continues the turn named by lastEventID after the last event the client received.
+func resumeChat(ctx context.Context, c *app.RequestContext, id, lastEventID string) {
+	turnID, seq, ok := parseEventID(lastEventID)
+	if !ok {
+		metrics.ObserveChatRequest("bad_request")
+		c.JSON(consts.StatusBadRequest, map[string]string{
+			"status": "error",
+			"error":  "invalid Last-Event-ID",
+		})
+		return
+	}
+
+	key := turnKey(conversationKey(ctx, id), turnID)
+	found, err := turns.exists(ctx, key)
+	if err != nil {
+		log.Printf("[Chat] Failed to look up turn %s: %v\n", key, err)
+		metrics.ObserveChatRequest("error")
 		c.JSON(consts.StatusInternalServerError, map[string]string{
 			"status": "error",
 			"error":  err.Error(),
 		})
 		return
 	}
+	if !found {
+		// 204 让 EventSource 停止重连
+		metrics.ObserveChatRequest("not_found")
+		c.Status(consts.StatusNoContent)
+		return
+	}
+
+	metrics.ObserveChatRequest("resumed")
+	log.Printf("[Chat] Resuming chat with ID: %s, turn: %s, after event: %d\n", id, turnID, seq)
+	followChat(ctx, c, id, key, turnID, seq)
+}
 
-	s := sse.NewStream(c)
+// followChat streams the events of a turn to the client over SSE.
+func followChat(ctx context.Context, c *app.RequestContext, id, key, turnID string, after int) {
 	defer func() {
-		sr.Close()
 		c.Flush()
-
 		log.Printf("[Chat] Finished chat with ID: %s\n", id)
 	}()
 
-	// 消息缓冲区
-	var buffer strings.Builder
-	ticker := time.NewTicker(100 * time.Millisecond) // 每100ms刷新一次缓冲区
-	defer ticker.Stop()
-
-	flushBuffer := func() error {
-		if buffer.Len() > 0 {
-			content := buffer.String()
-			buffer.Reset()
-			return s.Publish(&sse.Event{
-				Data: []byte(content),
-			})
-		}
-		return nil
+	err := turns.follow(ctx, key, turnID, after, newSSEStream(c))
+	switch {
+	case err == nil:
+		log.Printf("[Chat] EOF received for chat ID: %s\n", id)
+	case errors.Is(err, ErrClientDisconnected):
+		log.Printf("[Chat] Error publishing message: %v\n", err)
+	case ctx.Err() != nil:
+		log.Printf("[Chat] Context done for chat ID: %s: %v\n", id, err)
+	default:
+		log.Printf("[Chat] Error following chat ID: %s: %v\n", id, err)
 	}
+}
 
-outer:
-	for {
-		select {
-		case <-ctx.Done():
-			log.Printf("[Chat] Context done for chat ID: %s\n", id)
-			// 发送剩余缓冲内容
-			if err := flushBuffer(); err != nil {
-				log.Printf("[Chat] Error flushing final buffer: %v\n", err)
-			}
-			return
-		case <-ticker.C:
-			// 定时刷新缓冲区
-			if err := flushBuffer(); err != nil {
-				log.Printf("[Chat] Error flushing buffer: %v\n", err)
-				break outer
-			}
-		default:
-			msg, err := sr.Recv()
-			if errors.Is(err, io.EOF) {
-				log.Printf("[Chat] EOF received for chat ID: %s\n", id)
-				// 发送剩余缓冲内容
-				if err := flushBuffer(); err != nil {
-					log.Printf("[Chat] Error flushing final buffer on EOF: %v\n", err)
-				}
-				break outer
-			}
-			if err != nil {
-				log.Printf("[Chat] Error receiving message: %v\n", err)
-				break outer
-			}
+// interruptCause tells a shutdown from a client that went away once the request ctx is done.
+func interruptCause(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrShuttingDown) {
+		return cause
+	}
+	return ErrClientDisconnected
+}
 
-			// 将消息添加到缓冲区
-			buffer.WriteString(msg.Content)
-
-			// 如果缓冲区过大或遇到句子结束标记，立即刷新
-			if buffer.Len() > 200 || strings.HasSuffix(msg.Content, ".") ||
-				strings.HasSuffix(msg.Content, "!") || strings.HasSuffix(msg.Content, "?") ||
-				strings.HasSuffix(msg.Content, "\n") {
-				if err := flushBuffer(); err != nil {
-					log.Printf("[Chat] Error publishing message: %v\n", err)
-					break outer
-				}
-			}
-		}
+// HandleDeleteChat deletes the history and the workspace directory of the conversation named by id.
+func HandleDeleteChat(ctx context.Context, c *app.RequestContext) {
+	id := c.Query("id")
+	// 未认证时会话 ID 直接作为文件名，不能包含路径
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		c.JSON(consts.StatusBadRequest, map[string]string{
+			"status": "error",
+			"error":  "missing or invalid id parameter",
+		})
+		return
+	}
+	ctx = util.WithConversationID(ctx, id)
+	if userID := string(c.GetHeader("X-User-ID")); userID != "" && middleware.PrincipalFromContext(ctx) == nil {
+		ctx = util.WithUserID(ctx, userID)
+	}
+
+	if err := agent.RemoveWorkspace(ctx); err != nil {
+		log.Printf("[Chat] Failed to remove the workspace of chat ID: %s: %v", id, err)
+	}
+	err := memory.DeleteConversation(conversationKey(ctx, id))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		c.JSON(consts.StatusNotFound, map[string]string{
+			"status": "error",
+			"error":  "conversation not found",
+		})
+	case err != nil:
+		c.JSON(consts.StatusInternalServerError, map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+	default:
+		log.Printf("[Chat] Deleted chat ID: %s", id)
+		c.JSON(consts.StatusOK, map[string]string{"status": "ok"})
 	}
 }
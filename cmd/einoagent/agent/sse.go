@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/protocol/http1/resp"
+	"github.com/hertz-contrib/sse"
+)
+
+// FlushPolicy decides when the buffered answer is published as an SSE event.
+type FlushPolicy struct {
+	// Interval publishes buffered text at least this often, 0 only flushes on size and boundaries.
+	Interval time.Duration
+	// MaxBytes publishes as soon as the buffer holds this many bytes, 0 disables it.
+	MaxBytes int
+	// Boundaries publishes when a chunk ends with one of these characters, typically sentence ends.
+	Boundaries string
+	// Heartbeat sends a keep-alive comment when nothing was written for this long, 0 disables it.
+	// It keeps proxies from closing the connection while tools are running.
+	Heartbeat time.Duration
+}
+
+// DefaultFlushPolicy flushes every 100ms, at 200 bytes and at the end of English and Chinese sentences.
+func DefaultFlushPolicy() *FlushPolicy {
+	return &FlushPolicy{
+		Interval:   100 * time.Millisecond,
+		MaxBytes:   200,
+		Boundaries: ".!?\n。！？",
+		Heartbeat:  15 * time.Second,
+	}
+}
+
+var flushPolicy = newFlushPolicy()
+
+// newFlushPolicy overrides the defaults with SSE_FLUSH_INTERVAL, SSE_FLUSH_MAX_BYTES,
+// SSE_FLUSH_BOUNDARIES and SSE_HEARTBEAT_INTERVAL. Durations use time.ParseDuration, e.g. 250ms.
+func newFlushPolicy() *FlushPolicy {
+	p := DefaultFlushPolicy()
+	if d, ok := durationEnv("SSE_FLUSH_INTERVAL"); ok {
+		p.Interval = d
+	}
+	if raw := os.Getenv("SSE_FLUSH_MAX_BYTES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			log.Printf("[SSE] Invalid SSE_FLUSH_MAX_BYTES %q, using %d", raw, p.MaxBytes)
+		} else {
+			p.MaxBytes = n
+		}
+	}
+	if raw, ok := os.LookupEnv("SSE_FLUSH_BOUNDARIES"); ok {
+		p.Boundaries = raw
+	}
+	if d, ok := durationEnv("SSE_HEARTBEAT_INTERVAL"); ok {
+		p.Heartbeat = d
+	}
+	return p
+}
+
+func durationEnv(name string) (time.Duration, bool) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		log.Printf("[SSE] Invalid %s %q, using the default", name, raw)
+		return 0, false
+	}
+	return d, true
+}
+
+// shouldFlush reports whether a buffer of size bytes must be published after receiving chunk.
+func (p *FlushPolicy) shouldFlush(size int, chunk string) bool {
+	if p.MaxBytes > 0 && size >= p.MaxBytes {
+		return true
+	}
+	last, n := utf8.DecodeLastRuneInString(chunk)
+	return n > 0 && strings.ContainsRune(p.Boundaries, last)
+}
+
+// eventPublisher writes to the SSE response, *sseStream in production.
+type eventPublisher interface {
+	Publish(event *sse.Event) error
+	// Comment writes a comment line, which clients ignore.
+	Comment(text string) error
+}
+
+// sseStream is sse.Stream with support for comments, used as heartbeats.
+type sseStream struct {
+	w network.ExtWriter
+}
+
+func newSSEStream(c *app.RequestContext) *sseStream {
+	c.Response.Header.SetContentType("text/event-stream")
+	c.Response.Header.Set("Cache-Control", "no-cache")
+	// 避免 nginx 缓冲事件
+	c.Response.Header.Set("X-Accel-Buffering", "no")
+
+	w := resp.NewChunkedBodyWriter(&c.Response, c.GetWriter())
+	c.Response.HijackWriter(w)
+	return &sseStream{w: w}
+}
+
+func (s *sseStream) Publish(event *sse.Event) error {
+	if err := sse.Encode(s.w, event); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *sseStream) Comment(text string) error {
+	if _, err := s.w.Write([]byte(": " + text + "\n\n")); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// streamAnswer publishes sr to pub following policy until EOF. The stream is received by a pump
+// goroutine so that timed flushes, heartbeats and ctx cancellation are handled while the model or
+// a tool is busy. Publish errors are returned wrapped in ErrClientDisconnected; otherwise the error
+// is the stream error or the cause of ctx.
+func streamAnswer(ctx context.Context, sr *schema.StreamReader[*schema.Message], pub eventPublisher, policy *FlushPolicy) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	items := pumpStream(sr, stop)
+
+	var tick <-chan time.Time
+	if policy.Interval > 0 {
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var heartbeat *time.Timer
+	var beat <-chan time.Time
+	if policy.Heartbeat > 0 {
+		heartbeat = time.NewTimer(policy.Heartbeat)
+		defer heartbeat.Stop()
+		beat = heartbeat.C
+	}
+	wrote := func() {
+		if heartbeat != nil {
+			heartbeat.Reset(policy.Heartbeat)
+		}
+	}
+
+	var buffer strings.Builder
+	flush := func() error {
+		if buffer.Len() == 0 {
+			return nil
+		}
+		content := buffer.String()
+		buffer.Reset()
+		metrics.IncSSEFlush()
+		if err := pub.Publish(&sse.Event{Data: []byte(content)}); err != nil {
+			return fmt.Errorf("%w: %v", ErrClientDisconnected, err)
+		}
+		wrote()
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// 尽量发送剩余缓冲内容
+			_ = flush()
+			return context.Cause(ctx)
+		case <-tick:
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-beat:
+			if err := pub.Comment("keep-alive"); err != nil {
+				return fmt.Errorf("%w: %v", ErrClientDisconnected, err)
+			}
+			wrote()
+		case item := <-items:
+			if errors.Is(item.err, io.EOF) {
+				return flush()
+			}
+			if item.err != nil {
+				if err := flush(); err != nil {
+					return err
+				}
+				return item.err
+			}
+			if ev, ok := approvalOf(item.chunk); ok {
+				if err := flush(); err != nil {
+					return err
+				}
+				data, _ := json.Marshal(ev)
+				if err := pub.Publish(&sse.Event{Event: approvalEvent, Data: data}); err != nil {
+					return fmt.Errorf("%w: %v", ErrClientDisconnected, err)
+				}
+				wrote()
+				continue
+			}
+			if item.chunk == nil || item.chunk.Content == "" {
+				continue
+			}
+			buffer.WriteString(item.chunk.Content)
+			if policy.shouldFlush(buffer.Len(), item.chunk.Content) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/hertz-contrib/sse"
+)
+
+// recordingPublisher collects published events and comments, failing with err when set.
+type recordingPublisher struct {
+	mu       sync.Mutex
+	events   []string
+	ids      []string
+	comments int
+	err      error
+}
+
+func (p *recordingPublisher) Publish(event *sse.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, string(event.Data))
+	p.ids = append(p.ids, event.ID)
+	return nil
+}
+
+func (p *recordingPublisher) Comment(text string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.comments++
+	return nil
+}
+
+func (p *recordingPublisher) snapshot() ([]string, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.events...), p.comments
+}
+
+// eventually polls cond until it holds or a second has passed.
+func eventually(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func startStream(ctx context.Context, policy *FlushPolicy, pub eventPublisher) (*schema.StreamWriter[*schema.Message], <-chan error) {
+	sr, sw := schema.Pipe[*schema.Message](0)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- streamAnswer(ctx, sr, pub, policy)
+	}()
+	return sw, errc
+}
+
+func waitResult(t *testing.T, errc <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("streamAnswer did not return")
+		return nil
+	}
+}
+
+func TestStreamAnswerFlushPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *FlushPolicy
+		chunks []string
+		want   []string
+	}{
+		{
+			name:   "english sentence",
+			policy: &FlushPolicy{Boundaries: ".!?"},
+			chunks: []string{"Hi", " there.", " More"},
+			want:   []string{"Hi there.", " More"},
+		},
+		{
+			name:   "chinese sentence",
+			policy: DefaultFlushPolicy(),
+			chunks: []string{"你好", "。", "今天", "天气不错！", "走吧"},
+			want:   []string{"你好。", "今天天气不错！", "走吧"},
+		},
+		{
+			name:   "max bytes",
+			policy: &FlushPolicy{MaxBytes: 4},
+			chunks: []string{"ab", "cd", "e"},
+			want:   []string{"abcd", "e"},
+		},
+		{
+			name:   "no policy",
+			policy: &FlushPolicy{},
+			chunks: []string{"a.", "b\n", "c"},
+			want:   []string{"a.b\nc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Timed flushes are disabled so that only sizes and boundaries split the events.
+			tt.policy.Interval = 0
+			tt.policy.Heartbeat = 0
+			pub := &recordingPublisher{}
+			sw, errc := startStream(context.Background(), tt.policy, pub)
+			for _, c := range tt.chunks {
+				sw.Send(schema.AssistantMessage(c, nil), nil)
+			}
+			sw.Close()
+			if err := waitResult(t, errc); err != nil {
+				t.Fatal(err)
+			}
+
+			events, _ := pub.snapshot()
+			if len(events) != len(tt.want) {
+				t.Fatalf("events = %q, want %q", events, tt.want)
+			}
+			for i := range events {
+				if events[i] != tt.want[i] {
+					t.Errorf("event %d = %q, want %q", i, events[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStreamAnswerBoundaryFlushesBeforeEOF(t *testing.T) {
+	pub := &recordingPublisher{}
+	sw, errc := startStream(context.Background(), &FlushPolicy{Boundaries: "。"}, pub)
+
+	sw.Send(schema.AssistantMessage("第一句。", nil), nil)
+	eventually(t, func() bool {
+		events, _ := pub.snapshot()
+		return len(events) == 1
+	}, "the sentence to be published")
+
+	sw.Close()
+	if err := waitResult(t, errc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamAnswerFlushesOnIntervalWhileWaiting(t *testing.T) {
+	pub := &recordingPublisher{}
+	sw, errc := startStream(context.Background(), &FlushPolicy{Interval: 10 * time.Millisecond}, pub)
+
+	// No boundary and the stream stays open, only the ticker can publish it.
+	sw.Send(schema.AssistantMessage("thinking", nil), nil)
+	eventually(t, func() bool {
+		events, _ := pub.snapshot()
+		return len(events) == 1 && events[0] == "thinking"
+	}, "the timed flush")
+
+	sw.Close()
+	if err := waitResult(t, errc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamAnswerHeartbeat(t *testing.T) {
+	pub := &recordingPublisher{}
+	sw, errc := startStream(context.Background(), &FlushPolicy{Heartbeat: 10 * time.Millisecond}, pub)
+
+	eventually(t, func() bool {
+		_, comments := pub.snapshot()
+		return comments >= 2
+	}, "heartbeats")
+
+	sw.Close()
+	if err := waitResult(t, errc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamAnswerStopsOnCancelWhileBlocked(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	pub := &recordingPublisher{}
+	sw, errc := startStream(ctx, &FlushPolicy{Boundaries: "."}, pub)
+	defer sw.Close()
+
+	sw.Send(schema.AssistantMessage("Calling a tool.", nil), nil)
+	eventually(t, func() bool {
+		events, _ := pub.snapshot()
+		return len(events) == 1
+	}, "the first sentence")
+
+	// The stream is idle while the tool runs, cancellation must not wait for the next chunk.
+	cancel(ErrShuttingDown)
+	if err := waitResult(t, errc); !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("err = %v, want %v", err, ErrShuttingDown)
+	}
+}
+
+func TestStreamAnswerPublishError(t *testing.T) {
+	pub := &recordingPublisher{err: errors.New("broken pipe")}
+	sw, errc := startStream(context.Background(), &FlushPolicy{Boundaries: "."}, pub)
+	defer sw.Close()
+
+	sw.Send(schema.AssistantMessage("Hello.", nil), nil)
+	if err := waitResult(t, errc); !errors.Is(err, ErrClientDisconnected) {
+		t.Fatalf("err = %v, want %v", err, ErrClientDisconnected)
+	}
+}
+
+func TestStreamAnswerStreamError(t *testing.T) {
+	pub := &recordingPublisher{}
+	sw, errc := startStream(context.Background(), &FlushPolicy{}, pub)
+
+	sw.Send(schema.AssistantMessage("partial", nil), nil)
+	sw.Send(nil, errors.New("model failed"))
+	sw.Close()
+	if err := waitResult(t, errc); err == nil || err.Error() != "model failed" {
+		t.Fatalf("err = %v", err)
+	}
+	if events, _ := pub.snapshot(); len(events) != 1 {
+		t.Errorf("buffered text not flushed before the error: %q", events)
+	}
+}
+
+func TestNewFlushPolicyFromEnv(t *testing.T) {
+	t.Setenv("SSE_FLUSH_INTERVAL", "250ms")
+	t.Setenv("SSE_FLUSH_MAX_BYTES", "64")
+	t.Setenv("SSE_FLUSH_BOUNDARIES", "。")
+	t.Setenv("SSE_HEARTBEAT_INTERVAL", "bogus")
+
+	p := newFlushPolicy()
+	if p.Interval != 250*time.Millisecond || p.MaxBytes != 64 || p.Boundaries != "。" {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+	if p.Heartbeat != DefaultFlushPolicy().Heartbeat {
+		t.Errorf("invalid heartbeat should keep the default, got %v", p.Heartbeat)
+	}
+}
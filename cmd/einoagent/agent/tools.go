@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"myeino/agent"
+	"myeino/tool/registry"
+)
+
+// toolChoiceRetention is how long the tools chosen by a conversation are kept after its last message.
+const toolChoiceRetention = 24 * time.Hour
+
+// toolChoices remembers the tools chosen by each conversation, later messages keep them.
+type toolChoices struct {
+	mu        sync.Mutex
+	retention time.Duration
+	choices   map[string]*toolChoice
+	sets      int
+	now       func() time.Time
+}
+
+type toolChoice struct {
+	names   []string
+	expires time.Time
+}
+
+var conversationTools = newToolChoices(toolChoiceRetention)
+
+// newToolChoices creates choices forgotten retention after the last message of their conversation.
+func newToolChoices(retention time.Duration) *toolChoices {
+	return &toolChoices{retention: retention, choices: map[string]*toolChoice{}, now: time.Now}
+}
+
+func (t *toolChoices) set(convKey string, names []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sets++
+	if t.sets%256 == 0 {
+		for k, c := range t.choices {
+			if now.After(c.expires) {
+				delete(t.choices, k)
+			}
+		}
+	}
+	t.choices[convKey] = &toolChoice{names: names, expires: now.Add(t.retention)}
+}
+
+// get returns the tools chosen by the conversation and keeps them for another retention.
+func (t *toolChoices) get(convKey string) ([]string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	c, ok := t.choices[convKey]
+	if !ok {
+		return nil, false
+	}
+	if now.After(c.expires) {
+		delete(t.choices, convKey)
+		return nil, false
+	}
+	c.expires = now.Add(t.retention)
+	return c.names, true
+}
+
+// apply passes the tools chosen by the conversation to the agent, see registry.WithTools.
+func (t *toolChoices) apply(ctx context.Context, convKey string) context.Context {
+	if names, ok := t.get(convKey); ok {
+		return registry.WithTools(ctx, names)
+	}
+	return ctx
+}
+
+// parseToolList parses the comma separated tools parameter, an empty list disables all tools.
+func parseToolList(raw string) []string {
+	names := []string{}
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// HandleListTools lists the tools available to the caller with the JSON schemas of their parameters.
+// With ?id=<conversation ID>, enabled reflects the tools chosen by that conversation.
+func HandleListTools(ctx context.Context, c *app.RequestContext) {
+	tools, err := agent.AvailableTools(ctx)
+	if err != nil {
+		c.JSON(consts.StatusInternalServerError, map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+		return
+	}
+	if id := c.Query("id"); id != "" {
+		if chosen, ok := conversationTools.get(conversationKey(ctx, id)); ok {
+			markChosen(tools, chosen)
+		}
+	}
+	c.JSON(consts.StatusOK, map[string]any{"tools": tools})
+}
+
+// markChosen enables the tools chosen by a conversation, the tools of a group are chosen by its name.
+func markChosen(tools []*agent.ToolDescription, chosen []string) {
+	for _, t := range tools {
+		t.Enabled = slices.Contains(chosen, cmp.Or(t.Group, t.Name))
+	}
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"myeino/agent"
+	"myeino/tool/registry"
+)
+
+func TestConversationTools(t *testing.T) {
+	if got := parseToolList(" open, ,duckduckgo_text_search "); !slices.Equal(got, []string{"open", "duckduckgo_text_search"}) {
+		t.Errorf("parseToolList() = %v", got)
+	}
+
+	choices := newToolChoices(time.Hour)
+	ctx := choices.apply(context.Background(), "c1")
+	if _, ok := registry.ToolsFromContext(ctx); ok {
+		t.Error("tools chosen for a conversation without a choice")
+	}
+
+	choices.set("c1", parseToolList(""))
+	names, ok := registry.ToolsFromContext(choices.apply(context.Background(), "c1"))
+	if !ok || len(names) != 0 {
+		t.Errorf("empty choice not kept: %v, %v", names, ok)
+	}
+
+	// 会话不再使用时选择被忘记
+	now := time.Now()
+	choices.now = func() time.Time { return now }
+	choices.set("c2", []string{"open"})
+	now = now.Add(30 * time.Minute)
+	if _, ok := choices.get("c2"); !ok {
+		t.Error("choice forgotten before its retention")
+	}
+	now = now.Add(50 * time.Minute)
+	if _, ok := choices.get("c2"); !ok {
+		t.Error("choice forgotten although used within its retention")
+	}
+	now = now.Add(2 * time.Hour)
+	if _, ok := choices.get("c2"); ok {
+		t.Error("choice kept after its retention")
+	}
+	if _, ok := choices.choices["c2"]; ok {
+		t.Error("expired choice not removed")
+	}
+}
+
+func TestMarkChosen(t *testing.T) {
+	tools := []*agent.ToolDescription{
+		{Name: "open", Enabled: true},
+		{Name: "duckduckgo_text_search"},
+		{Name: "add_task", Group: "task_manager", Enabled: true},
+		{Name: "list_tasks", Group: "task_manager", Enabled: true},
+		{Name: "read_file", Group: "mcp:filesystem"},
+	}
+	markChosen(tools, []string{"duckduckgo_text_search", "mcp:filesystem", "add_task"})
+	want := map[string]bool{"open": false, "duckduckgo_text_search": true, "add_task": false, "list_tasks": false, "read_file": true}
+	for _, tool := range tools {
+		if tool.Enabled != want[tool.Name] {
+			t.Errorf("%s enabled = %v, want %v", tool.Name, tool.Enabled, want[tool.Name])
+		}
+	}
+}
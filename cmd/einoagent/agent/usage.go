@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"myeino/middleware"
+	"myeino/usage"
+	"myeino/util"
+)
+
+var usageStore = newUsageStore()
+
+// newUsageStore creates the token usage store in data/usage.
+// Set USAGE_PRICE_FILE to a JSON price table to override the default prices.
+func newUsageStore() *usage.Store {
+	prices := usage.DefaultPriceTable()
+	if path := os.Getenv("USAGE_PRICE_FILE"); path != "" {
+		p, err := usage.LoadPriceTable(path)
+		if err != nil {
+			log.Printf("[Usage] Failed to load price table, using defaults: %v", err)
+		} else {
+			prices = p
+		}
+	}
+
+	store, err := usage.NewStore(&usage.StoreConfig{Dir: "data/usage", Prices: prices})
+	if err != nil {
+		log.Printf("[Usage] Usage accounting disabled: %v", err)
+		return nil
+	}
+	return store
+}
+
+// HandleUsage returns aggregated token usage and cost.
+// Query parameters (all optional): id (conversation), user_id, day or from/to (YYYY-MM-DD, UTC), records=true.
+// Only the records of the retention period of the store are reported, see usage.DefaultRetention.
+func HandleUsage(ctx context.Context, c *app.RequestContext) {
+	if usageStore == nil {
+		c.JSON(consts.StatusServiceUnavailable, map[string]string{
+			"status": "error",
+			"error":  "usage accounting is disabled",
+		})
+		return
+	}
+
+	// 用量按租户隔离，不同租户的用户 ID 和会话 ID 可能相同
+	filter := usage.Filter{
+		TenantID:       util.TenantIDFromContext(ctx),
+		ConversationID: c.Query("id"),
+		UserID:         c.Query("user_id"),
+		From:           c.Query("from"),
+		To:             c.Query("to"),
+	}
+	// 普通用户只能查看自己的用量
+	if p := middleware.PrincipalFromContext(ctx); p != nil && !p.HasRole(middleware.RoleAdmin) {
+		filter.UserID = p.UserID
+	}
+	if day := c.Query("day"); day != "" {
+		filter.From, filter.To = day, day
+	}
+	for _, d := range []string{filter.From, filter.To} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(usage.DayLayout, d); err != nil {
+			c.JSON(consts.StatusBadRequest, map[string]string{
+				"status": "error",
+				"error":  "invalid day, expected YYYY-MM-DD: " + d,
+			})
+			return
+		}
+	}
+
+	c.JSON(consts.StatusOK, usageStore.Query(filter, c.Query("records") == "true"))
+}
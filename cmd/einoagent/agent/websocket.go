@@ -0,0 +1,383 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/adaptor"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/gorilla/websocket"
+	"github.com/hertz-contrib/sse"
+	"myeino/middleware"
+	"myeino/usage"
+	"myeino/util"
+)
+
+const (
+	// wsMaxMessageBytes bounds client messages, questions are short.
+	wsMaxMessageBytes = 64 << 10
+	wsWriteTimeout    = 10 * time.Second
+	// wsMaxTurns bounds the turns a connection starts or follows at once.
+	wsMaxTurns = 4
+)
+
+var errTooManyTurns = errors.New("too many turns running on this connection")
+
+// ErrCanceledByUser interrupts a turn cancelled by its client.
+var ErrCanceledByUser = errors.New("canceled by user")
+
+var errNotWebSocket = errors.New("not a websocket handshake")
+
+// Client to server message types.
+const (
+	wsChat    = "chat"
+	wsResume  = "resume"
+	wsCancel  = "cancel"
+	wsApprove = "approve"
+	wsDeny    = "deny"
+	wsInput   = "input"
+)
+
+// wsClientMessage is a message sent by the client.
+type wsClientMessage struct {
+	Type string `json:"type"`
+	// ID is the conversation ID.
+	ID      string `json:"id"`
+	Message string `json:"message,omitempty"`
+	// Tools chooses the tools of the conversation with a chat message, like the tools parameter of SSE.
+	Tools *[]string `json:"tools,omitempty"`
+	// LastEventID resumes a turn, like the Last-Event-ID header of SSE.
+	LastEventID string `json:"last_event_id,omitempty"`
+	// TurnID names the turn to cancel.
+	TurnID string `json:"turn_id,omitempty"`
+	// RequestID names the approval or input request being answered.
+	RequestID string `json:"request_id,omitempty"`
+	Text      string `json:"text,omitempty"`
+}
+
+// wsEvent is a message sent to the client. Type is "started" when a turn begins, "error" when a
+// client message fails, otherwise the SSE event type: "message" for answer text, "approval" for a
+// tool call waiting for approve or deny, and "done" at the end.
+type wsEvent struct {
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`
+	TurnID    string `json:"turn_id,omitempty"`
+	EventID   string `json:"event_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+var wsUpgrader = newWSUpgrader()
+
+// newWSUpgrader only accepts browsers from the same origin, plus the origins listed in WS_ALLOWED_ORIGINS.
+func newWSUpgrader() *websocket.Upgrader {
+	allowed := map[string]bool{}
+	for _, origin := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowed[origin] = true
+		}
+	}
+	return &websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" || allowed[origin] {
+				return true
+			}
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		},
+	}
+}
+
+// HandleChatWS serves chats over a WebSocket. It carries the events of the SSE endpoint as JSON
+// messages and accepts control messages to cancel a turn, approve or deny a tool call and answer
+// questions, next to starting and resuming turns.
+func HandleChatWS(ctx context.Context, c *app.RequestContext) {
+	if userID := string(c.GetHeader("X-User-ID")); userID != "" && middleware.PrincipalFromContext(ctx) == nil {
+		ctx = util.WithUserID(ctx, userID)
+	}
+
+	err := upgradeWebSocket(c, func(conn *websocket.Conn) {
+		// the connection outlives the handler, its ctx only carries the caller's identity
+		newWSSession(context.WithoutCancel(ctx), conn).serve()
+	})
+	if err != nil {
+		c.JSON(consts.StatusBadRequest, map[string]string{
+			"status": "error",
+			"error":  err.Error(),
+		})
+	}
+}
+
+// upgradeWebSocket switches the connection to the WebSocket protocol once the Hertz handler has
+// returned and runs handler on it.
+func upgradeWebSocket(c *app.RequestContext, handler func(conn *websocket.Conn)) error {
+	req, err := adaptor.GetCompatRequest(&c.Request)
+	if err != nil {
+		return err
+	}
+	if !websocket.IsWebSocketUpgrade(req) {
+		return errNotWebSocket
+	}
+
+	// Hertz must not write a response, the upgrader writes the handshake on the raw connection.
+	c.Response.HijackWriter(discardWriter{})
+	c.Hijack(func(conn network.Conn) {
+		ws, err := wsUpgrader.Upgrade(&hijackResponse{conn: conn, header: http.Header{}}, req, nil)
+		if err != nil {
+			log.Printf("[ChatWS] Handshake failed: %v", err)
+			return
+		}
+		handler(ws)
+	})
+	return nil
+}
+
+// discardWriter replaces the Hertz response of a hijacked connection.
+type discardWriter struct{}
+
+func (discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (discardWriter) Flush() error                { return nil }
+func (discardWriter) Finalize() error             { return nil }
+
+// hijackResponse lets the upgrader take over the connection hijacked from Hertz.
+type hijackResponse struct {
+	conn   net.Conn
+	header http.Header
+	wrote  bool
+}
+
+func (h *hijackResponse) Header() http.Header {
+	return h.header
+}
+
+// WriteHeader is only used by the upgrader to reject a handshake.
+func (h *hijackResponse) WriteHeader(status int) {
+	if h.wrote {
+		return
+	}
+	h.wrote = true
+	fmt.Fprintf(h.conn, "HTTP/1.1 %d %s\r\nConnection: close\r\n\r\n", status, http.StatusText(status))
+}
+
+func (h *hijackResponse) Write(p []byte) (int, error) {
+	h.WriteHeader(http.StatusOK)
+	return h.conn.Write(p)
+}
+
+func (h *hijackResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+// wsSession is a client connection, it may follow several turns at once.
+type wsSession struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	conn   *websocket.Conn
+
+	writeMu sync.Mutex
+	turns   sync.WaitGroup
+	// slots holds a token per running turn, see wsMaxTurns.
+	slots chan struct{}
+}
+
+func newWSSession(ctx context.Context, conn *websocket.Conn) *wsSession {
+	ctx, cancel := context.WithCancel(ctx)
+	conn.SetReadLimit(wsMaxMessageBytes)
+	return &wsSession{ctx: ctx, cancel: cancel, conn: conn, slots: make(chan struct{}, wsMaxTurns)}
+}
+
+// goTurn runs turn in the background if the connection has a free slot.
+func (s *wsSession) goTurn(turn func()) error {
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		return errTooManyTurns
+	}
+	s.turns.Add(1)
+	go func() {
+		defer func() {
+			<-s.slots
+			s.turns.Done()
+		}()
+		turn()
+	}()
+	return nil
+}
+
+// serve reads client messages until the connection closes. Turns left without a client are
+// interrupted after the resume grace period, like SSE streams.
+func (s *wsSession) serve() {
+	defer func() {
+		s.cancel()
+		s.turns.Wait()
+		s.conn.Close()
+	}()
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("[ChatWS] Connection closed: %v", err)
+			}
+			return
+		}
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.send(&wsEvent{Type: "error", Error: "invalid message: " + err.Error()})
+			continue
+		}
+		if err := s.handle(&msg); err != nil {
+			s.send(&wsEvent{Type: "error", ID: msg.ID, TurnID: msg.TurnID, RequestID: msg.RequestID, Error: err.Error()})
+		}
+	}
+}
+
+func (s *wsSession) handle(msg *wsClientMessage) error {
+	if msg.ID == "" {
+		return errors.New("missing id")
+	}
+	convKey := conversationKey(s.ctx, msg.ID)
+
+	switch msg.Type {
+	case wsChat:
+		if msg.Message == "" {
+			return errors.New("missing message")
+		}
+		// the handshake went through the rate limit once, every message is a request of its own
+		if err := chatLimiter().Allow(s.ctx, middleware.RateLimitKeyFromContext(s.ctx), usage.CallerFromContext(s.ctx)); err != nil {
+			metrics.ObserveChatRequest("limited")
+			return err
+		}
+		if msg.Tools != nil {
+			conversationTools.set(convKey, *msg.Tools)
+		}
+		return s.goTurn(func() { s.chat(msg) })
+	case wsResume:
+		turnID, seq, ok := parseEventID(msg.LastEventID)
+		if !ok {
+			return errors.New("invalid last_event_id")
+		}
+		key := turnKey(convKey, turnID)
+		found, err := turns.exists(s.ctx, key)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errTurnNotFound
+		}
+		if err := s.goTurn(func() { s.follow(s.ctx, msg.ID, key, turnID, seq) }); err != nil {
+			return err
+		}
+		metrics.ObserveChatRequest("resumed")
+	case wsCancel:
+		if !turns.interrupt(turnKey(convKey, msg.TurnID), ErrCanceledByUser) {
+			return errors.New("turn is not running")
+		}
+		log.Printf("[ChatWS] Turn %s of chat ID: %s canceled by the client", msg.TurnID, msg.ID)
+	case wsApprove:
+		return interactions.resolve(s.ctx, convKey, msg.RequestID, Reply{Approved: true})
+	case wsDeny:
+		return interactions.resolve(s.ctx, convKey, msg.RequestID, Reply{Reason: msg.Text})
+	case wsInput:
+		if msg.Text == "" {
+			return errors.New("missing text")
+		}
+		return interactions.resolve(s.ctx, convKey, msg.RequestID, Reply{Input: msg.Text})
+	default:
+		return fmt.Errorf("unknown message type %q", msg.Type)
+	}
+	return nil
+}
+
+// chat starts a turn and streams it to the client, like HandleChat.
+func (s *wsSession) chat(msg *wsClientMessage) {
+	requestID := util.NewRequestID()
+	ctx := util.WithRequestID(s.ctx, requestID)
+	ctx = util.WithConversationID(ctx, msg.ID)
+
+	ctx, done, err := chats.begin(ctx, requestID, msg.ID)
+	if err != nil {
+		metrics.ObserveChatRequest("unavailable")
+		s.send(&wsEvent{Type: "error", ID: msg.ID, Error: err.Error()})
+		return
+	}
+	defer done()
+
+	log.Printf("[ChatWS] Starting chat with ID: %s, Request ID: %s, Message length: %d", msg.ID, requestID, len(msg.Message))
+	key, turnID, err := startTurn(ctx, msg.ID, msg.Message)
+	if err != nil {
+		log.Printf("[ChatWS] Error running agent: %v", err)
+		metrics.ObserveChatRequest("error")
+		s.send(&wsEvent{Type: "error", ID: msg.ID, Error: err.Error()})
+		return
+	}
+	metrics.ObserveChatRequest("ok")
+
+	s.send(&wsEvent{Type: "started", ID: msg.ID, TurnID: turnID})
+	s.follow(ctx, msg.ID, key, turnID, 0)
+}
+
+func (s *wsSession) follow(ctx context.Context, id, key, turnID string, after int) {
+	err := turns.follow(ctx, key, turnID, after, &wsPublisher{session: s, id: id, turnID: turnID})
+	switch {
+	case err == nil, errors.Is(err, ErrClientDisconnected), ctx.Err() != nil:
+	default:
+		log.Printf("[ChatWS] Error following chat ID: %s: %v", id, err)
+		s.send(&wsEvent{Type: "error", ID: id, TurnID: turnID, Error: err.Error()})
+	}
+}
+
+func (s *wsSession) send(ev *wsEvent) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return s.conn.WriteJSON(ev)
+}
+
+// wsPublisher writes the events of a turn to a WebSocket session.
+type wsPublisher struct {
+	session *wsSession
+	id      string
+	turnID  string
+}
+
+func (p *wsPublisher) Publish(event *sse.Event) error {
+	typ := event.Event
+	if typ == "" {
+		typ = "message"
+	}
+	ev := &wsEvent{Type: typ, ID: p.id, TurnID: p.turnID, EventID: event.ID, Data: string(event.Data)}
+	if typ == approvalEvent {
+		var approval ApprovalEvent
+		if err := json.Unmarshal(event.Data, &approval); err == nil {
+			ev.RequestID = approval.RequestID
+		}
+	}
+	return p.session.send(ev)
+}
+
+// Comment sends a ping, browsers answer it without involving the page.
+func (p *wsPublisher) Comment(string) error {
+	s := p.session
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+}
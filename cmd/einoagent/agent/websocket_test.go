@@ -0,0 +1,283 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/gorilla/websocket"
+	"myeino/middleware"
+	"myeino/util"
+)
+
+// startTestServer serves the routes added by register on a local port and returns its address.
+func startTestServer(t *testing.T, register func(h *server.Hertz)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	h := server.New(server.WithHostPorts(addr), server.WithDisablePrintRoute(true))
+	register(h)
+	go h.Run()
+	t.Cleanup(func() { _ = h.Close() })
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return addr
+}
+
+// startWSServer serves HandleChatWS on a local port and returns its URL.
+func startWSServer(t *testing.T) string {
+	t.Helper()
+	return startLimitedWSServer(t, nil)
+}
+
+// startLimitedWSServer is startWSServer where the connections go through a rate limit bucket of their
+// own, limited by limit if not nil.
+func startLimitedWSServer(t *testing.T, limit *middleware.Limit) string {
+	t.Helper()
+	bucket := "test:" + t.Name() + "/" + util.NewRequestID()
+	if limit != nil {
+		orig := limits.Get()
+		settings := *orig
+		settings.Overrides = map[string]middleware.Limit{bucket: *limit}
+		if err := limits.Set(&settings); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = limits.Set(orig) })
+	}
+	rateLimit := middleware.RateLimit(&middleware.RateLimitConfig{
+		KeyFunc: func(ctx context.Context, c *app.RequestContext) string { return bucket },
+	})
+	addr := startTestServer(t, func(h *server.Hertz) {
+		h.GET("/ws", rateLimit, HandleChatWS)
+	})
+	return "ws://" + addr + "/ws"
+}
+
+func dialWS(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) *wsEvent {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var ev wsEvent
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatal(err)
+	}
+	return &ev
+}
+
+func TestChatWSStreamsTurn(t *testing.T) {
+	useModel(t, newStreamingModel("Hello.", " Bye."))
+	conn := dialWS(t, startWSServer(t))
+
+	id := newConversationID(t)
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsChat, ID: id, Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	started := readEvent(t, conn)
+	if started.Type != "started" || started.TurnID == "" {
+		t.Fatalf("unexpected first event: %+v", started)
+	}
+	var text string
+	for {
+		ev := readEvent(t, conn)
+		if ev.TurnID != started.TurnID {
+			t.Fatalf("event of another turn: %+v", ev)
+		}
+		if ev.Type == doneEvent {
+			if ev.Data != "complete" || ev.EventID == "" {
+				t.Errorf("unexpected done event: %+v", ev)
+			}
+			break
+		}
+		if ev.Type != "message" {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+		text += ev.Data
+	}
+	if text != "Hello. Bye." {
+		t.Errorf("answer = %q", text)
+	}
+}
+
+func TestChatWSCancel(t *testing.T) {
+	m := newStreamingModel("Thinking.")
+	m.block = true
+	useModel(t, m)
+	conn := dialWS(t, startWSServer(t))
+
+	id := newConversationID(t)
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsChat, ID: id, Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	started := readEvent(t, conn)
+	if ev := readEvent(t, conn); ev.Type != "message" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsCancel, ID: id, TurnID: started.TurnID}); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, m.cancelled, "the model to be cancelled")
+	if ev := readEvent(t, conn); ev.Type != doneEvent || ev.Data != "interrupted" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	msgs := history(t, id)
+	if len(msgs) != 2 || msgs[1].Extra[ExtraInterruptReason] != ErrCanceledByUser.Error() {
+		t.Errorf("unexpected history: %v", msgs)
+	}
+}
+
+func TestChatWSReplies(t *testing.T) {
+	conn := dialWS(t, startWSServer(t))
+	id := newConversationID(t)
+
+	replies := make(chan Reply, 1)
+	interactions.register(id, "req-1", false, func(ctx context.Context, r Reply) error {
+		replies <- r
+		return nil
+	})
+
+	// Input does not answer an approval, the request stays pending.
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsInput, ID: id, RequestID: "req-1", Text: "yes"}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := readEvent(t, conn); ev.Type != "error" || ev.Error != ErrInputNotExpected.Error() {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsDeny, ID: id, RequestID: "req-1", Text: "too risky"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-replies:
+		if r.Approved || r.Reason != "too risky" {
+			t.Errorf("unexpected reply: %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reply not delivered")
+	}
+
+	// The request has been answered, a second reply is rejected.
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsApprove, ID: id, RequestID: "req-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := readEvent(t, conn); ev.Type != "error" || ev.Error != ErrNoPendingRequest.Error() {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	if err := conn.WriteJSON(map[string]string{"type": "pause", "id": id}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := readEvent(t, conn); ev.Type != "error" {
+		t.Errorf("unknown message type accepted: %+v", ev)
+	}
+}
+
+func TestChatWSLimitsTurns(t *testing.T) {
+	m := newStreamingModel("Thinking.")
+	m.block = true
+	useModel(t, m)
+	conn := dialWS(t, startWSServer(t))
+
+	var started []*wsEvent
+	for i := range wsMaxTurns {
+		if err := conn.WriteJSON(&wsClientMessage{Type: wsChat, ID: newConversationID(t), Message: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			ev := readEvent(t, conn)
+			if ev.Type == "started" {
+				started = append(started, ev)
+				break
+			} else if ev.Type == "error" {
+				t.Fatalf("turn %d rejected: %+v", i, ev)
+			}
+		}
+	}
+	t.Cleanup(func() {
+		for _, ev := range started {
+			_ = conn.WriteJSON(&wsClientMessage{Type: wsCancel, ID: ev.ID, TurnID: ev.TurnID})
+		}
+	})
+
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsChat, ID: newConversationID(t), Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		ev := readEvent(t, conn)
+		if ev.Type == "error" {
+			if ev.Error != errTooManyTurns.Error() {
+				t.Errorf("unexpected error: %+v", ev)
+			}
+			break
+		}
+		if ev.Type == "started" {
+			t.Fatal("turn over the limit started")
+		}
+	}
+}
+
+func TestChatWSLimitsMessages(t *testing.T) {
+	useModel(t, newStreamingModel("Hello."))
+	conn := dialWS(t, startLimitedWSServer(t, &middleware.Limit{Rate: 0.001, Burst: 1}))
+
+	id := newConversationID(t)
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsChat, ID: id, Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	for ev := readEvent(t, conn); ev.Type != doneEvent; ev = readEvent(t, conn) {
+		if ev.Type == "error" {
+			t.Fatalf("first message rejected: %+v", ev)
+		}
+	}
+
+	if err := conn.WriteJSON(&wsClientMessage{Type: wsChat, ID: id, Message: "again"}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := readEvent(t, conn); ev.Type != "error" || !strings.HasPrefix(ev.Error, "rate limit exceeded") {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+}
+
+func TestChatWSRejectsPlainRequests(t *testing.T) {
+	engine := route.NewEngine(config.NewOptions(nil))
+	engine.GET("/ws", HandleChatWS)
+	w := ut.PerformRequest(engine, consts.MethodGet, "/ws", nil)
+	if w.Code != consts.StatusBadRequest {
+		t.Errorf("status = %d", w.Code)
+	}
+}
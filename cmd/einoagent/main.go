@@ -2,17 +2,180 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/server"
+	"io"
 	"log"
 	"myeino/cmd/einoagent/agent"
+	"myeino/middleware"
+	"myeino/telemetry"
+	"myeino/util"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var port = "8080"
 
+// setupLogger 根据环境变量配置全局日志：
+// LOG_FORMAT=json 输出JSON，LOG_LEVEL=debug 输出调试日志，LOG_FILE 指定滚动日志文件（同时输出到stdout），
+// LOG_REDACT_PATTERNS 为额外的脱敏正则（JSON字符串数组）。
+// 全局logger同时被安装为 slog 默认处理器，标准库 log 的输出也会走同一格式和输出目标。
+func setupLogger() {
+	util.SetExitOnFatal(true)
+
+	if os.Getenv("LOG_FORMAT") == "json" {
+		util.SetFormat(util.JSONFormat)
+		util.SetColorEnabled(false)
+	}
+	if os.Getenv("LOG_LEVEL") == "debug" {
+		util.SetLogLevel(util.DEBUG)
+	}
+
+	writers := []io.Writer{os.Stdout}
+	if path := os.Getenv("LOG_FILE"); path != "" {
+		fw, err := util.NewRotatingFileWriter(path, 100<<20, 5)
+		if err != nil {
+			log.Fatal("failed to open log file:", err)
+		}
+		writers = append(writers, fw)
+		util.SetColorEnabled(false)
+	}
+	util.SetOutput(writers...)
+	util.InstallAsSlogDefault()
+
+	if raw := os.Getenv("LOG_REDACT_PATTERNS"); raw != "" {
+		var patterns []string
+		if err := json.Unmarshal([]byte(raw), &patterns); err != nil {
+			util.Fatalf("invalid LOG_REDACT_PATTERNS: %v", err)
+		}
+		for i, p := range patterns {
+			if err := util.AddRedactPattern(fmt.Sprintf("custom_%d", i), p); err != nil {
+				util.Fatalf("invalid LOG_REDACT_PATTERNS: %v", err)
+			}
+		}
+	}
+}
+
+// setupTracing 根据环境变量配置链路追踪，返回的 Tracer 在服务退出时需要 Shutdown：
+// TRACE_EXPORTER=otlp 通过 OTLP/HTTP 上报到 OTEL_EXPORTER_OTLP_ENDPOINT（默认 http://localhost:4318），
+// OTEL_EXPORTER_OTLP_HEADERS 为 k1=v1,k2=v2 格式的请求头；
+// TRACE_EXPORTER=file 以JSON行写入 TRACE_FILE（默认 log/traces.jsonl）；未设置时不开启追踪。
+func setupTracing() *telemetry.Tracer {
+	var (
+		exporter telemetry.SpanExporter
+		err      error
+	)
+	switch os.Getenv("TRACE_EXPORTER") {
+	case "":
+		return nil
+	case "otlp":
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		headers := map[string]string{}
+		for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+		exporter, err = telemetry.NewOTLPExporter(&telemetry.OTLPExporterConfig{
+			Endpoint:    endpoint,
+			Headers:     headers,
+			ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		})
+	case "file":
+		path := os.Getenv("TRACE_FILE")
+		if path == "" {
+			path = "log/traces.jsonl"
+		}
+		exporter, err = telemetry.NewFileExporter(path)
+	default:
+		util.Fatalf("unknown TRACE_EXPORTER: %s", os.Getenv("TRACE_EXPORTER"))
+	}
+	if err != nil {
+		util.Fatalf("failed to create trace exporter: %v", err)
+	}
+
+	tracer, err := telemetry.NewTracer(&telemetry.TracerConfig{Exporter: exporter})
+	if err != nil {
+		util.Fatalf("failed to create tracer: %v", err)
+	}
+	agent.RegisterCallbacks(tracer)
+	return tracer
+}
+
+// shutdownTimeout 读取 SHUTDOWN_TIMEOUT（如 30s），即收到退出信号后等待进行中的对话完成的最长时间
+func shutdownTimeout() time.Duration {
+	raw := os.Getenv("SHUTDOWN_TIMEOUT")
+	if raw == "" {
+		return 30 * time.Second
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		util.Fatalf("invalid SHUTDOWN_TIMEOUT: %s", raw)
+	}
+	return d
+}
+
+// waitShutdownSignal 将 SIGINT 和 SIGTERM 都视为优雅退出（Hertz 默认收到 SIGTERM 会立即退出），
+// 排空期间再次收到信号则立即退出。
+func waitShutdownSignal(errCh chan error) error {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case sig := <-signals:
+		log.Printf("[Shutdown] Received %s, starting graceful shutdown", sig)
+		go func() {
+			sig := <-signals
+			log.Printf("[Shutdown] Received %s again, exiting immediately", sig)
+			os.Exit(1)
+		}()
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
+
 func main() {
-	// 创建 Hertz 服务器
-	h := server.Default(server.WithHostPorts(":" + port))
+	setupLogger()
+	tracer := setupTracing()
+	agent.RegisterCallbacks(telemetry.DefaultMetrics())
+
+	drainTimeout := shutdownTimeout()
+
+	// 创建 Hertz 服务器，退出等待时间需覆盖流式响应的排空时间和历史记录写入时间
+	h := server.Default(
+		server.WithHostPorts(":"+port),
+		server.WithExitWaitTime(drainTimeout+10*time.Second),
+		// 客户端断开时取消请求 ctx，从而中断模型流和工具调用
+		server.WithSenseClientDisconnection(true),
+	)
+	h.SetCustomSignalWaiter(waitShutdownSignal)
+	// 限流按客户端 IP 分桶，只信任 TRUSTED_PROXIES（逗号分隔的 CIDR 或 IP）转发的 X-Forwarded-For，
+	// 默认使用连接的对端地址
+	clientIP, err := middleware.TrustedProxyClientIP(strings.Split(os.Getenv("TRUSTED_PROXIES"), ","))
+	if err != nil {
+		util.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+	h.SetClientIPFunc(clientIP)
+	h.OnShutdown = append(h.OnShutdown, func(ctx context.Context) {
+		drainCtx, cancel := context.WithTimeout(ctx, drainTimeout)
+		defer cancel()
+		agent.Shutdown(drainCtx)
+
+		if tracer != nil {
+			if err := tracer.Shutdown(ctx); err != nil {
+				log.Printf("[Tracer] Failed to flush spans on shutdown: %v", err)
+			}
+		}
+	})
 
 	// 注册 agent 路由组
 	agentGroup := h.Group("/agent")
@@ -20,6 +183,14 @@ func main() {
 		log.Fatal("failed to bind agent routes:", err)
 	}
 
+	// OpenAI 兼容接口
+	if err := agent.BindOpenAIRoutes(h.Group("/v1")); err != nil {
+		log.Fatal("failed to bind OpenAI routes:", err)
+	}
+
+	// Prometheus 指标
+	h.GET("/metrics", telemetry.MetricsHandler())
+
 	// Redirect root path to /agent
 	h.GET("/", func(ctx context.Context, c *app.RequestContext) {
 		c.Redirect(302, []byte("/agent"))
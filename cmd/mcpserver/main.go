@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"myeino/agent"
+	"myeino/cmd/mcpserver/tools"
+)
+
+// mcpserver 以 MCP 协议提供 Eino 助手，供 IDE 和其他 agent 调用：
+//
+//	mcpserver                                  # stdio，index_document 可读取任意文件
+//	mcpserver -http :8090 -index-root data/docs # streamable HTTP，端点为 /mcp
+//
+// HTTP 请求需携带 Authorization: Bearer <MCP_SERVER_TOKEN>，未设置 token 时只有加 -insecure 才会启动；
+// MCP_TENANT_ID 将检索和索引限定到一个租户。
+func main() {
+	httpAddr := flag.String("http", "", "serve streamable HTTP on this address instead of stdio")
+	indexRoot := flag.String("index-root", "", "directory index_document may read from, default / over stdio and disabled over HTTP")
+	insecure := flag.Bool("insecure", false, "serve HTTP without MCP_SERVER_TOKEN, to every client that can reach the address")
+	flag.Parse()
+
+	token := os.Getenv("MCP_SERVER_TOKEN")
+	if *httpAddr != "" && token == "" && !*insecure {
+		log.Fatal("[MCP] MCP_SERVER_TOKEN is not set, set it or pass -insecure to serve HTTP without authentication")
+	}
+
+	config := &tools.Config{IndexRoot: *indexRoot, TenantID: os.Getenv("MCP_TENANT_ID")}
+	if config.IndexRoot == "" && *httpAddr == "" {
+		config.IndexRoot = "/"
+	}
+	s := tools.NewServer(config)
+	defer agent.Close()
+
+	if *httpAddr == "" {
+		// stdout 用于协议消息，日志只能写到 stderr
+		log.SetOutput(os.Stderr)
+		if err := server.ServeStdio(s); err != nil {
+			log.Printf("[MCP] Server stopped: %v", err)
+		}
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", requireToken(token, server.NewStreamableHTTPServer(s)))
+	srv := &http.Server{Addr: *httpAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	log.Printf("[MCP] Serving on %s/mcp", *httpAddr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("[MCP] Server stopped: %v", err)
+	}
+}
+
+// requireToken rejects requests without the bearer token, an empty token lets every request through
+// and is only used with -insecure.
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,195 @@
+// Package tools offers the assistant to MCP clients: IDEs and other agents can ask the full agent,
+// search the knowledge base and index documents into it.
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudwego/eino/components/document"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"myeino/agent"
+	"myeino/examples"
+	"myeino/util"
+)
+
+// Names of the tools offered to MCP clients.
+const (
+	ToolAsk    = "ask_eino_assistant"
+	ToolSearch = "search_knowledge_base"
+	ToolIndex  = "index_document"
+)
+
+// maxTopK bounds the documents returned by a search.
+const maxTopK = 20
+
+// Config chooses the components behind the tools, nil builders use the ones of the agent.
+type Config struct {
+	BuildAgent   func(ctx context.Context, opts ...compose.GraphCompileOption) (compose.Runnable[*agent.UserMessage, *schema.Message], error)
+	NewRetriever func(ctx context.Context) (retriever.Retriever, error)
+	BuildIndexer func(ctx context.Context) (compose.Runnable[any, any], error)
+
+	// IndexRoot is the directory index_document may read from, relative paths are resolved against it.
+	// index_document is not offered when it is empty.
+	IndexRoot string
+	// TenantID scopes searches and indexed documents to a tenant, empty for single-tenant deployments.
+	TenantID string
+}
+
+// NewServer creates the MCP server, serve it over stdio or streamable HTTP.
+func NewServer(config *Config) *server.MCPServer {
+	if config == nil {
+		config = &Config{}
+	}
+	h := &handlers{config: *config}
+	if h.config.BuildAgent == nil {
+		h.config.BuildAgent = agent.BuildEinoAgent
+	}
+	if h.config.NewRetriever == nil {
+		h.config.NewRetriever = agent.NewRetriever
+	}
+	if h.config.BuildIndexer == nil {
+		h.config.BuildIndexer = examples.Buildmyeino
+	}
+
+	s := server.NewMCPServer("myeino", "1.0.0", server.WithToolCapabilities(false), server.WithRecovery())
+	s.AddTool(mcp.NewTool(ToolAsk,
+		mcp.WithDescription("Ask the Eino assistant. It answers from the Eino knowledge base and may use its own tools, e.g. web search. Every call is a new conversation."),
+		mcp.WithString("question", mcp.Required(), mcp.Description("The question, with all the context needed to answer it")),
+	), h.ask)
+	s.AddTool(mcp.NewTool(ToolSearch,
+		mcp.WithDescription("Search the Eino knowledge base, returns the most relevant document chunks with their scores."),
+		mcp.WithString("query", mcp.Required(), mcp.Description("What to search for")),
+		mcp.WithNumber("top_k", mcp.Description(fmt.Sprintf("Number of chunks to return, at most %d, default 8", maxTopK))),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), h.search)
+	if h.config.IndexRoot != "" {
+		s.AddTool(mcp.NewTool(ToolIndex,
+			mcp.WithDescription("Index a markdown file into the knowledge base, returns the ids of the indexed chunks."),
+			mcp.WithString("path", mcp.Required(), mcp.Description("Path of the file, relative to "+h.config.IndexRoot+" or absolute within it")),
+		), h.index)
+	}
+	return s
+}
+
+type handlers struct {
+	config Config
+}
+
+func (h *handlers) context(ctx context.Context) context.Context {
+	if h.config.TenantID != "" {
+		ctx = util.WithTenantID(ctx, h.config.TenantID)
+	}
+	return ctx
+}
+
+func (h *handlers) ask(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	question, err := req.RequireString("question")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	// 调用方无法回应确认请求，需要确认的工具直接拒绝
+	ctx = agent.WithoutApprovals(h.context(ctx))
+	runner, err := h.config.BuildAgent(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build agent: %w", err)
+	}
+	id := util.NewRequestID()
+	log.Printf("[MCP] %s: %s", ToolAsk, id)
+	answer, err := runner.Invoke(ctx, &agent.UserMessage{ID: id, Query: question})
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("The assistant failed to answer", err), nil
+	}
+	return mcp.NewToolResultText(answer.Content), nil
+}
+
+// searchResult is a chunk found by search_knowledge_base.
+type searchResult struct {
+	ID      string  `json:"id"`
+	Score   float64 `json:"score"`
+	Content string  `json:"content"`
+}
+
+func (h *handlers) search(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := req.RequireString("query")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	var opts []retriever.Option
+	if topK := req.GetInt("top_k", 0); topK > 0 {
+		opts = append(opts, retriever.WithTopK(min(topK, maxTopK)))
+	}
+	ctx = h.context(ctx)
+	rtr, err := h.config.NewRetriever(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build retriever: %w", err)
+	}
+	docs, err := rtr.Retrieve(ctx, query, opts...)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("Search failed", err), nil
+	}
+	results := make([]searchResult, 0, len(docs))
+	for _, doc := range docs {
+		results = append(results, searchResult{ID: doc.ID, Score: doc.Score(), Content: doc.Content})
+	}
+	return mcp.NewToolResultJSON(map[string]any{"results": results})
+}
+
+func (h *handlers) index(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, err := req.RequireString("path")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	path, err = resolvePath(h.config.IndexRoot, path)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	ctx = h.context(ctx)
+	runner, err := h.config.BuildIndexer(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build indexer: %w", err)
+	}
+	out, err := runner.Invoke(ctx, document.Source{URI: path})
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("Indexing failed", err), nil
+	}
+	ids, _ := out.([]string)
+	log.Printf("[MCP] Indexed %s, %d chunks", path, len(ids))
+	return mcp.NewToolResultJSON(map[string]any{"path": path, "ids": ids})
+}
+
+// resolvePath returns the real path of a file in root, following symlinks so that none leads out of it.
+func resolvePath(root, path string) (string, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid index root: %w", err)
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid index root: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("file %s does not exist", path)
+	}
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside of %s", path, root)
+	}
+	return resolved, nil
+}
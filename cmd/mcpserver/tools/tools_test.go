@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/document"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"myeino/agent"
+	"myeino/util"
+)
+
+type fakeRetriever struct {
+	tenant string
+	topK   int
+}
+
+func (r *fakeRetriever) Retrieve(ctx context.Context, query string, opts ...retriever.Option) ([]*schema.Document, error) {
+	r.tenant = util.TenantIDFromContext(ctx)
+	r.topK = *retriever.GetCommonOptions(&retriever.Options{TopK: new(int)}, opts...).TopK
+	return []*schema.Document{(&schema.Document{ID: "doc-1", Content: "about " + query}).WithScore(0.9)}, nil
+}
+
+func newTestClient(t *testing.T, config *Config) *client.Client {
+	t.Helper()
+	c, err := client.NewInProcessClient(NewServer(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	init := mcp.InitializeRequest{}
+	init.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	if _, err := c.Initialize(context.Background(), init); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func callTool(t *testing.T, c *client.Client, name string, args map[string]any) (string, bool) {
+	t.Helper()
+	req := mcp.CallToolRequest{}
+	req.Params.Name = name
+	req.Params.Arguments = args
+	res, err := c.CallTool(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.Content[0].(mcp.TextContent).Text, res.IsError
+}
+
+func TestTools(t *testing.T) {
+	rtr := &fakeRetriever{}
+	var sources []string
+	config := &Config{
+		BuildAgent: func(ctx context.Context, opts ...compose.GraphCompileOption) (compose.Runnable[*agent.UserMessage, *schema.Message], error) {
+			return compose.NewChain[*agent.UserMessage, *schema.Message]().
+				AppendLambda(compose.InvokableLambda(func(ctx context.Context, in *agent.UserMessage) (*schema.Message, error) {
+					return schema.AssistantMessage("answer to "+in.Query, nil), nil
+				})).Compile(ctx)
+		},
+		NewRetriever: func(ctx context.Context) (retriever.Retriever, error) { return rtr, nil },
+		BuildIndexer: func(ctx context.Context) (compose.Runnable[any, any], error) {
+			return compose.NewChain[any, any]().
+				AppendLambda(compose.InvokableLambda(func(ctx context.Context, in any) (any, error) {
+					sources = append(sources, in.(document.Source).URI)
+					return []string{"chunk-1", "chunk-2"}, nil
+				})).Compile(ctx)
+		},
+		IndexRoot: t.TempDir(),
+		TenantID:  "acme",
+	}
+	if err := os.WriteFile(filepath.Join(config.IndexRoot, "doc.md"), []byte("# Eino"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, config)
+
+	if out, isErr := callTool(t, c, ToolAsk, map[string]any{"question": "what is eino"}); isErr || out != "answer to what is eino" {
+		t.Errorf("ask = %q", out)
+	}
+
+	out, isErr := callTool(t, c, ToolSearch, map[string]any{"query": "graphs", "top_k": 100})
+	var found struct{ Results []searchResult }
+	if err := json.Unmarshal([]byte(out), &found); err != nil || isErr {
+		t.Fatalf("search = %q", out)
+	}
+	if len(found.Results) != 1 || found.Results[0].Content != "about graphs" || found.Results[0].Score != 0.9 {
+		t.Errorf("search = %q", out)
+	}
+	if rtr.tenant != "acme" || rtr.topK != maxTopK {
+		t.Errorf("retrieved for tenant %q with top_k %d", rtr.tenant, rtr.topK)
+	}
+
+	if out, isErr := callTool(t, c, ToolIndex, map[string]any{"path": "doc.md"}); isErr || !strings.Contains(out, "chunk-2") {
+		t.Errorf("index = %q", out)
+	}
+	if len(sources) != 1 || filepath.Base(sources[0]) != "doc.md" {
+		t.Errorf("indexed %v", sources)
+	}
+	if out, isErr := callTool(t, c, ToolIndex, map[string]any{"path": "../outside.md"}); !isErr {
+		t.Errorf("path outside of the root indexed: %q", out)
+	}
+}
+
+func TestIndexDisabled(t *testing.T) {
+	c := newTestClient(t, &Config{})
+	list, err := c.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tl := range list.Tools {
+		names = append(names, tl.Name)
+	}
+	if strings.Join(names, ",") != ToolAsk+","+ToolSearch {
+		t.Errorf("tools = %v", names)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, name := range []string{filepath.Join(root, "a.md"), filepath.Join(outside, "b.md")} {
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "b.md"), filepath.Join(root, "link.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := resolvePath(root, "a.md"); err != nil {
+		t.Error(err)
+	}
+	if _, err := resolvePath(root, filepath.Join(root, "a.md")); err != nil {
+		t.Error(err)
+	}
+	for _, path := range []string{"link.md", filepath.Join(outside, "b.md"), "missing.md"} {
+		if _, err := resolvePath(root, path); err == nil {
+			t.Errorf("%s resolved", path)
+		}
+	}
+}
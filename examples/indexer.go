@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/cloudwego/eino-ext/components/indexer/redis"
+	"log"
+	"myeino/agent"
 
 	"github.com/cloudwego/eino/components/indexer"
 	"github.com/cloudwego/eino/schema"
@@ -34,23 +36,53 @@ func customDocumentToFields(ctx context.Context, doc *schema.Document) (*redis.H
 		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
+	// 文档所属租户：优先取 metadata 中的 tenant_id，其次取 ctx 中的租户，默认所有租户可见
+	tenant, _ := doc.MetaData[agent.TenantField].(string)
+	if tenant == "" {
+		tenant = agent.TenantOf(ctx)
+	}
+
 	return &redis.Hashes{
 		Key: key,
 		Field2Value: map[string]redis.FieldValue{
-			ContentField:  {Value: doc.Content, EmbedKey: VectorField},
-			MetadataField: {Value: metadataBytes},
+			ContentField:      {Value: doc.Content, EmbedKey: VectorField},
+			MetadataField:     {Value: metadataBytes},
+			agent.TenantField: {Value: tenant},
 		},
 	}, nil
 }
 
+// VersionedIndexer bumps the knowledge base version after every successful store,
+// which invalidates the agent's semantic response cache.
+type VersionedIndexer struct {
+	inner  indexer.Indexer
+	client *rds.Client
+}
+
+func (vi *VersionedIndexer) Store(ctx context.Context, docs []*schema.Document, opts ...indexer.Option) ([]string, error) {
+	ids, err := vi.inner.Store(ctx, docs, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := agent.BumpKnowledgeVersion(ctx, vi.client)
+	if err != nil {
+		return nil, fmt.Errorf("documents stored but failed to bump knowledge version: %w", err)
+	}
+	log.Printf("[Indexer] Stored %d documents, knowledge version is now %d", len(ids), version)
+
+	return ids, nil
+}
+
 // newIndexer component initialization function of node 'RedisIndexer' in graph 'myeino'
 func newIndexer(ctx context.Context) (idr indexer.Indexer, err error) {
 	// TODO Modify component configuration here.
+	client := rds.NewClient(&rds.Options{
+		Addr: "localhost:6479",
+	})
 	config := &redis.IndexerConfig{
 		KeyPrefix: "eino:doc:",
-		Client: rds.NewClient(&rds.Options{
-			Addr: "localhost:6479",
-		}),
+		Client:    client,
 		// Use custom document to fields mapping that handles missing IDs
 		DocumentToHashes: customDocumentToFields,
 	}
@@ -59,9 +91,15 @@ func newIndexer(ctx context.Context) (idr indexer.Indexer, err error) {
 		return nil, err
 	}
 	config.Embedding = embeddingIns11
-	idr, err = redis.NewIndexer(ctx, config)
+	baseIndexer, err := redis.NewIndexer(ctx, config)
 	if err != nil {
 		return nil, err
 	}
+	if err := agent.EnsureTenantField(ctx, client, RedisPrefix+IndexName); err != nil {
+		log.Printf("[Indexer] Documents will not be filterable by tenant: %v", err)
+	}
+
+	// Wrap with knowledge versioning
+	idr = &VersionedIndexer{inner: baseIndexer, client: client}
 	return idr, nil
 }
@@ -0,0 +1,343 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"myeino/util"
+)
+
+// RoleAdmin grants access to the admin API and to every user's usage.
+const RoleAdmin = "admin"
+
+// DefaultTenant is used for credentials that do not name a tenant.
+const DefaultTenant = "default"
+
+// ErrNoCredentials is returned by an Authenticator when the request carries no credentials it understands.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is the authenticated caller.
+type Principal struct {
+	TenantID string   `json:"tenant_id"`
+	UserID   string   `json:"user_id"`
+	Roles    []string `json:"roles,omitempty"`
+	// Method is the authenticator that accepted the request, e.g. api_key or jwt.
+	Method string `json:"method"`
+}
+
+// HasRole reports whether the principal has role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal stores the principal in ctx, along with its user and tenant IDs (see util.WithUserID).
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	ctx = context.WithValue(ctx, principalKey{}, p)
+	ctx = util.WithUserID(ctx, p.UserID)
+	return util.WithTenantID(ctx, p.TenantID)
+}
+
+// PrincipalFromContext returns the authenticated caller, nil when authentication is disabled.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Authenticator identifies the caller of a request.
+// It returns ErrNoCredentials when the request carries no credentials of its kind.
+type Authenticator interface {
+	Authenticate(ctx context.Context, c *app.RequestContext) (*Principal, error)
+}
+
+// Auth returns a middleware rejecting requests that no authenticator accepts with 401.
+// Authenticators are tried in order, the first one accepting the request wins.
+// Credentials are only accepted in headers, see AuthWithQueryToken.
+func Auth(authenticators ...Authenticator) app.HandlerFunc {
+	return AuthWithQueryToken(nil, authenticators...)
+}
+
+type queryTokenKey struct{}
+
+// AuthWithQueryToken is Auth also accepting the credential in the access_token query parameter on
+// the routes of paths (full route paths, e.g. "/agent/api/chat"). Only use it for streams opened by
+// browsers, EventSource and WebSocket cannot set headers. Tokens in URLs end up in access logs and
+// proxies, the parameter is removed from the request once it is authenticated.
+func AuthWithQueryToken(paths []string, authenticators ...Authenticator) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if slices.Contains(paths, c.FullPath()) {
+			ctx = context.WithValue(ctx, queryTokenKey{}, true)
+		}
+		authErr := ErrNoCredentials
+		for _, a := range authenticators {
+			p, err := a.Authenticate(ctx, c)
+			if err == nil {
+				if args := c.QueryArgs(); args.Has("access_token") {
+					args.Del("access_token")
+					c.URI().SetQueryStringBytes(args.QueryString())
+					c.Request.Header.SetRequestURIBytes(c.URI().RequestURI())
+				}
+				c.Next(WithPrincipal(ctx, p))
+				return
+			}
+			if !errors.Is(err, ErrNoCredentials) {
+				authErr = err
+			}
+		}
+
+		c.Header("WWW-Authenticate", `Bearer realm="einoagent"`)
+		c.AbortWithStatusJSON(consts.StatusUnauthorized, map[string]string{
+			"status": "error",
+			"error":  "unauthorized: " + authErr.Error(),
+		})
+	}
+}
+
+// credentialFromRequest returns the API key or token sent by the client, or the access_token query
+// parameter on the routes allowing it, see AuthWithQueryToken.
+func credentialFromRequest(ctx context.Context, c *app.RequestContext) string {
+	if key := APIKeyFromRequest(c); key != "" {
+		return key
+	}
+	if allowed, _ := ctx.Value(queryTokenKey{}).(bool); allowed {
+		return c.Query("access_token")
+	}
+	return ""
+}
+
+// APIKey is a static API key and the principal it authenticates.
+type APIKey struct {
+	Key      string   `json:"key"`
+	TenantID string   `json:"tenant_id"`
+	UserID   string   `json:"user_id"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// APIKeyAuthenticator accepts static API keys. Only hashes of the keys are kept in memory.
+type APIKeyAuthenticator struct {
+	keys map[string]*Principal
+}
+
+// NewAPIKeyAuthenticator creates an authenticator for keys.
+func NewAPIKeyAuthenticator(keys []APIKey) (*APIKeyAuthenticator, error) {
+	a := &APIKeyAuthenticator{keys: make(map[string]*Principal, len(keys))}
+	for i, k := range keys {
+		if k.Key == "" || k.UserID == "" {
+			return nil, fmt.Errorf("api key %d: key and user_id are required", i)
+		}
+		if k.TenantID == "" {
+			k.TenantID = DefaultTenant
+		}
+		a.keys[hashKey(k.Key)] = &Principal{TenantID: k.TenantID, UserID: k.UserID, Roles: k.Roles, Method: "api_key"}
+	}
+	return a, nil
+}
+
+// LoadAPIKeys reads a JSON array of APIKey from path.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read api keys: %w", err)
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("invalid api keys file %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, c *app.RequestContext) (*Principal, error) {
+	key := credentialFromRequest(ctx, c)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	p, ok := a.keys[hashKey(key)]
+	if !ok {
+		// Not one of our keys, it may be a token for another authenticator.
+		return nil, ErrNoCredentials
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// JWTConfig configures a JWTAuthenticator.
+type JWTConfig struct {
+	// Secret is the shared HMAC key, tokens must be signed with HS256, HS384 or HS512.
+	Secret []byte
+	// Issuer and Audience are checked when set.
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+	// TenantClaim names the claim holding the tenant ID, defaults to tenant_id.
+	TenantClaim string
+}
+
+// JWTAuthenticator verifies HMAC-signed JWTs locally. The subject becomes the user ID.
+type JWTAuthenticator struct {
+	config *JWTConfig
+	now    func() time.Time
+}
+
+// NewJWTAuthenticator creates a JWT authenticator.
+func NewJWTAuthenticator(config *JWTConfig) (*JWTAuthenticator, error) {
+	if config == nil || len(config.Secret) == 0 {
+		return nil, errors.New("jwt secret cannot be empty")
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant_id"
+	}
+	return &JWTAuthenticator{config: config, now: time.Now}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, c *app.RequestContext) (*Principal, error) {
+	token := credentialFromRequest(ctx, c)
+	if strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+	return a.Verify(token)
+}
+
+// Verify checks the token signature and claims and returns its principal.
+func (a *JWTAuthenticator) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	var newHash func() hash.Hash
+	switch header.Alg {
+	case "HS256":
+		newHash = sha256.New
+	case "HS384":
+		newHash = sha512.New384
+	case "HS512":
+		newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	mac := hmac.New(newHash, a.config.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	if err := a.validate(claims); err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("token has no subject")
+	}
+	tenant, _ := claims[a.config.TenantClaim].(string)
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	return &Principal{TenantID: tenant, UserID: sub, Roles: stringList(claims["roles"]), Method: "jwt"}, nil
+}
+
+func (a *JWTAuthenticator) validate(claims map[string]any) error {
+	now := a.now()
+	if exp, ok := numericClaim(claims, "exp"); ok && now.After(exp.Add(a.config.Leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(a.config.Leeway).Before(nbf) {
+		return errors.New("token not valid yet")
+	}
+	if a.config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.config.Issuer {
+			return errors.New("invalid token issuer")
+		}
+	}
+	if a.config.Audience != "" {
+		found := false
+		for _, aud := range stringList(claims["aud"]) {
+			if aud == a.config.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("invalid token audience")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func numericClaim(claims map[string]any, name string) (time.Time, bool) {
+	v, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// stringList accepts both a single string and an array of strings, as used by aud and roles.
+func stringList(v any) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
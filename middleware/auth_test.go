@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"myeino/util"
+)
+
+const testSecret = "test-secret"
+
+func signHS256(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTVerify(t *testing.T) {
+	a, err := NewJWTAuthenticator(&JWTConfig{Secret: []byte(testSecret), Issuer: "idp", Audience: "einoagent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	valid := map[string]any{
+		"sub": "alice", "tenant_id": "acme", "roles": []string{"admin"},
+		"iss": "idp", "aud": []string{"other", "einoagent"}, "exp": now.Add(time.Hour).Unix(),
+	}
+	with := func(k string, v any) map[string]any {
+		c := map[string]any{}
+		for key, val := range valid {
+			c[key] = val
+		}
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", signHS256(t, testSecret, valid), ""},
+		{"wrong secret", signHS256(t, "other", valid), "signature"},
+		{"expired", signHS256(t, testSecret, with("exp", now.Add(-time.Hour).Unix())), "expired"},
+		{"not yet valid", signHS256(t, testSecret, with("nbf", now.Add(time.Hour).Unix())), "not valid yet"},
+		{"wrong issuer", signHS256(t, testSecret, with("iss", "evil")), "issuer"},
+		{"wrong audience", signHS256(t, testSecret, with("aud", "other")), "audience"},
+		{"no subject", signHS256(t, testSecret, with("sub", nil)), "subject"},
+		{"alg none", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + ".e30.", "algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := a.Verify(tt.token)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.UserID != "alice" || p.TenantID != "acme" || !p.HasRole(RoleAdmin) || p.Method != "jwt" {
+					t.Errorf("unexpected principal: %+v", p)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	keys, err := NewAPIKeyAuthenticator([]APIKey{{Key: "k-alice", UserID: "alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt, err := NewJWTAuthenticator(&JWTConfig{Secret: []byte(testSecret)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := route.NewEngine(config.NewOptions(nil))
+	auth := AuthWithQueryToken([]string{"/chat"}, keys, jwt)
+	handler := func(ctx context.Context, c *app.RequestContext) {
+		// 认证后 access_token 从请求中去掉，不会出现在之后记录的 URL 中
+		c.String(200, util.TenantIDFromContext(ctx)+"/"+util.UserIDFromContext(ctx)+"/"+PrincipalFromContext(ctx).Method+c.Query("access_token"))
+		if strings.Contains(string(c.Request.RequestURI()), "access_token") {
+			c.String(500, "access_token kept in "+string(c.Request.RequestURI()))
+		}
+	}
+	engine.GET("/chat", auth, handler)
+	engine.GET("/usage", auth, handler)
+
+	token := signHS256(t, testSecret, map[string]any{"sub": "bob", "tenant_id": "acme"})
+	tests := []struct {
+		name    string
+		url     string
+		headers []ut.Header
+		status  int
+		body    string
+	}{
+		{"api key header", "/chat", []ut.Header{{Key: "X-API-Key", Value: "k-alice"}}, 200, "default/alice/api_key"},
+		{"api key bearer", "/chat", []ut.Header{{Key: "Authorization", Value: "Bearer k-alice"}}, 200, "default/alice/api_key"},
+		{"jwt bearer", "/chat", []ut.Header{{Key: "Authorization", Value: "Bearer " + token}}, 200, "acme/bob/jwt"},
+		{"jwt query", "/chat?access_token=" + token, nil, 200, "acme/bob/jwt"},
+		{"query on other route", "/usage?access_token=" + token, nil, 401, "no credentials"},
+		{"api key on other route", "/usage", []ut.Header{{Key: "X-API-Key", Value: "k-alice"}}, 200, "default/alice/api_key"},
+		{"unknown key", "/chat", []ut.Header{{Key: "X-API-Key", Value: "nope"}}, 401, "no credentials"},
+		{"bad jwt", "/chat", []ut.Header{{Key: "Authorization", Value: "Bearer " + signHS256(t, "x", map[string]any{"sub": "bob"})}}, 401, "signature"},
+		{"anonymous", "/chat", nil, 401, "no credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ut.PerformRequest(engine, "GET", tt.url, nil, tt.headers...).Result()
+			if resp.StatusCode() != tt.status || !strings.Contains(string(resp.Body()), tt.body) {
+				t.Errorf("got %d %s, want %d containing %q", resp.StatusCode(), resp.Body(), tt.status, tt.body)
+			}
+			if tt.status == 401 && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
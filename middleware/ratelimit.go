@@ -0,0 +1,469 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	rds "github.com/redis/go-redis/v9"
+	"myeino/usage"
+	"myeino/util"
+)
+
+// Limit is a token bucket refilled with Rate tokens per second up to Burst tokens.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Unlimited reports whether the limit disables rate limiting.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// Decision is the result of taking a token from a bucket.
+type Decision struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Limiter takes one token from the bucket identified by key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (*Decision, error)
+}
+
+// LimitSettings are the admin-configurable limits.
+type LimitSettings struct {
+	// Default applies to every caller without an override.
+	Default Limit `json:"default"`
+	// Overrides by rate limit key, e.g. "user:acme/alice", "key:<api key hash>" or "ip:10.0.0.1".
+	Overrides map[string]Limit `json:"overrides,omitempty"`
+	// DailyTokenQuota is the number of model tokens a user may consume per UTC day, 0 means unlimited.
+	DailyTokenQuota int `json:"daily_token_quota"`
+	// UserDailyTokenQuota overrides DailyTokenQuota per caller, see DefaultQuotaUser: a user as
+	// "<tenant>/<user>", "key:<api key hash>" for accepted keys without user, or "ip:10.0.0.1".
+	UserDailyTokenQuota map[string]int `json:"user_daily_token_quota,omitempty"`
+}
+
+// DefaultLimitSettings allows bursts of 10 requests refilled at one request every 2 seconds.
+func DefaultLimitSettings() *LimitSettings {
+	return &LimitSettings{Default: Limit{Rate: 0.5, Burst: 10}}
+}
+
+// LoadLimitSettings reads limit settings from a JSON file.
+func LoadLimitSettings(path string) (*LimitSettings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read limit settings: %w", err)
+	}
+	var s LimitSettings
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid limit settings %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Limits holds the current settings and can be updated while the server is running.
+type Limits struct {
+	settings atomic.Pointer[LimitSettings]
+}
+
+// NewLimits creates Limits with the given settings, nil means DefaultLimitSettings.
+func NewLimits(settings *LimitSettings) *Limits {
+	if settings == nil {
+		settings = DefaultLimitSettings()
+	}
+	l := &Limits{}
+	l.settings.Store(settings)
+	return l
+}
+
+// Get returns the current settings, callers must not modify them.
+func (l *Limits) Get() *LimitSettings {
+	return l.settings.Load()
+}
+
+// Set replaces the settings.
+func (l *Limits) Set(settings *LimitSettings) error {
+	if settings == nil {
+		return fmt.Errorf("settings cannot be nil")
+	}
+	if settings.DailyTokenQuota < 0 {
+		return fmt.Errorf("daily_token_quota cannot be negative")
+	}
+	l.settings.Store(settings)
+	return nil
+}
+
+func (l *Limits) limitFor(key string) Limit {
+	s := l.Get()
+	if limit, ok := s.Overrides[key]; ok {
+		return limit
+	}
+	return s.Default
+}
+
+func (l *Limits) quotaFor(caller string) int {
+	s := l.Get()
+	if quota, ok := s.UserDailyTokenQuota[caller]; ok {
+		return quota
+	}
+	return s.DailyTokenQuota
+}
+
+// RateLimitConfig configures the RateLimit middleware.
+type RateLimitConfig struct {
+	Limiter Limiter
+	Limits  *Limits
+	// Usage enables daily token quotas, nil disables them.
+	Usage *usage.Store
+	// KeyFunc identifies the caller's bucket, defaults to DefaultRateLimitKey.
+	KeyFunc func(ctx context.Context, c *app.RequestContext) string
+	// UserFunc identifies the caller charged for tokens, defaults to DefaultQuotaUser.
+	// Quotas are only enforced for identified callers.
+	UserFunc func(ctx context.Context, c *app.RequestContext) string
+}
+
+// DefaultRateLimitKey buckets requests by authenticated user, then by the API key an authenticator
+// accepted, then by client IP, see TrustedProxyClientIP. Users are keyed as "user:<tenant>/<user>",
+// user IDs are only unique within a tenant. Credentials nobody verified are ignored, a caller sending
+// a new random key with every request would get a new bucket each time.
+func DefaultRateLimitKey(ctx context.Context, c *app.RequestContext) string {
+	if user := tenantUser(ctx); user != "" {
+		return "user:" + user
+	}
+	if PrincipalFromContext(ctx) != nil {
+		if key := APIKeyFromRequest(c); key != "" {
+			return apiKeyBucket(key)
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// TrustedProxyClientIP returns the client IP function of the engine: the address of the peer, or
+// the client in X-Forwarded-For or X-Real-IP when the peer is one of proxies (CIDRs or IPs, e.g.
+// "10.0.0.0/8"). Hertz's default trusts these headers from any peer, so that callers could pick
+// their own rate limit bucket.
+func TrustedProxyClientIP(proxies []string) (app.ClientIP, error) {
+	var trusted []*net.IPNet
+	for _, proxy := range proxies {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, cidr, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		trusted = append(trusted, cidr)
+	}
+	return app.ClientIPWithOption(app.ClientIPOptions{
+		RemoteIPHeaders: []string{"X-Forwarded-For", "X-Real-IP"},
+		TrustedCIDRs:    trusted,
+	}), nil
+}
+
+func apiKeyBucket(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:8])
+}
+
+// DefaultQuotaUser returns the authenticated user. Other callers are charged like DefaultRateLimitKey,
+// never by a user ID or a key they choose themselves.
+func DefaultQuotaUser(ctx context.Context, c *app.RequestContext) string {
+	if user := tenantUser(ctx); user != "" {
+		return user
+	}
+	return DefaultRateLimitKey(ctx, c)
+}
+
+// tenantUser returns "<tenant>/<user>" for the user of ctx, only the user ID without a tenant.
+func tenantUser(ctx context.Context) string {
+	userID := util.UserIDFromContext(ctx)
+	if userID == "" {
+		return ""
+	}
+	if tenant := util.TenantIDFromContext(ctx); tenant != "" {
+		return tenant + "/" + userID
+	}
+	return userID
+}
+
+// APIKeyFromRequest returns the API key sent in the X-API-Key header or as a bearer token.
+func APIKeyFromRequest(c *app.RequestContext) string {
+	if key := string(c.GetHeader("X-API-Key")); key != "" {
+		return key
+	}
+	auth := string(c.GetHeader("Authorization"))
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// RateLimiter enforces per-caller request rates and daily token quotas.
+type RateLimiter struct {
+	config *RateLimitConfig
+}
+
+// NewRateLimiter creates a limiter, the zero fields of config get their defaults.
+func NewRateLimiter(config *RateLimitConfig) *RateLimiter {
+	c := *config
+	if c.Limits == nil {
+		c.Limits = NewLimits(nil)
+	}
+	if c.Limiter == nil {
+		c.Limiter = NewMemoryLimiter()
+	}
+	if c.KeyFunc == nil {
+		c.KeyFunc = DefaultRateLimitKey
+	}
+	if c.UserFunc == nil {
+		c.UserFunc = DefaultQuotaUser
+	}
+	return &RateLimiter{config: &c}
+}
+
+// LimitError rejects a request over its rate limit or daily token quota.
+type LimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Reason, e.RetryAfter.Round(time.Second))
+}
+
+// limitState is what Allow found, the middleware reports it in headers.
+type limitState struct {
+	limit           Limit
+	remaining       int
+	quota, tokens   int
+	limited, quoted bool
+}
+
+// Allow takes a token from the bucket of key and checks the daily token quota of caller, e.g. for
+// each message of a WebSocket, see RateLimitKeyFromContext. Limiter errors fail open.
+func (r *RateLimiter) Allow(ctx context.Context, key, caller string) error {
+	_, err := r.allow(ctx, key, caller)
+	return err
+}
+
+func (r *RateLimiter) allow(ctx context.Context, key, caller string) (*limitState, error) {
+	state := &limitState{limit: r.config.Limits.limitFor(key)}
+	if !state.limit.Unlimited() {
+		d, err := r.config.Limiter.Allow(ctx, key, state.limit)
+		if err != nil {
+			log.Printf("[RateLimit] Limiter failed, allowing request for %s: %v", key, err)
+		} else {
+			state.limited, state.remaining = true, d.Remaining
+			if !d.Allowed {
+				return state, &LimitError{Reason: "rate limit exceeded", RetryAfter: d.RetryAfter}
+			}
+		}
+	}
+
+	if r.config.Usage != nil && caller != "" {
+		if quota := r.config.Limits.quotaFor(caller); quota > 0 {
+			now := time.Now().UTC()
+			used := r.config.Usage.CallerDay(caller, now.Format(usage.DayLayout)).TotalTokens
+			if used >= quota {
+				midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+				return state, &LimitError{Reason: "daily token quota exceeded", RetryAfter: midnight.Sub(now)}
+			}
+			state.quoted, state.quota, state.tokens = true, quota, used
+		}
+	}
+	return state, nil
+}
+
+type rateLimitKey struct{}
+
+// RateLimitKeyFromContext returns the bucket of the request, set by the RateLimit middleware.
+func RateLimitKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(rateLimitKey{}).(string)
+	return key
+}
+
+// Middleware rejects requests over their limits with a 429 response and a Retry-After header.
+// The bucket and the caller charged for tokens are stored in ctx, see RateLimitKeyFromContext and
+// usage.WithCaller.
+func (r *RateLimiter) Middleware() app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		key := r.config.KeyFunc(ctx, c)
+		caller := r.config.UserFunc(ctx, c)
+		state, err := r.allow(ctx, key, caller)
+		if state.limited {
+			c.Header("X-RateLimit-Limit", strconv.Itoa(state.limit.Burst))
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(state.remaining))
+		}
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			reject(c, limitErr.RetryAfter, limitErr.Reason)
+			return
+		}
+		if state.quoted {
+			c.Header("X-Token-Quota-Remaining", strconv.Itoa(state.quota-state.tokens))
+		}
+
+		ctx = context.WithValue(ctx, rateLimitKey{}, key)
+		if caller != "" {
+			ctx = usage.WithCaller(ctx, caller)
+		}
+		c.Next(ctx)
+	}
+}
+
+// RateLimit returns a middleware enforcing per-caller request rates and daily token quotas, see
+// RateLimiter.Middleware.
+func RateLimit(config *RateLimitConfig) app.HandlerFunc {
+	return NewRateLimiter(config).Middleware()
+}
+
+func reject(c *app.RequestContext, retryAfter time.Duration, reason string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(consts.StatusTooManyRequests, map[string]any{
+		"status":      "error",
+		"error":       reason,
+		"retry_after": seconds,
+	})
+}
+
+// MemoryLimiter keeps token buckets in process memory, suitable for a single instance.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// limit is the limit of the last request, it tells when the bucket is full again
+	limit Limit
+}
+
+// NewMemoryLimiter creates an in-process limiter.
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (*Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	b.limit = limit
+
+	m.calls++
+	if m.calls%1024 == 0 {
+		m.sweep(now)
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return &Decision{Allowed: true, Remaining: int(b.tokens)}, nil
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return &Decision{Allowed: false, RetryAfter: wait}, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again under their own limit.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		idle := time.Duration(float64(b.limit.Burst) / b.limit.Rate * float64(time.Second))
+		if now.Sub(b.last) > idle {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// RedisLimiter keeps token buckets in Redis so that limits are shared between instances.
+type RedisLimiter struct {
+	client *rds.Client
+	prefix string
+}
+
+// NewRedisLimiter creates a limiter storing buckets under prefix, e.g. "eino:ratelimit:".
+func NewRedisLimiter(client *rds.Client, prefix string) *RedisLimiter {
+	if prefix == "" {
+		prefix = "eino:ratelimit:"
+	}
+	return &RedisLimiter{client: client, prefix: prefix}
+}
+
+// tokenBucketScript refills and takes a token atomically.
+// KEYS[1] bucket, ARGV rate (tokens/s), burst, now (ms). Returns {allowed, remaining, retry_after_ms}.
+var tokenBucketScript = rds.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+  tokens = burst
+  ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (*Decision, error) {
+	res, err := tokenBucketScript.Run(ctx, r.client, []string{r.prefix + key},
+		limit.Rate, limit.Burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run token bucket script: %w", err)
+	}
+	if len(res) != 3 {
+		return nil, fmt.Errorf("unexpected token bucket result: %v", res)
+	}
+	return &Decision{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
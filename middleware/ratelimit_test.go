@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"myeino/usage"
+	"myeino/util"
+)
+
+func newTestEngine(handlers ...app.HandlerFunc) *route.Engine {
+	engine := route.NewEngine(config.NewOptions(nil))
+	handlers = append(handlers, func(ctx context.Context, c *app.RequestContext) {
+		c.String(200, "ok")
+	})
+	engine.GET("/chat", handlers...)
+	return engine
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := NewMemoryLimiter()
+	m.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if d, _ := m.Allow(context.Background(), "k", limit); !d.Allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	d, _ := m.Allow(context.Background(), "k", limit)
+	if d.Allowed || d.RetryAfter != time.Second {
+		t.Fatalf("expected rejection with 1s retry, got %+v", d)
+	}
+	if d, _ := m.Allow(context.Background(), "other", limit); !d.Allowed {
+		t.Fatal("buckets must be independent")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if d, _ := m.Allow(context.Background(), "k", limit); d.Allowed || d.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected rejection with 500ms retry, got %+v", d)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if d, _ := m.Allow(context.Background(), "k", limit); !d.Allowed {
+		t.Fatal("bucket should have refilled")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limits := NewLimits(&LimitSettings{
+		Default:   Limit{Rate: 0.001, Burst: 2},
+		Overrides: map[string]Limit{"user:vip": {}},
+	})
+	engine := newTestEngine(acceptKeys("k1", "k2"), RateLimit(&RateLimitConfig{Limits: limits}))
+
+	key := ut.Header{Key: "X-API-Key", Value: "k1"}
+	for i := 0; i < 2; i++ {
+		if resp := ut.PerformRequest(engine, "GET", "/chat", nil, key).Result(); resp.StatusCode() != 200 {
+			t.Fatalf("request %d: status %d", i, resp.StatusCode())
+		}
+	}
+
+	resp := ut.PerformRequest(engine, "GET", "/chat", nil, key).Result()
+	if resp.StatusCode() != 429 {
+		t.Fatalf("expected 429, got %d", resp.StatusCode())
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+
+	// A different API key has its own bucket.
+	other := ut.Header{Key: "Authorization", Value: "Bearer k2"}
+	if resp := ut.PerformRequest(engine, "GET", "/chat", nil, other).Result(); resp.StatusCode() != 200 {
+		t.Errorf("other key: status %d", resp.StatusCode())
+	}
+
+	// Admin updates apply immediately.
+	if err := limits.Set(&LimitSettings{Default: Limit{}}); err != nil {
+		t.Fatal(err)
+	}
+	if resp := ut.PerformRequest(engine, "GET", "/chat", nil, key).Result(); resp.StatusCode() != 200 {
+		t.Errorf("unlimited: status %d", resp.StatusCode())
+	}
+}
+
+// acceptKeys stands for an authenticator accepting keys without user.
+func acceptKeys(keys ...string) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		if slices.Contains(keys, APIKeyFromRequest(c)) {
+			ctx = WithPrincipal(ctx, &Principal{Method: "api_key"})
+		}
+		c.Next(ctx)
+	}
+}
+
+func TestRateLimitIgnoresUnverifiedIdentity(t *testing.T) {
+	clientIP, err := TrustedProxyClientIP(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := NewLimits(&LimitSettings{Default: Limit{Rate: 0.001, Burst: 2}})
+	// ut 不经过 engine 分配 RequestContext，这里代替 engine.SetClientIPFunc
+	useClientIP := func(ctx context.Context, c *app.RequestContext) {
+		c.SetClientIPFunc(clientIP)
+		c.Next(ctx)
+	}
+	engine := newTestEngine(useClientIP, RateLimit(&RateLimitConfig{Limits: limits}))
+
+	// 未经认证的随机 key 和伪造的 X-Forwarded-For 都落在同一个桶中
+	for i := range 4 {
+		resp := ut.PerformRequest(engine, "GET", "/chat", nil,
+			ut.Header{Key: "X-API-Key", Value: fmt.Sprintf("random-%d", i)},
+			ut.Header{Key: "X-Forwarded-For", Value: fmt.Sprintf("203.0.113.%d", i)}).Result()
+		if want := map[bool]int{true: 200, false: 429}[i < 2]; resp.StatusCode() != want {
+			t.Errorf("request %d: status %d, want %d", i, resp.StatusCode(), want)
+		}
+	}
+
+	if _, err := TrustedProxyClientIP([]string{"10.0.0.0/8", "192.168.1.1", "::1"}); err != nil {
+		t.Error(err)
+	}
+	if _, err := TrustedProxyClientIP([]string{"proxy.local"}); err == nil {
+		t.Error("invalid proxy accepted")
+	}
+}
+
+func TestDailyTokenQuota(t *testing.T) {
+	store, err := usage.NewStore(&usage.StoreConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, caller := range []string{"acme/alice", apiKeyBucket("k1")} {
+		if err := store.Add(&usage.Record{ConversationID: "c1", UserID: "alice", Caller: caller, Model: "m", PromptTokens: 900, CompletionTokens: 100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limits := NewLimits(&LimitSettings{
+		DailyTokenQuota:     1000,
+		UserDailyTokenQuota: map[string]int{"acme/bob": 10},
+	})
+	// X-Test-User stands for an authenticated user of acme
+	authenticate := func(ctx context.Context, c *app.RequestContext) {
+		if user := string(c.GetHeader("X-Test-User")); user != "" {
+			ctx = util.WithTenantID(util.WithUserID(ctx, user), "acme")
+		}
+		c.Next(ctx)
+	}
+	var callers []string
+	engine := newTestEngine(authenticate, acceptKeys("k1", "k2"), RateLimit(&RateLimitConfig{Limits: limits, Usage: store}), func(ctx context.Context, c *app.RequestContext) {
+		callers = append(callers, usage.CallerFromContext(ctx))
+	})
+
+	tests := []struct {
+		name   string
+		header ut.Header
+		want   int
+	}{
+		{"user over quota", ut.Header{Key: "X-Test-User", Value: "alice"}, 429},
+		{"user under quota", ut.Header{Key: "X-Test-User", Value: "bob"}, 200},
+		// 未认证的调用方按 API key 计费，换一个 X-User-ID 也拿不到新的额度
+		{"key over quota", ut.Header{Key: "X-API-Key", Value: "k1"}, 429},
+		{"other key", ut.Header{Key: "X-API-Key", Value: "k2"}, 200},
+		{"unknown key", ut.Header{Key: "X-API-Key", Value: "k3"}, 200},
+		{"claimed user", ut.Header{Key: "X-User-ID", Value: "alice"}, 200},
+	}
+	for _, tt := range tests {
+		headers := []ut.Header{tt.header}
+		if tt.name == "key over quota" {
+			headers = append(headers, ut.Header{Key: "X-User-ID", Value: "fresh-user"})
+		}
+		resp := ut.PerformRequest(engine, "GET", "/chat", nil, headers...).Result()
+		if resp.StatusCode() != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode(), tt.want)
+		}
+		if tt.want == 429 && resp.Header.Get("Retry-After") == "" {
+			t.Errorf("%s: missing Retry-After", tt.name)
+		}
+	}
+	if len(callers) != 4 || callers[0] != "acme/bob" || callers[1] != apiKeyBucket("k2") || callers[2] != callers[3] || !strings.HasPrefix(callers[2], "ip:") {
+		t.Errorf("callers = %v", callers)
+	}
+}
+
+func TestMemoryLimiterSweepKeepsStricterBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := NewMemoryLimiter()
+	m.now = func() time.Time { return now }
+	strict, loose := Limit{Rate: 0.01, Burst: 1}, Limit{Rate: 10, Burst: 10}
+	m.Allow(context.Background(), "strict", strict)
+	m.Allow(context.Background(), "loose", loose)
+
+	// 10 秒后宽松的桶已满可以清理，严格的桶还要 100 秒才满
+	now = now.Add(10 * time.Second)
+	m.sweep(now)
+	if _, ok := m.buckets["loose"]; ok {
+		t.Error("idle loose bucket kept")
+	}
+	if d, _ := m.Allow(context.Background(), "strict", strict); d.Allowed {
+		t.Error("strict bucket reset by the sweep")
+	}
+}
+
+func TestRateLimitKeySeparatesTenants(t *testing.T) {
+	c := app.NewContext(0)
+	acme := util.WithTenantID(util.WithUserID(context.Background(), "admin"), "acme")
+	globex := util.WithTenantID(util.WithUserID(context.Background(), "admin"), "globex")
+	if a, g := DefaultRateLimitKey(acme, c), DefaultRateLimitKey(globex, c); a != "user:acme/admin" || a == g {
+		t.Errorf("keys = %q, %q", a, g)
+	}
+	if a, g := DefaultQuotaUser(acme, c), DefaultQuotaUser(globex, c); a != "acme/admin" || a == g {
+		t.Errorf("quota users = %q, %q", a, g)
+	}
+}
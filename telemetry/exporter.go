@@ -0,0 +1,258 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileExporter writes spans as JSON lines to a local file, useful when no collector is available.
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileExporter creates the file (and its directory) if needed and appends spans to it.
+func NewFileExporter(path string) (*FileExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create trace directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return &FileExporter{file: f}, nil
+}
+
+func (e *FileExporter) ExportSpans(_ context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file == nil {
+		return os.ErrClosed
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, span := range spans {
+		span.mu.Lock()
+		err := enc.Encode(span)
+		span.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to encode span: %w", err)
+		}
+	}
+	_, err := e.file.Write(buf.Bytes())
+	return err
+}
+
+func (e *FileExporter) Shutdown(_ context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
+
+// OTLPExporterConfig configures an OTLPExporter.
+type OTLPExporterConfig struct {
+	// Endpoint is the collector base URL, e.g. http://localhost:4318; /v1/traces is appended.
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	Timeout     time.Duration
+	HTTPClient  *http.Client
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+type OTLPExporter struct {
+	config *OTLPExporterConfig
+	url    string
+}
+
+// NewOTLPExporter creates an OTLP/HTTP exporter.
+func NewOTLPExporter(config *OTLPExporterConfig) (*OTLPExporter, error) {
+	if config == nil || config.Endpoint == "" {
+		return nil, fmt.Errorf("otlp endpoint cannot be empty")
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = "einoagent"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: config.Timeout}
+	}
+
+	url := strings.TrimRight(config.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &OTLPExporter{config: config, url: url}, nil
+}
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.buildRequest(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode otlp request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.config.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(_ context.Context) error {
+	e.config.HTTPClient.CloseIdleConnections()
+	return nil
+}
+
+// The types below are the subset of the OTLP JSON schema used by the exporter.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// otlpSpanKindInternal is SPAN_KIND_INTERNAL.
+const otlpSpanKindInternal = 1
+
+func (e *OTLPExporter) buildRequest(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		span.mu.Lock()
+		s := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: fmt.Sprint(span.StartTime.UnixNano()),
+			EndTimeUnixNano:   fmt.Sprint(span.EndTime.UnixNano()),
+			Attributes:        make([]otlpKeyValue, 0, len(span.Attributes)),
+			Status:            otlpStatus{Code: otlpStatusCode(span.StatusCode), Message: span.StatusMessage},
+		}
+		for k, v := range span.Attributes {
+			s.Attributes = append(s.Attributes, otlpKeyValue{Key: k, Value: toOTLPValue(v)})
+		}
+		span.mu.Unlock()
+		out = append(out, s)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: toOTLPValue(e.config.ServiceName)},
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "myeino/telemetry"},
+			Spans: out,
+		}},
+	}}}
+}
+
+func otlpStatusCode(code string) int {
+	switch code {
+	case StatusOK:
+		return 1
+	case StatusError:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func toOTLPValue(v any) otlpValue {
+	switch val := v.(type) {
+	case string:
+		return otlpValue{StringValue: &val}
+	case bool:
+		return otlpValue{BoolValue: &val}
+	case int:
+		s := fmt.Sprint(val)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := fmt.Sprint(val)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &val}
+	default:
+		s := fmt.Sprint(val)
+		return otlpValue{StringValue: &s}
+	}
+}
@@ -0,0 +1,299 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/schema"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "einoagent"
+
+// latencyBuckets covers both fast local components and slow model streams.
+var latencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Metrics is an eino callbacks.Handler recording Prometheus metrics for graph runs,
+// chat models, retrievers and tools. Request level metrics that happen outside of the
+// graph (SSE flushes, memory store operations) are recorded through its Observe/Inc methods.
+type Metrics struct {
+	chatRequests     *prometheus.CounterVec
+	timeToFirstToken prometheus.Histogram
+	streamDuration   prometheus.Histogram
+	sseFlushes       prometheus.Counter
+
+	retrieverDuration *prometheus.HistogramVec
+	retrieverRequests *prometheus.CounterVec
+	retrieverDocs     *prometheus.HistogramVec
+
+	modelDuration *prometheus.HistogramVec
+	modelTokens   *prometheus.CounterVec
+	modelErrors   *prometheus.CounterVec
+
+	toolInvocations *prometheus.CounterVec
+	toolErrors      *prometheus.CounterVec
+	toolDuration    *prometheus.HistogramVec
+
+	memoryOps *prometheus.CounterVec
+}
+
+type metricsRunKey struct{}
+
+// metricsRun is stored in the context by OnStart so that OnEnd can compute latencies.
+type metricsRun struct {
+	start time.Time
+	root  bool
+}
+
+// NewMetrics creates the collectors and registers them with reg.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		chatRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "chat_requests_total",
+			Help: "Chat requests by outcome.",
+		}, []string{"status"}),
+		timeToFirstToken: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "chat_time_to_first_token_seconds",
+			Help: "Time from the start of an agent run to its first streamed chunk.", Buckets: latencyBuckets,
+		}),
+		streamDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "chat_stream_duration_seconds",
+			Help: "Time from the start of an agent run until its stream is fully consumed.", Buckets: latencyBuckets,
+		}),
+		sseFlushes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "sse_flushes_total",
+			Help: "SSE events published to chat clients.",
+		}),
+		retrieverDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "retriever_duration_seconds",
+			Help: "Retriever latency.", Buckets: latencyBuckets,
+		}, []string{"retriever"}),
+		retrieverRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "retriever_requests_total",
+			Help: "Retriever calls by result (hit, miss, error).",
+		}, []string{"retriever", "result"}),
+		retrieverDocs: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "retriever_documents",
+			Help: "Documents returned per retriever call.", Buckets: []float64{0, 1, 2, 3, 5, 8, 13, 20},
+		}, []string{"retriever"}),
+		modelDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "model_duration_seconds",
+			Help: "Chat model latency, until the end of the stream for streaming calls.", Buckets: latencyBuckets,
+		}, []string{"provider"}),
+		modelTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "model_tokens_total",
+			Help: "Tokens consumed by chat models, direction is input (prompt) or output (completion).",
+		}, []string{"provider", "direction"}),
+		modelErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "model_errors_total",
+			Help: "Chat model calls that failed.",
+		}, []string{"provider"}),
+		toolInvocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "tool_invocations_total",
+			Help: "Tool invocations by tool name.",
+		}, []string{"tool"}),
+		toolErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "tool_errors_total",
+			Help: "Tool invocations that returned an error, by tool name.",
+		}, []string{"tool"}),
+		toolDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "tool_duration_seconds",
+			Help: "Tool latency by tool name.", Buckets: latencyBuckets,
+		}, []string{"tool"}),
+		memoryOps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "memory_operations_total",
+			Help: "Conversation memory store operations.",
+		}, []string{"operation"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.chatRequests, m.timeToFirstToken, m.streamDuration, m.sseFlushes,
+		m.retrieverDuration, m.retrieverRequests, m.retrieverDocs,
+		m.modelDuration, m.modelTokens, m.modelErrors,
+		m.toolInvocations, m.toolErrors, m.toolDuration,
+		m.memoryOps,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+var (
+	defaultMetricsOnce sync.Once
+	defaultMetrics     *Metrics
+)
+
+// DefaultMetrics returns the Metrics registered with the default Prometheus registry.
+func DefaultMetrics() *Metrics {
+	defaultMetricsOnce.Do(func() {
+		m, err := NewMetrics(prometheus.DefaultRegisterer)
+		if err != nil {
+			panic(err)
+		}
+		defaultMetrics = m
+	})
+	return defaultMetrics
+}
+
+// MetricsHandler serves the default Prometheus registry in the text exposition format.
+func MetricsHandler() app.HandlerFunc {
+	h := promhttp.Handler()
+	return func(ctx context.Context, c *app.RequestContext) {
+		req, err := adaptor.GetCompatRequest(&c.Request)
+		if err != nil {
+			c.String(500, err.Error())
+			return
+		}
+		h.ServeHTTP(adaptor.GetCompatResponseWriter(&c.Response), req.WithContext(ctx))
+	}
+}
+
+// ObserveChatRequest counts a chat request with the given outcome, e.g. ok, error, bad_request.
+func (m *Metrics) ObserveChatRequest(status string) {
+	m.chatRequests.WithLabelValues(status).Inc()
+}
+
+// IncSSEFlush counts an SSE event published to a client.
+func (m *Metrics) IncSSEFlush() {
+	m.sseFlushes.Inc()
+}
+
+// ObserveMemoryOp counts a conversation memory operation, e.g. get_conversation, append.
+func (m *Metrics) ObserveMemoryOp(op string) {
+	m.memoryOps.WithLabelValues(op).Inc()
+}
+
+func (m *Metrics) OnStart(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
+	return m.start(ctx)
+}
+
+func (m *Metrics) OnEnd(ctx context.Context, info *callbacks.RunInfo, output callbacks.CallbackOutput) context.Context {
+	run, ok := ctx.Value(metricsRunKey{}).(*metricsRun)
+	if !ok || info == nil {
+		return ctx
+	}
+	elapsed := time.Since(run.start).Seconds()
+
+	switch info.Component {
+	case components.ComponentOfChatModel:
+		m.modelDuration.WithLabelValues(info.Type).Observe(elapsed)
+		m.observeUsage(info.Type, TokenUsageOf(output))
+	case components.ComponentOfRetriever:
+		m.retrieverDuration.WithLabelValues(info.Name).Observe(elapsed)
+		docs := 0
+		if ro := retriever.ConvCallbackOutput(output); ro != nil {
+			docs = len(ro.Docs)
+		}
+		m.retrieverDocs.WithLabelValues(info.Name).Observe(float64(docs))
+		if docs > 0 {
+			m.retrieverRequests.WithLabelValues(info.Name, "hit").Inc()
+		} else {
+			m.retrieverRequests.WithLabelValues(info.Name, "miss").Inc()
+		}
+	case components.ComponentOfTool:
+		m.toolInvocations.WithLabelValues(info.Name).Inc()
+		m.toolDuration.WithLabelValues(info.Name).Observe(elapsed)
+	}
+	return ctx
+}
+
+func (m *Metrics) OnError(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+	if info == nil {
+		return ctx
+	}
+	switch info.Component {
+	case components.ComponentOfChatModel:
+		m.modelErrors.WithLabelValues(info.Type).Inc()
+	case components.ComponentOfRetriever:
+		m.retrieverRequests.WithLabelValues(info.Name, "error").Inc()
+	case components.ComponentOfTool:
+		m.toolInvocations.WithLabelValues(info.Name).Inc()
+		m.toolErrors.WithLabelValues(info.Name).Inc()
+	}
+	return ctx
+}
+
+func (m *Metrics) OnStartWithStreamInput(ctx context.Context, info *callbacks.RunInfo, input *schema.StreamReader[callbacks.CallbackInput]) context.Context {
+	input.Close()
+	return m.start(ctx)
+}
+
+func (m *Metrics) OnEndWithStreamOutput(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[callbacks.CallbackOutput]) context.Context {
+	run, ok := ctx.Value(metricsRunKey{}).(*metricsRun)
+	if !ok || info == nil {
+		output.Close()
+		return ctx
+	}
+
+	isModel := info.Component == components.ComponentOfChatModel
+	if !run.root && !isModel {
+		// Streaming tools and lambdas are not measured beyond their invocation.
+		output.Close()
+		if info.Component == components.ComponentOfTool {
+			m.toolInvocations.WithLabelValues(info.Name).Inc()
+		}
+		return ctx
+	}
+
+	go func() {
+		defer output.Close()
+		first := true
+		var usage *model.TokenUsage
+		for {
+			chunk, err := output.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				if isModel {
+					m.modelErrors.WithLabelValues(info.Type).Inc()
+				}
+				return
+			}
+			if first && run.root {
+				m.timeToFirstToken.Observe(time.Since(run.start).Seconds())
+			}
+			first = false
+			if isModel {
+				if u := TokenUsageOf(chunk); u != nil {
+					usage = u
+				}
+			}
+		}
+
+		elapsed := time.Since(run.start).Seconds()
+		if run.root {
+			m.streamDuration.Observe(elapsed)
+		}
+		if isModel {
+			m.modelDuration.WithLabelValues(info.Type).Observe(elapsed)
+			m.observeUsage(info.Type, usage)
+		}
+	}()
+	return ctx
+}
+
+func (m *Metrics) start(ctx context.Context) context.Context {
+	_, nested := ctx.Value(metricsRunKey{}).(*metricsRun)
+	return context.WithValue(ctx, metricsRunKey{}, &metricsRun{start: time.Now(), root: !nested})
+}
+
+func (m *Metrics) observeUsage(provider string, usage *model.TokenUsage) {
+	if usage == nil {
+		return
+	}
+	m.modelTokens.WithLabelValues(provider, "input").Add(float64(usage.PromptTokens))
+	m.modelTokens.WithLabelValues(provider, "output").Add(float64(usage.CompletionTokens))
+}
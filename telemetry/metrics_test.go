@@ -0,0 +1,111 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestMetrics(t *testing.T) *Metrics {
+	t.Helper()
+	m, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMetricsModelTokens(t *testing.T) {
+	m := newTestMetrics(t)
+	r := buildGraph(t, &fakeChatModel{})
+
+	if _, err := r.Invoke(context.Background(), "hi", compose.WithCallbacks(m)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Callbacks injected by the graph report the chat model implementation type as provider.
+	provider := "fakeChatModel"
+	if got := testutil.ToFloat64(m.modelTokens.WithLabelValues(provider, "input")); got != 7 {
+		t.Errorf("input tokens = %v", got)
+	}
+	if got := testutil.ToFloat64(m.modelTokens.WithLabelValues(provider, "output")); got != 3 {
+		t.Errorf("output tokens = %v", got)
+	}
+	if got := testutil.CollectAndCount(m.modelDuration); got != 1 {
+		t.Errorf("model duration series = %d", got)
+	}
+}
+
+func TestMetricsStream(t *testing.T) {
+	m := newTestMetrics(t)
+	r := buildGraph(t, &fakeChatModel{})
+
+	sr, err := r.Stream(context.Background(), "hi", compose.WithCallbacks(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := sr.Recv(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sr.Close()
+
+	// Stream metrics are recorded by goroutines once the callback copies are drained.
+	waitFor(t, func() bool {
+		return testutil.CollectAndCount(m.streamDuration) == 1 &&
+			testutil.ToFloat64(m.modelTokens.WithLabelValues("fakeChatModel", "output")) == 3
+	})
+	if got := testutil.CollectAndCount(m.timeToFirstToken); got != 1 {
+		t.Errorf("time to first token series = %d", got)
+	}
+}
+
+func TestMetricsToolsAndRetriever(t *testing.T) {
+	m := newTestMetrics(t)
+	ctx := context.Background()
+
+	toolInfo := &callbacks.RunInfo{Name: "search", Component: components.ComponentOfTool}
+	m.OnEnd(m.OnStart(ctx, toolInfo, nil), toolInfo, nil)
+	m.OnError(m.OnStart(ctx, toolInfo, nil), toolInfo, errors.New("boom"))
+
+	if got := testutil.ToFloat64(m.toolInvocations.WithLabelValues("search")); got != 2 {
+		t.Errorf("tool invocations = %v", got)
+	}
+	if got := testutil.ToFloat64(m.toolErrors.WithLabelValues("search")); got != 1 {
+		t.Errorf("tool errors = %v", got)
+	}
+
+	rtrInfo := &callbacks.RunInfo{Name: "RedisRetriever", Component: components.ComponentOfRetriever}
+	m.OnEnd(m.OnStart(ctx, rtrInfo, nil), rtrInfo, []*schema.Document{{ID: "1"}})
+	m.OnEnd(m.OnStart(ctx, rtrInfo, nil), rtrInfo, []*schema.Document{})
+
+	if got := testutil.ToFloat64(m.retrieverRequests.WithLabelValues("RedisRetriever", "hit")); got != 1 {
+		t.Errorf("retriever hits = %v", got)
+	}
+	if got := testutil.ToFloat64(m.retrieverRequests.WithLabelValues("RedisRetriever", "miss")); got != 1 {
+		t.Errorf("retriever misses = %v", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,445 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"myeino/util"
+)
+
+// Span status codes, matching the OpenTelemetry status codes.
+const (
+	StatusUnset = "UNSET"
+	StatusOK    = "OK"
+	StatusError = "ERROR"
+)
+
+// Span is a finished unit of work in a trace, one per graph node, component or tool call.
+type Span struct {
+	TraceID       string         `json:"trace_id"`
+	SpanID        string         `json:"span_id"`
+	ParentSpanID  string         `json:"parent_span_id,omitempty"`
+	Name          string         `json:"name"`
+	StartTime     time.Time      `json:"start_time"`
+	EndTime       time.Time      `json:"end_time"`
+	DurationMs    float64        `json:"duration_ms"`
+	Attributes    map[string]any `json:"attributes"`
+	StatusCode    string         `json:"status_code"`
+	StatusMessage string         `json:"status_message,omitempty"`
+
+	mu       sync.Mutex
+	finished bool
+}
+
+// SetAttribute records a key/value pair on the span.
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// SpanExporter sends finished spans to a backend.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+// TracerConfig configures a Tracer.
+type TracerConfig struct {
+	Exporter SpanExporter
+	// BatchSize is the number of spans exported at once.
+	BatchSize int
+	// FlushInterval bounds how long a finished span waits before being exported.
+	FlushInterval time.Duration
+	// QueueSize is the number of finished spans buffered before new ones are dropped.
+	QueueSize int
+}
+
+// Tracer is an eino callbacks.Handler producing a span for every graph, node,
+// model, retriever and tool invocation. Pass it with compose.WithCallbacks; nested
+// graphs such as the ReAct agent inherit it through the context.
+type Tracer struct {
+	config *TracerConfig
+	queue  chan *Span
+	flush  chan chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+
+	// streams tracks spans waiting for their output stream to be drained.
+	streams sync.WaitGroup
+}
+
+type spanKey struct{}
+
+// NewTracer creates a Tracer and starts its background exporter.
+func NewTracer(config *TracerConfig) (*Tracer, error) {
+	if config == nil || config.Exporter == nil {
+		return nil, errors.New("exporter cannot be empty")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 64
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 2048
+	}
+
+	t := &Tracer{
+		config: config,
+		queue:  make(chan *Span, config.QueueSize),
+		flush:  make(chan chan struct{}),
+		done:   make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.run()
+	return t, nil
+}
+
+// SpanFromContext returns the span started by the innermost running component, if any.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func (t *Tracer) OnStart(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
+	ctx, span := t.startSpan(ctx, info)
+	recordInput(span, info, input)
+	return ctx
+}
+
+func (t *Tracer) OnEnd(ctx context.Context, info *callbacks.RunInfo, output callbacks.CallbackOutput) context.Context {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return ctx
+	}
+	recordOutput(span, info, output)
+	t.endSpan(span, nil)
+	return ctx
+}
+
+func (t *Tracer) OnError(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+	if span := SpanFromContext(ctx); span != nil {
+		t.endSpan(span, err)
+	}
+	return ctx
+}
+
+func (t *Tracer) OnStartWithStreamInput(ctx context.Context, info *callbacks.RunInfo, input *schema.StreamReader[callbacks.CallbackInput]) context.Context {
+	input.Close()
+	ctx, span := t.startSpan(ctx, info)
+	span.SetAttribute("stream.input", true)
+	return ctx
+}
+
+func (t *Tracer) OnEndWithStreamOutput(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[callbacks.CallbackOutput]) context.Context {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		output.Close()
+		return ctx
+	}
+
+	// The span ends when the stream has been fully consumed, not when the component returns.
+	t.streams.Add(1)
+	go func() {
+		defer t.streams.Done()
+		defer output.Close()
+		var (
+			chunks    int
+			firstAt   time.Time
+			lastUsage *model.TokenUsage
+			streamErr error
+		)
+		for {
+			chunk, err := output.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				streamErr = err
+				break
+			}
+			if chunks == 0 {
+				firstAt = time.Now()
+			}
+			chunks++
+			if info.Component == components.ComponentOfChatModel {
+				if usage := TokenUsageOf(chunk); usage != nil {
+					lastUsage = usage
+				}
+			}
+		}
+
+		span.SetAttribute("stream.chunks", chunks)
+		if !firstAt.IsZero() {
+			span.SetAttribute("stream.time_to_first_chunk_ms", float64(firstAt.Sub(span.StartTime).Microseconds())/1000)
+		}
+		if lastUsage != nil {
+			recordUsage(span, lastUsage)
+		}
+		t.endSpan(span, streamErr)
+	}()
+	return ctx
+}
+
+// Shutdown waits for in-flight streams, exports every pending span and shuts the exporter down.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if err := waitGroup(ctx, &t.streams); err != nil {
+		return err
+	}
+	t.once.Do(func() { close(t.done) })
+	if err := waitGroup(ctx, &t.wg); err != nil {
+		return err
+	}
+	return t.config.Exporter.Shutdown(ctx)
+}
+
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	waited := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ForceFlush exports every span finished so far.
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case t.flush <- ack:
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) startSpan(ctx context.Context, info *callbacks.RunInfo) (context.Context, *Span) {
+	span := &Span{
+		SpanID:     newID(8),
+		Name:       spanName(info),
+		StartTime:  time.Now(),
+		Attributes: map[string]any{},
+		StatusCode: StatusUnset,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.TraceID = newID(16)
+	}
+
+	if info != nil {
+		span.Attributes["eino.component"] = string(info.Component)
+		span.Attributes["eino.type"] = info.Type
+		span.Attributes["eino.name"] = info.Name
+	}
+	if id := util.ConversationIDFromContext(ctx); id != "" {
+		span.Attributes["conversation.id"] = id
+	}
+	if id := util.RequestIDFromContext(ctx); id != "" {
+		span.Attributes["request.id"] = id
+	}
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *Tracer) endSpan(span *Span, err error) {
+	span.mu.Lock()
+	if span.finished {
+		span.mu.Unlock()
+		return
+	}
+	span.finished = true
+	span.EndTime = time.Now()
+	span.DurationMs = float64(span.EndTime.Sub(span.StartTime).Microseconds()) / 1000
+	if err != nil {
+		span.StatusCode = StatusError
+		span.StatusMessage = util.Redact(err.Error())
+	} else {
+		span.StatusCode = StatusOK
+	}
+	span.mu.Unlock()
+
+	select {
+	case t.queue <- span:
+	default:
+		log.Printf("[Tracer] Span queue full, dropping span %s", span.Name)
+	}
+}
+
+func (t *Tracer) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.config.BatchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := t.config.Exporter.ExportSpans(ctx, batch); err != nil {
+			log.Printf("[Tracer] Failed to export %d spans: %v", len(batch), err)
+		}
+		batch = make([]*Span, 0, t.config.BatchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case span := <-t.queue:
+				batch = append(batch, span)
+				if len(batch) >= t.config.BatchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= t.config.BatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ack := <-t.flush:
+			drain()
+			close(ack)
+		case <-t.done:
+			drain()
+			return
+		}
+	}
+}
+
+func spanName(info *callbacks.RunInfo) string {
+	if info == nil {
+		return "unknown"
+	}
+	name := info.Name
+	if name == "" {
+		name = info.Type
+	}
+	if info.Component == "" {
+		return name
+	}
+	return string(info.Component) + "." + name
+}
+
+func recordInput(span *Span, info *callbacks.RunInfo, input callbacks.CallbackInput) {
+	if info == nil {
+		return
+	}
+	switch info.Component {
+	case components.ComponentOfChatModel:
+		if mi := model.ConvCallbackInput(input); mi != nil {
+			span.SetAttribute("model.input_messages", len(mi.Messages))
+			span.SetAttribute("model.tools", len(mi.Tools))
+			if mi.Config != nil && mi.Config.Model != "" {
+				span.SetAttribute("model.name", mi.Config.Model)
+			}
+		}
+	case components.ComponentOfRetriever:
+		if ri := retriever.ConvCallbackInput(input); ri != nil {
+			span.SetAttribute("retriever.query_len", len(ri.Query))
+			span.SetAttribute("retriever.top_k", ri.TopK)
+		}
+	case components.ComponentOfTool:
+		if ti := tool.ConvCallbackInput(input); ti != nil {
+			span.SetAttribute("tool.arguments_len", len(ti.ArgumentsInJSON))
+		}
+	}
+}
+
+func recordOutput(span *Span, info *callbacks.RunInfo, output callbacks.CallbackOutput) {
+	if info == nil {
+		return
+	}
+	switch info.Component {
+	case components.ComponentOfChatModel:
+		if mo := model.ConvCallbackOutput(output); mo != nil {
+			if usage := TokenUsageOf(output); usage != nil {
+				recordUsage(span, usage)
+			}
+			if mo.Message != nil {
+				span.SetAttribute("model.tool_calls", len(mo.Message.ToolCalls))
+			}
+		}
+	case components.ComponentOfRetriever:
+		if ro := retriever.ConvCallbackOutput(output); ro != nil {
+			span.SetAttribute("retriever.documents", len(ro.Docs))
+		}
+	case components.ComponentOfTool:
+		if to := tool.ConvCallbackOutput(output); to != nil {
+			span.SetAttribute("tool.response_len", len(to.Response))
+		}
+	}
+}
+
+// TokenUsageOf returns the token usage carried by a chat model callback output, either reported
+// through the component's own callbacks or, when callbacks are injected by the graph, through
+// the message's response meta. It returns nil if the output has no usage.
+func TokenUsageOf(output callbacks.CallbackOutput) *model.TokenUsage {
+	mo := model.ConvCallbackOutput(output)
+	if mo == nil {
+		return nil
+	}
+	if mo.TokenUsage != nil {
+		return mo.TokenUsage
+	}
+	if mo.Message != nil && mo.Message.ResponseMeta != nil && mo.Message.ResponseMeta.Usage != nil {
+		u := mo.Message.ResponseMeta.Usage
+		return &model.TokenUsage{
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			TotalTokens:      u.TotalTokens,
+		}
+	}
+	return nil
+}
+
+func recordUsage(span *Span, usage *model.TokenUsage) {
+	span.SetAttribute("model.usage.prompt_tokens", usage.PromptTokens)
+	span.SetAttribute("model.usage.completion_tokens", usage.CompletionTokens)
+	span.SetAttribute("model.usage.total_tokens", usage.TotalTokens)
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,285 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"myeino/util"
+)
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *memoryExporter) ExportSpans(_ context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(context.Context) error { return nil }
+
+func (e *memoryExporter) byName(name string) *Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+type fakeChatModel struct {
+	err error
+}
+
+func (f *fakeChatModel) Generate(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	msg := schema.AssistantMessage("hello", nil)
+	msg.ResponseMeta = &schema.ResponseMeta{Usage: &schema.TokenUsage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10}}
+	return msg, nil
+}
+
+func (f *fakeChatModel) Stream(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := f.Generate(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{schema.AssistantMessage("he", nil), msg}), nil
+}
+
+func (f *fakeChatModel) BindTools(tools []*schema.ToolInfo) error { return nil }
+
+func buildGraph(t *testing.T, cm model.ChatModel) compose.Runnable[string, *schema.Message] {
+	t.Helper()
+	g := compose.NewGraph[string, *schema.Message]()
+	_ = g.AddLambdaNode("ToMessages", compose.InvokableLambda(func(ctx context.Context, q string) ([]*schema.Message, error) {
+		return []*schema.Message{schema.UserMessage(q)}, nil
+	}), compose.WithNodeName("ToMessages"))
+	_ = g.AddChatModelNode("ChatModel", cm, compose.WithNodeName("ChatModel"))
+	_ = g.AddEdge(compose.START, "ToMessages")
+	_ = g.AddEdge("ToMessages", "ChatModel")
+	_ = g.AddEdge("ChatModel", compose.END)
+
+	r, err := g.Compile(context.Background(), compose.WithGraphName("TestAgent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func newTestTracer(t *testing.T) (*Tracer, *memoryExporter) {
+	t.Helper()
+	exp := &memoryExporter{}
+	tracer, err := NewTracer(&TracerConfig{Exporter: exp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tracer.Shutdown(context.Background()) })
+	return tracer, exp
+}
+
+func testContext() context.Context {
+	ctx := util.WithRequestID(context.Background(), "req-1")
+	return util.WithConversationID(ctx, "conv-1")
+}
+
+func TestTracerInvoke(t *testing.T) {
+	tracer, exp := newTestTracer(t)
+	r := buildGraph(t, &fakeChatModel{})
+
+	if _, err := r.Invoke(testContext(), "hi", compose.WithCallbacks(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracer.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	root := exp.byName("Graph.TestAgent")
+	cm := exp.byName("ChatModel.ChatModel")
+	lambda := exp.byName("Lambda.ToMessages")
+	if root == nil || cm == nil || lambda == nil {
+		t.Fatalf("missing spans: graph=%v model=%v lambda=%v", root, cm, lambda)
+	}
+
+	if root.ParentSpanID != "" {
+		t.Errorf("graph span should be the root, parent=%s", root.ParentSpanID)
+	}
+	for _, s := range []*Span{cm, lambda} {
+		if s.TraceID != root.TraceID || s.ParentSpanID != root.SpanID {
+			t.Errorf("span %s not a child of the graph span", s.Name)
+		}
+		if s.StatusCode != StatusOK {
+			t.Errorf("span %s status = %s", s.Name, s.StatusCode)
+		}
+		if s.Attributes["conversation.id"] != "conv-1" || s.Attributes["request.id"] != "req-1" {
+			t.Errorf("span %s missing correlation ids: %v", s.Name, s.Attributes)
+		}
+	}
+	if cm.Attributes["model.usage.total_tokens"] != 10 || cm.Attributes["model.usage.prompt_tokens"] != 7 {
+		t.Errorf("token usage not recorded: %v", cm.Attributes)
+	}
+}
+
+func TestTracerStream(t *testing.T) {
+	tracer, exp := newTestTracer(t)
+	r := buildGraph(t, &fakeChatModel{})
+
+	sr, err := r.Stream(testContext(), "hi", compose.WithCallbacks(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := sr.Recv(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sr.Close()
+
+	// The model span ends asynchronously once its stream copy is drained.
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	cm := exp.byName("ChatModel.ChatModel")
+	if cm == nil {
+		t.Fatal("missing chat model span")
+	}
+	if cm.Attributes["stream.chunks"] != 2 {
+		t.Errorf("stream.chunks = %v", cm.Attributes["stream.chunks"])
+	}
+	if _, ok := cm.Attributes["stream.time_to_first_chunk_ms"]; !ok {
+		t.Error("missing time to first chunk")
+	}
+	if cm.Attributes["model.usage.completion_tokens"] != 3 {
+		t.Errorf("token usage not recorded: %v", cm.Attributes)
+	}
+}
+
+func TestTracerError(t *testing.T) {
+	tracer, exp := newTestTracer(t)
+	r := buildGraph(t, &fakeChatModel{err: errors.New("upstream failed, api_key=sk-secret")})
+
+	if _, err := r.Invoke(testContext(), "hi", compose.WithCallbacks(tracer)); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := tracer.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"ChatModel.ChatModel", "Graph.TestAgent"} {
+		s := exp.byName(name)
+		if s == nil {
+			t.Fatalf("missing span %s", name)
+		}
+		if s.StatusCode != StatusError {
+			t.Errorf("span %s status = %s", name, s.StatusCode)
+		}
+		if strings.Contains(s.StatusMessage, "sk-secret") {
+			t.Errorf("span %s leaked secret: %s", name, s.StatusMessage)
+		}
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces", "spans.jsonl")
+	exp, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer, err := NewTracer(&TracerConfig{Exporter: exp})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buildGraph(t, &fakeChatModel{}).Invoke(testContext(), "hi", compose.WithCallbacks(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 spans, got %d:\n%s", len(lines), data)
+	}
+	var span map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &span); err != nil {
+		t.Fatal(err)
+	}
+	if span["trace_id"] == "" || span["attributes"] == nil {
+		t.Errorf("unexpected span: %s", lines[0])
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		body otlpRequest
+		auth string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/v1/traces" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	exp, err := NewOTLPExporter(&OTLPExporterConfig{
+		Endpoint: srv.URL,
+		Headers:  map[string]string{"Authorization": "Basic abc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer, err := NewTracer(&TracerConfig{Exporter: exp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildGraph(t, &fakeChatModel{}).Invoke(testContext(), "hi", compose.WithCallbacks(tracer)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if auth != "Basic abc" {
+		t.Errorf("headers not sent, Authorization=%q", auth)
+	}
+	if len(body.ResourceSpans) != 1 || len(body.ResourceSpans[0].ScopeSpans[0].Spans) != 3 {
+		t.Fatalf("unexpected otlp payload: %+v", body)
+	}
+	if v := body.ResourceSpans[0].Resource.Attributes[0].Value.StringValue; v == nil || *v != "einoagent" {
+		t.Errorf("unexpected service name: %v", v)
+	}
+}
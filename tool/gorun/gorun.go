@@ -0,0 +1,292 @@
+// Package gorun provides run_go_snippet, a tool that vets, builds and runs a Go program written by
+// the model in a throwaway module, so that it can check its examples before giving them to the user.
+package gorun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+)
+
+// ToolName is the name of the tool.
+const ToolName = "run_go_snippet"
+
+// maxCodeBytes bounds the program given by the model.
+const maxCodeBytes = 64 << 10
+
+// Config configures run_go_snippet.
+type Config struct {
+	// GoBin is the go command, default "go" from PATH.
+	GoBin string
+	// ModFile is a go.mod whose requirements the programs may import, with its go.sum next to it,
+	// e.g. the go.mod of this project. The modules must be in the module cache, nothing is downloaded.
+	// Empty allows the standard library only.
+	ModFile string
+	// BuildTimeout bounds go vet and go build together, default 2m.
+	BuildTimeout time.Duration
+	// RunTimeout bounds the run of the program, default 10s. CPU time is limited to the same.
+	RunTimeout time.Duration
+	// MemoryMB limits the memory of the program, default 256.
+	MemoryMB int
+	// MaxOutputBytes bounds the output kept of each step, default 16KiB.
+	MaxOutputBytes int
+}
+
+func (c *Config) withDefaults() *Config {
+	config := Config{}
+	if c != nil {
+		config = *c
+	}
+	if config.GoBin == "" {
+		config.GoBin = "go"
+	}
+	if config.BuildTimeout <= 0 {
+		config.BuildTimeout = 2 * time.Minute
+	}
+	if config.RunTimeout <= 0 {
+		config.RunTimeout = 10 * time.Second
+	}
+	if config.MemoryMB <= 0 {
+		config.MemoryMB = 256
+	}
+	if config.MaxOutputBytes <= 0 {
+		config.MaxOutputBytes = 16 << 10
+	}
+	return &config
+}
+
+// Params are the arguments of run_go_snippet.
+type Params struct {
+	Code string `json:"code" jsonschema:"description=Complete Go program in package main with a main function"`
+}
+
+// Result statuses.
+const (
+	StatusOK          = "ok"
+	StatusBuildFailed = "build_failed"
+	StatusRunFailed   = "run_failed"
+	StatusTimeout     = "timeout"
+)
+
+// Result is returned by run_go_snippet. Invalid programs and failed steps are reported in it, so that
+// the model can correct the program.
+type Result struct {
+	// Status is ok, build_failed, run_failed or timeout.
+	Status string `json:"status"`
+	// Vet has the findings of go vet, the program is built and run anyway.
+	Vet string `json:"vet,omitempty"`
+	// Output has the compiler errors when the build failed, else the output of the program.
+	Output   string `json:"output,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Available tells whether the go command is found and programs can be run in the sandbox.
+func Available(config *Config) error {
+	config = config.withDefaults()
+	if _, err := exec.LookPath(config.GoBin); err != nil {
+		return err
+	}
+	return checkSandbox()
+}
+
+// NewTool creates run_go_snippet. Programs are built without network access to modules, the build
+// does not run their code. They run without network and without access to the files of the server,
+// with limited CPU, memory, processes and file sizes, see sandbox_linux.go.
+func NewTool(ctx context.Context, config *Config) (tool.InvokableTool, error) {
+	config = config.withDefaults()
+	r := &runner{config: config}
+	if err := r.init(ctx); err != nil {
+		return nil, err
+	}
+	return utils.InferTool(ToolName,
+		"Check a Go example before giving it: vet, build and run a complete program in package main, "+
+			"returning the compiler errors or the output. The program may import the standard library and the modules of this project "+
+			"(e.g. github.com/cloudwego/eino), it has no network and runs for at most a few seconds.",
+		func(ctx context.Context, p *Params) (string, error) {
+			res := r.run(ctx, p.Code)
+			data, err := json.Marshal(res)
+			if err != nil {
+				return "", err
+			}
+			return string(data), nil
+		})
+}
+
+// runner keeps the go.mod and the environment of the go command between runs.
+type runner struct {
+	config *Config
+	goMod  []byte
+	goSum  []byte
+	goEnv  []string
+}
+
+var moduleLine = regexp.MustCompile(`(?m)^module\s+\S+.*$`)
+
+func (r *runner) init(ctx context.Context) error {
+	goBin, err := exec.LookPath(r.config.GoBin)
+	if err != nil {
+		return fmt.Errorf("go command not found: %w", err)
+	}
+	r.config.GoBin = goBin
+
+	r.goMod = []byte("module snippet\n\ngo 1.24\n")
+	if r.config.ModFile != "" {
+		data, err := os.ReadFile(r.config.ModFile)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", r.config.ModFile, err)
+		}
+		if !moduleLine.Match(data) {
+			return fmt.Errorf("%s has no module line", r.config.ModFile)
+		}
+		r.goMod = moduleLine.ReplaceAll(data, []byte("module snippet"))
+		r.goSum, err = os.ReadFile(strings.TrimSuffix(r.config.ModFile, ".mod") + ".sum")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	// go 命令只拿到需要的环境变量，模块只从本地缓存读取
+	out, err := exec.CommandContext(ctx, goBin, "env", "-json", "GOCACHE", "GOMODCACHE", "GOPATH").Output()
+	if err != nil {
+		return fmt.Errorf("go env failed: %w", err)
+	}
+	var env map[string]string
+	if err := json.Unmarshal(out, &env); err != nil {
+		return fmt.Errorf("invalid go env output: %w", err)
+	}
+	home, _ := os.UserHomeDir()
+	r.goEnv = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + home,
+		"GOCACHE=" + env["GOCACHE"],
+		"GOMODCACHE=" + env["GOMODCACHE"],
+		"GOPATH=" + env["GOPATH"],
+		"GOPROXY=off",
+		"GOSUMDB=off",
+		"GOFLAGS=-mod=mod",
+		"GOTOOLCHAIN=local",
+		"GOWORK=off",
+		"CGO_ENABLED=0",
+	}
+	return nil
+}
+
+func (r *runner) run(ctx context.Context, code string) *Result {
+	if strings.TrimSpace(code) == "" {
+		return &Result{Status: StatusBuildFailed, Error: "code is empty"}
+	}
+	if len(code) > maxCodeBytes {
+		return &Result{Status: StatusBuildFailed, Error: fmt.Sprintf("code has %d bytes, at most %d are allowed", len(code), maxCodeBytes)}
+	}
+
+	dir, err := os.MkdirTemp("", "gorun-")
+	if err != nil {
+		return &Result{Status: StatusBuildFailed, Error: err.Error()}
+	}
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{"main.go": []byte(code), "go.mod": r.goMod}
+	if r.goSum != nil {
+		files["go.sum"] = r.goSum
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return &Result{Status: StatusBuildFailed, Error: err.Error()}
+		}
+	}
+
+	buildCtx, cancel := context.WithTimeout(ctx, r.config.BuildTimeout)
+	defer cancel()
+	res := &Result{Status: StatusOK}
+	// 先编译，编译错误比 vet 的输出更直接
+	out, err := r.goCommand(buildCtx, dir, "build", "-o", "snippet", ".")
+	if err != nil {
+		res.Status, res.Output = StatusBuildFailed, out
+		if buildCtx.Err() != nil {
+			res.Status, res.Error = StatusTimeout, fmt.Sprintf("the build did not finish within %s", r.config.BuildTimeout)
+		}
+		return res
+	}
+	if out, err := r.goCommand(buildCtx, dir, "vet", "."); err != nil {
+		res.Vet = out
+		if buildCtx.Err() != nil {
+			res.Vet = "go vet did not finish in time"
+		}
+	}
+
+	runCtx, cancelRun := context.WithTimeout(ctx, r.config.RunTimeout)
+	defer cancelRun()
+	output := &limitedBuffer{max: r.config.MaxOutputBytes}
+	cmd := exec.CommandContext(runCtx, filepath.Join(dir, "snippet"))
+	cmd.Env = []string{
+		"HOME=/tmp",
+		"TMPDIR=/tmp",
+		fmt.Sprintf("GOMEMLIMIT=%dMiB", r.config.MemoryMB*3/4),
+		"GOMAXPROCS=2",
+	}
+	cmd.Stdout, cmd.Stderr = output, output
+	cmd.WaitDelay = time.Second
+	err = runSandboxed(cmd, &limits{cpu: r.config.RunTimeout, memoryMB: r.config.MemoryMB, fileBytes: 16 << 20, procs: 64})
+	res.Output = output.String()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case runCtx.Err() != nil && ctx.Err() == nil:
+		res.Status, res.Error = StatusTimeout, fmt.Sprintf("the program did not finish within %s", r.config.RunTimeout)
+	case errors.As(err, &exitErr):
+		res.Status, res.ExitCode = StatusRunFailed, exitErr.ExitCode()
+		if exitErr.ExitCode() < 0 {
+			res.Error = exitErr.String() + ", it may have exceeded its CPU, memory or file size limit"
+		}
+	default:
+		res.Status, res.Error = StatusRunFailed, err.Error()
+	}
+	return res
+}
+
+// goCommand runs the go command in dir and returns its combined output, with the paths of dir removed.
+func (r *runner) goCommand(ctx context.Context, dir string, args ...string) (string, error) {
+	output := &limitedBuffer{max: r.config.MaxOutputBytes}
+	cmd := exec.CommandContext(ctx, r.config.GoBin, args...)
+	cmd.Dir = dir
+	cmd.Env = r.goEnv
+	cmd.Stdout, cmd.Stderr = output, output
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	return strings.ReplaceAll(output.String(), dir+string(filepath.Separator), ""), err
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		b.buf.Write(p[:max(room, 0)])
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + fmt.Sprintf("\n[output truncated to %d bytes]", b.max)
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,161 @@
+package gorun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestTool(t *testing.T) func(code string) *Result {
+	t.Helper()
+	if err := Available(nil); err != nil {
+		t.Skip(err)
+	}
+	// 只依赖 uuid 的 go.mod，go.sum 取自本项目
+	dir := t.TempDir()
+	sum, err := os.ReadFile("../../go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uuidSum []string
+	for _, line := range strings.Split(string(sum), "\n") {
+		if strings.HasPrefix(line, "github.com/google/uuid v1.6.0") {
+			uuidSum = append(uuidSum, line)
+		}
+	}
+	modFile := filepath.Join(dir, "go.mod")
+	_ = os.WriteFile(modFile, []byte("module example.com/test\n\ngo 1.24\n\nrequire github.com/google/uuid v1.6.0\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "go.sum"), []byte(strings.Join(uuidSum, "\n")+"\n"), 0o644)
+
+	run, err := NewTool(context.Background(), &Config{ModFile: modFile, RunTimeout: 2 * time.Second, MemoryMB: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(code string) *Result {
+		t.Helper()
+		args, _ := json.Marshal(&Params{Code: code})
+		out, err := run.InvokableRun(context.Background(), string(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res Result
+		if err := json.Unmarshal([]byte(out), &res); err != nil {
+			t.Fatalf("invalid result %q: %v", out, err)
+		}
+		return &res
+	}
+}
+
+func program(body string, imports ...string) string {
+	var b strings.Builder
+	b.WriteString("package main\n\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "import %q\n", imp)
+	}
+	fmt.Fprintf(&b, "\nfunc main() {\n%s\n}\n", body)
+	return b.String()
+}
+
+func TestRun(t *testing.T) {
+	run := newTestTool(t)
+
+	res := run(program(`fmt.Println("hello", len(uuid.NewString()))`, "fmt", "github.com/google/uuid"))
+	if res.Status != StatusOK || res.Output != "hello 36\n" || res.Vet != "" {
+		t.Errorf("hello = %+v", res)
+	}
+
+	res = run(program(`fmt.Println(undefined)`, "fmt"))
+	if res.Status != StatusBuildFailed || !strings.Contains(res.Output, "./main.go:6:13: undefined: undefined") {
+		t.Errorf("build error = %+v", res)
+	}
+	if res := run(program(`fmt.Println(1)`, "fmt", "github.com/cloudwego/missing")); res.Status != StatusBuildFailed {
+		t.Errorf("module outside go.mod = %+v", res)
+	}
+
+	// vet 的问题和运行结果一起返回
+	res = run(program(`fmt.Printf("%d\n", "one"); os.Exit(3)`, "fmt", "os"))
+	if res.Status != StatusRunFailed || res.ExitCode != 3 || !strings.Contains(res.Vet, "wrong type") || !strings.Contains(res.Output, "%!d(string=one)") {
+		t.Errorf("vet = %+v", res)
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	run := newTestTool(t)
+
+	if res := run(program(`for {}`)); res.Status != StatusTimeout {
+		t.Errorf("endless loop = %+v", res)
+	}
+
+	data := program(`b := make([]byte, 512<<20); for i := range b { b[i] = 1 }; fmt.Println(len(b))`, "fmt")
+	if res := run(data); res.Status != StatusRunFailed || strings.Contains(res.Output, "536870912") {
+		t.Errorf("memory = %+v", res)
+	}
+
+	// 程序看不到本机的网络
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	dial := program(fmt.Sprintf(`_, err := net.Dial("tcp", %q); fmt.Println(err != nil)`, ln.Addr()), "fmt", "net")
+	if res := run(dial); res.Status != StatusOK || res.Output != "true\n" {
+		t.Errorf("network = %+v", res)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	run := newTestTool(t)
+
+	// 程序只看到自己的根目录：读不到服务的文件，除了 /tmp 都不能写
+	self, err := filepath.Abs("gorun_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := program(fmt.Sprintf(`
+	for _, path := range []string{%q, "/etc/passwd", "/proc/self/environ"} {
+		_, err := os.ReadFile(path)
+		fmt.Println("read", err == nil)
+	}
+	fmt.Println("write root", os.WriteFile("/x", nil, 0o644) == nil)
+	fmt.Println("write tmp", os.WriteFile("/tmp/x", []byte("x"), 0o644) == nil)
+	fmt.Println("uid", os.Getuid() != 0)`, self), "fmt", "os")
+	want := "read false\nread false\nread false\nwrite root false\nwrite tmp true\nuid " + fmt.Sprint(os.Getuid() == 0) + "\n"
+	if res := run(files); res.Status != StatusOK || res.Output != want {
+		t.Errorf("files = %+v", res)
+	}
+
+	// 进程数受限，子进程随程序结束
+	procs := program(`
+	if os.Getenv("CHILD") != "" {
+		time.Sleep(time.Minute)
+		return
+	}
+	started := 0
+	for range 200 {
+		p, err := os.StartProcess("/program", []string{"program"}, &os.ProcAttr{Env: []string{"CHILD=1"}})
+		if err != nil {
+			break
+		}
+		defer p.Kill()
+		started++
+	}
+	fmt.Println(started > 0 && started < 200)`, "fmt", "os", "time")
+	if res := run(procs); res.Status != StatusOK || res.Output != "true\n" {
+		t.Errorf("processes = %+v", res)
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{max: 4}
+	fmt.Fprint(b, "ab")
+	fmt.Fprint(b, "cdef")
+	if got := b.String(); got != "abcd\n[output truncated to 4 bytes]" {
+		t.Errorf("buffer = %q", got)
+	}
+}
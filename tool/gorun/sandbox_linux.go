@@ -0,0 +1,292 @@
+package gorun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// limits are the resource limits of a program.
+type limits struct {
+	cpu       time.Duration
+	memoryMB  int
+	fileBytes int64
+	// procs bounds the processes and threads of the program, the Go runtime needs a few.
+	procs int
+}
+
+// args encodes l for the sandbox helper.
+func (l *limits) args() []string {
+	return []string{
+		strconv.FormatInt(int64(max(l.cpu/time.Second, 1)), 10),
+		strconv.Itoa(l.memoryMB),
+		strconv.FormatInt(l.fileBytes, 10),
+		strconv.Itoa(l.procs),
+	}
+}
+
+func parseLimits(args []string) (*limits, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf("want 4 limits, got %d", len(args))
+	}
+	var n [4]int64
+	for i, arg := range args {
+		v, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid limit %q", arg)
+		}
+		n[i] = v
+	}
+	return &limits{cpu: time.Duration(n[0]) * time.Second, memoryMB: int(n[1]), fileBytes: n[2], procs: int(n[3])}, nil
+}
+
+// The program runs as sandboxUID when the server runs as root, otherwise as the uid of the server
+// without any capability. Either way it only sees its own root directory.
+const (
+	sandboxUID = 65534
+	sandboxGID = 65534
+)
+
+// sandboxArg0 is os.Args[0] of the sandbox helper: the server runs itself again in the namespaces
+// of the sandbox, the helper prepares the root directory and the limits, then executes the program.
+const sandboxArg0 = "gorun-sandbox"
+
+// sandboxCheck is given instead of a program to check that the sandbox can be set up.
+const sandboxCheck = "-check"
+
+func init() {
+	if len(os.Args) < 2 || os.Args[0] != sandboxArg0 {
+		return
+	}
+	// 只在沙箱的辅助进程中执行，成功时被程序替换，不会返回
+	if err := sandboxMain(os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(125)
+	}
+	os.Exit(0)
+}
+
+// sandbox runs the helper for program in new user, mount, pid, network, IPC and UTS namespaces, in
+// its own process group, so that the program and its children are killed with it.
+func sandbox(cmd *exec.Cmd, program string, l *limits) {
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = append([]string{sandboxArg0, program}, l.args()...)
+	cmd.Dir = "/"
+	uid, gid := os.Getuid(), os.Getgid()
+	attr := &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}},
+		Setpgid:     true,
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	// 只有 root 能映射其他用户，程序以 nobody 运行
+	if uid == 0 {
+		attr.UidMappings = append(attr.UidMappings, syscall.SysProcIDMap{ContainerID: sandboxUID, HostID: sandboxUID, Size: 1})
+		attr.GidMappings = append(attr.GidMappings, syscall.SysProcIDMap{ContainerID: sandboxGID, HostID: sandboxGID, Size: 1})
+		attr.GidMappingsEnableSetgroups = true
+	}
+	cmd.SysProcAttr = attr
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// runSandboxed runs the program of cmd in the sandbox with l. The program only sees a read-only root
+// with itself, /dev/null, /dev/zero, /dev/urandom and a writable /tmp of l.fileBytes. The limits are
+// set before it starts: RLIMIT_DATA bounds its memory, RLIMIT_AS cannot be used as the Go runtime
+// reserves much more address space than it uses. The program is the first process of its pid
+// namespace, its children are killed when it ends.
+func runSandboxed(cmd *exec.Cmd, l *limits) error {
+	sandbox(cmd, cmd.Path, l)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the program in the sandbox: %w", err)
+	}
+	return cmd.Wait()
+}
+
+// sandboxMain runs in the helper, as root of the new user namespace.
+func sandboxMain(program string, args []string) error {
+	l, err := parseLimits(args)
+	if err != nil {
+		return err
+	}
+	// 权限和能力是线程的属性，设置和 exec 必须在同一个线程中
+	runtime.LockOSThread()
+	// 换根目录之后就看不到 /proc 了
+	switchUser := uidMapped(sandboxUID)
+
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	// 新的根目录是 /tmp 上的 tmpfs，只有程序和几个设备；程序可能就在 /tmp 中，先打开它
+	const root = "/tmp"
+	var size int64 = 1 << 20
+	var in *os.File
+	if program != sandboxCheck {
+		if in, err = os.Open(program); err != nil {
+			return err
+		}
+		defer in.Close()
+		info, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+	}
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, fmt.Sprintf("size=%d,mode=755", size)); err != nil {
+		return fmt.Errorf("failed to mount the root: %w", err)
+	}
+	if in != nil {
+		if err := copyProgram(in, filepath.Join(root, "program")); err != nil {
+			return err
+		}
+	}
+	for _, dir := range []string{"dev", "tmp", ".old"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			return err
+		}
+	}
+	for _, dev := range []string{"null", "zero", "urandom"} {
+		target := filepath.Join(root, "dev", dev)
+		if err := os.WriteFile(target, nil, 0o644); err != nil {
+			return err
+		}
+		if err := unix.Mount("/dev/"+dev, target, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("failed to mount /dev/%s: %w", dev, err)
+		}
+	}
+	if err := unix.Mount("tmpfs", filepath.Join(root, "tmp"), "tmpfs", unix.MS_NOSUID|unix.MS_NODEV,
+		fmt.Sprintf("size=%d,mode=1777", l.fileBytes)); err != nil {
+		return fmt.Errorf("failed to mount /tmp: %w", err)
+	}
+
+	if err := unix.PivotRoot(root, filepath.Join(root, ".old")); err != nil {
+		return fmt.Errorf("pivot_root failed: %w", err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Unmount("/.old", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach the host root: %w", err)
+	}
+	if err := os.Remove("/.old"); err != nil {
+		return err
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("failed to make the root read-only: %w", err)
+	}
+	if err := unix.Chdir("/tmp"); err != nil {
+		return err
+	}
+
+	memory := uint64(l.memoryMB) << 20
+	for resource, limit := range map[int]uint64{
+		unix.RLIMIT_CPU:    uint64(l.cpu / time.Second),
+		unix.RLIMIT_DATA:   memory,
+		unix.RLIMIT_FSIZE:  uint64(l.fileBytes),
+		unix.RLIMIT_NPROC:  uint64(l.procs),
+		unix.RLIMIT_NOFILE: 256,
+		unix.RLIMIT_CORE:   0,
+	} {
+		if err := unix.Setrlimit(resource, &unix.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return fmt.Errorf("failed to set limit %d: %w", resource, err)
+		}
+	}
+	if err := dropPrivileges(switchUser); err != nil {
+		return err
+	}
+	if program == sandboxCheck {
+		return nil
+	}
+	return unix.Exec("/program", []string{"program"}, os.Environ())
+}
+
+// dropPrivileges removes every capability and switches to sandboxUID if switchUser, so that the
+// program cannot undo the mounts or raise its limits.
+func dropPrivileges(switchUser bool) error {
+	for c := 0; c <= unix.CAP_LAST_CAP; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && !errors.Is(err, unix.EINVAL) {
+			return fmt.Errorf("failed to drop capability %d: %w", c, err)
+		}
+	}
+	if switchUser {
+		if err := unix.Setgroups(nil); err != nil {
+			return fmt.Errorf("setgroups failed: %w", err)
+		}
+		if err := unix.Setresgid(sandboxGID, sandboxGID, sandboxGID); err != nil {
+			return fmt.Errorf("setresgid failed: %w", err)
+		}
+		if err := unix.Setresuid(sandboxUID, sandboxUID, sandboxUID); err != nil {
+			return fmt.Errorf("setresuid failed: %w", err)
+		}
+	}
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to clear capabilities: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	return nil
+}
+
+// uidMapped tells whether uid is mapped in the user namespace of the process.
+func uidMapped(uid int) bool {
+	data, err := os.ReadFile("/proc/self/uid_map")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		var inside, outside, count int
+		if n, _ := fmt.Sscan(line, &inside, &outside, &count); n == 3 && uid >= inside && uid < inside+count {
+			return true
+		}
+	}
+	return false
+}
+
+func copyProgram(in *os.File, dst string) error {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o555)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy the program: %w", err)
+	}
+	return out.Close()
+}
+
+var (
+	sandboxOnce sync.Once
+	sandboxErr  error
+)
+
+// checkSandbox tells whether the sandbox can be set up, container runtimes often forbid namespaces.
+func checkSandbox() error {
+	sandboxOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "/proc/self/exe")
+		sandbox(cmd, sandboxCheck, &limits{cpu: time.Second, memoryMB: 64, fileBytes: 1 << 20, procs: 16})
+		if out, err := cmd.CombinedOutput(); err != nil {
+			sandboxErr = fmt.Errorf("sandbox unavailable: %w: %s", err, out)
+		}
+	})
+	return sandboxErr
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package gorun
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// errNoSandbox is returned on platforms without a sandbox, programs are never run unrestricted.
+var errNoSandbox = errors.New("sandbox unavailable: running Go programs needs Linux namespaces")
+
+type limits struct {
+	cpu       time.Duration
+	memoryMB  int
+	fileBytes int64
+	procs     int
+}
+
+func runSandboxed(cmd *exec.Cmd, l *limits) error {
+	return errNoSandbox
+}
+
+func checkSandbox() error {
+	return errNoSandbox
+}
@@ -0,0 +1,88 @@
+// Package httptool turns REST endpoints into agent tools. Endpoints come from an OpenAPI 3 spec
+// or from a short YAML definition; every operation becomes one tool whose parameters are the
+// path, query, header and body parameters of the operation.
+package httptool
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/invopop/yaml"
+)
+
+// Config describes a REST service, e.g.
+//
+//	base_url: http://todo.internal/api
+//	headers:
+//	  Authorization: Bearer ${TODO_API_TOKEN}
+//	endpoints:
+//	  - name: add_todo
+//	    description: Add a todo item
+//	    method: POST
+//	    path: /todos
+//	    params:
+//	      - {name: content, type: string, required: true, description: The content of the todo item}
+//	      - {name: deadline, type: integer, description: The deadline as a unix timestamp}
+type Config struct {
+	// BaseURL prefixes the paths of the operations, default the first server of the spec.
+	BaseURL string `json:"base_url,omitempty"`
+	// Spec is the path of an OpenAPI 3 spec in JSON or YAML, relative to the config file.
+	Spec string `json:"spec,omitempty"`
+	// Operations keeps only these operations of the spec, named by operation ID or, without one,
+	// by method and path like get_todos_id. Empty keeps all.
+	Operations []string `json:"operations,omitempty"`
+	// Endpoints are defined without a spec.
+	Endpoints []*Endpoint `json:"endpoints,omitempty"`
+	// Headers are sent with every call, ${VAR} is replaced with the environment variable VAR
+	// so that tokens stay out of the file.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout of a call, e.g. "10s", default 30s.
+	Timeout string `json:"timeout,omitempty"`
+	// MaxResponseBytes caps the result given to the model, default 16 KiB.
+	MaxResponseBytes int `json:"max_response_bytes,omitempty"`
+	// MaxItems caps the elements kept of each JSON array in a response, default 20.
+	MaxItems int `json:"max_items,omitempty"`
+
+	// HTTPClient sends the calls, default a client with Timeout.
+	HTTPClient *http.Client `json:"-"`
+}
+
+// Endpoint is an operation defined without a spec.
+type Endpoint struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Params      []*Param `json:"params,omitempty"`
+}
+
+// Param is a parameter of an Endpoint.
+type Param struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// In is path, query, header or body. By default parameters named in the path are path parameters,
+	// the others are query parameters of GET and DELETE and JSON body fields otherwise.
+	In string `json:"in,omitempty"`
+	// Type is string (default), integer, number, boolean, array (of strings) or object.
+	Type     string   `json:"type,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Enum     []string `json:"enum,omitempty"`
+}
+
+// LoadConfig reads a YAML or JSON service config. A relative spec path is resolved against the file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read http tool config: %w", err)
+	}
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid http tool config %s: %w", path, err)
+	}
+	if c.Spec != "" && !filepath.IsAbs(c.Spec) {
+		c.Spec = filepath.Join(filepath.Dir(path), c.Spec)
+	}
+	return &c, nil
+}
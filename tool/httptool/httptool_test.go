@@ -0,0 +1,296 @@
+package httptool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+)
+
+// recordedRequest is a call received by the test service.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Auth   string
+	Body   string
+}
+
+// newTestService answers every call with the handler of its path, recording the calls.
+func newTestService(t *testing.T, routes map[string]string) (*httptest.Server, func() []recordedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		calls = append(calls, recordedRequest{r.Method, r.URL.EscapedPath(), r.URL.RawQuery, r.Header.Get("Authorization"), string(body)})
+		mu.Unlock()
+		resp, ok := routes[r.Method+" "+r.URL.Path]
+		if !ok {
+			http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(calls)
+	}
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func toolsByName(t *testing.T, tools []tool.InvokableTool) map[string]tool.InvokableTool {
+	t.Helper()
+	byName := map[string]tool.InvokableTool{}
+	for _, tl := range tools {
+		info, err := tl.Info(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		byName[info.Name] = tl
+	}
+	return byName
+}
+
+func run(t *testing.T, tl tool.InvokableTool, args string) *result {
+	t.Helper()
+	out, err := tl.InvokableRun(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res result
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid result %s: %v", out, err)
+	}
+	return &res
+}
+
+func TestEndpointTools(t *testing.T) {
+	items := make([]string, 30)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"id":%d,"note":null}`, i)
+	}
+	srv, calls := newTestService(t, map[string]string{
+		"POST /api/todos":      `{"msg":"add todo success"}`,
+		"GET /api/todos":       "[" + strings.Join(items, ",") + "]",
+		"GET /api/todos/a b/c": `{"id":"a b/c"}`,
+	})
+	t.Setenv("TODO_API_TOKEN", "secret")
+	path := writeTestFile(t, "todo.yaml", fmt.Sprintf(`
+base_url: %s/api
+headers:
+  Authorization: Bearer ${TODO_API_TOKEN}
+max_items: 5
+endpoints:
+  - name: add_todo
+    description: Add a todo item
+    method: POST
+    path: /todos
+    params:
+      - {name: content, required: true}
+      - {name: deadline, type: integer}
+  - name: list_todos
+    path: /todos
+    params:
+      - {name: status, enum: [open, done]}
+      - {name: tag, type: array}
+  - name: get_todo
+    path: /todos/{id}
+    params:
+      - {name: id}
+`, srv.URL))
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools, err := NewTools(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := toolsByName(t, tools)
+
+	info, _ := byName["add_todo"].Info(context.Background())
+	params, err := info.ParamsOneOf.ToJSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Properties.Len() != 2 || !slices.Equal(params.Required, []string{"content"}) {
+		t.Errorf("add_todo params = %+v", params)
+	}
+
+	if res := run(t, byName["add_todo"], `{"content":"write tests","deadline":1700000000}`); res.Status != 200 {
+		t.Errorf("add_todo = %+v", res)
+	}
+	res := run(t, byName["list_todos"], `{"status":"open","tag":["a","b"]}`)
+	list, _ := res.Body.([]any)
+	if len(list) != 6 || list[5] != "... 25 more items" || strings.Contains(fmt.Sprint(list[0]), "note") {
+		t.Errorf("list not trimmed: %+v", res.Body)
+	}
+	if res := run(t, byName["get_todo"], `{"id":"a b/c"}`); res.Status != 200 {
+		t.Errorf("get_todo = %+v", res)
+	}
+	if res := run(t, byName["get_todo"], `{"id":".."}`); res.Error == "" || res.Status != 0 {
+		t.Errorf("traversal sent: %+v", res)
+	}
+	if res := run(t, byName["add_todo"], `{}`); !strings.Contains(res.Error, "content") {
+		t.Errorf("missing parameter not reported: %+v", res)
+	}
+
+	want := []recordedRequest{
+		{"POST", "/api/todos", "", "Bearer secret", `{"content":"write tests","deadline":1700000000}`},
+		{"GET", "/api/todos", "status=open&tag=a&tag=b", "Bearer secret", ""},
+		{"GET", "/api/todos/a%20b%2Fc", "", "Bearer secret", ""},
+	}
+	if got := calls(); !slices.Equal(got, want) {
+		t.Errorf("calls = %+v\nwant %+v", got, want)
+	}
+}
+
+const petSpec = `
+openapi: 3.0.3
+info: {title: Pets, version: "1"}
+servers:
+  - url: %s
+paths:
+  /pets/{petId}:
+    parameters:
+      - {name: petId, in: path, required: true, schema: {type: integer}}
+    get:
+      operationId: getPet
+      summary: Get a pet
+      responses:
+        "200": {description: ok}
+    delete:
+      operationId: deletePet
+      responses:
+        "204": {description: deleted}
+  /pets:
+    post:
+      operationId: createPet
+      summary: Create a pet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name: {type: string}
+                tags: {type: array, items: {type: string}}
+      responses:
+        "201": {description: created}
+  /pets/{petId}/photos:
+    put:
+      parameters:
+        - {name: petId, in: path, required: true, schema: {type: integer}}
+      requestBody:
+        content:
+          application/json:
+            schema: {type: array, items: {type: string}}
+      responses:
+        "200": {description: ok}
+`
+
+func TestOpenAPISpec(t *testing.T) {
+	srv, calls := newTestService(t, map[string]string{
+		"GET /pets/7":        `{"id":7,"name":"Tom","owner":null}`,
+		"POST /pets":         `{"id":8}`,
+		"PUT /pets/7/photos": `{}`,
+	})
+	spec := writeTestFile(t, "pets.yaml", fmt.Sprintf(petSpec, srv.URL))
+
+	tools, err := NewTools(context.Background(), &Config{Spec: spec, Operations: []string{"getPet", "createPet"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := toolsByName(t, tools)
+	if len(byName) != 2 || byName["getPet"] == nil || byName["createPet"] == nil {
+		t.Fatalf("tools = %v", byName)
+	}
+
+	all, err := NewTools(context.Background(), &Config{Spec: spec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName = toolsByName(t, all)
+	if len(byName) != 4 || byName["put_pets_petId_photos"] == nil {
+		t.Fatalf("tools = %v", byName)
+	}
+
+	info, _ := byName["createPet"].Info(context.Background())
+	params, err := info.ParamsOneOf.ToJSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Properties.Len() != 2 || !slices.Equal(params.Required, []string{"name"}) || info.Desc != "Create a pet" {
+		t.Errorf("createPet = %+v, params %+v", info, params)
+	}
+
+	if res := run(t, byName["getPet"], `{"petId":7}`); fmt.Sprint(res.Body) != "map[id:7 name:Tom]" {
+		t.Errorf("getPet = %+v", res)
+	}
+	if res := run(t, byName["createPet"], `{"name":"Rex","tags":["dog"]}`); res.Status != 200 {
+		t.Errorf("createPet = %+v", res)
+	}
+	if res := run(t, byName["put_pets_petId_photos"], `{"petId":7,"body":["a.png"]}`); res.Status != 200 {
+		t.Errorf("photos = %+v", res)
+	}
+	if res := run(t, byName["deletePet"], `{"petId":9}`); res.Status != 404 || res.Error == "" {
+		t.Errorf("deletePet = %+v", res)
+	}
+
+	got := calls()
+	if len(got) != 4 || got[1].Body != `{"name":"Rex","tags":["dog"]}` || got[2].Body != `["a.png"]` || got[3].Method != "DELETE" {
+		t.Errorf("calls = %+v", got)
+	}
+}
+
+func TestTrimBody(t *testing.T) {
+	tl := &endpointTool{config: &Config{MaxResponseBytes: 64, MaxItems: 2}}
+	tests := []struct {
+		name      string
+		body      string
+		want      string
+		truncated bool
+	}{
+		{"json", `{"a": 1, "b": null, "c": [1, 2, 3]}`, `{"a":1,"c":[1,2,"... 1 more items"]}`, false},
+		{"text", "plain text", "plain text", false},
+		{"long text", strings.Repeat("x", 70), strings.Repeat("x", 64), true},
+		{"long json", `{"a":"` + strings.Repeat("y", 80) + `"}`, `{"a":"` + strings.Repeat("y", 58), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, truncated := tl.trimBody([]byte(tt.body))
+			got := fmt.Sprint(body)
+			if raw, ok := body.(json.RawMessage); ok {
+				got = string(raw)
+			}
+			if got != tt.want || truncated != tt.truncated {
+				t.Errorf("trimBody() = %s, %v, want %s, %v", got, truncated, tt.want, tt.truncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package httptool
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Parameter locations. inRawBody sends the argument itself as the JSON body.
+const (
+	inPath    = "path"
+	inQuery   = "query"
+	inHeader  = "header"
+	inBody    = "body"
+	inRawBody = "raw_body"
+)
+
+// rawBodyParam names the argument holding a request body that is not a JSON object.
+const rawBodyParam = "body"
+
+// operation is an HTTP call, defined by an Endpoint or by a spec.
+type operation struct {
+	name        string
+	description string
+	method      string
+	path        string
+	// in maps the arguments to their location
+	in     map[string]string
+	params *openapi3.Schema
+}
+
+var toolName = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// operationName derives a tool name for an operation without an ID, e.g. get_todos_id.
+func operationName(method, path string) string {
+	name := strings.ToLower(method) + "_" + strings.Trim(toolName.ReplaceAllString(path, "_"), "_")
+	return strings.Trim(name, "_")
+}
+
+func newOperation(name, description, method, path string) *operation {
+	return &operation{
+		name:        name,
+		description: description,
+		method:      strings.ToUpper(method),
+		path:        path,
+		in:          map[string]string{},
+		params:      openapi3.NewObjectSchema(),
+	}
+}
+
+func (op *operation) addParam(name, in string, s *openapi3.Schema, required bool) error {
+	if _, ok := op.in[name]; ok {
+		return fmt.Errorf("operation %s: parameter %s is defined twice", op.name, name)
+	}
+	op.in[name] = in
+	op.params.WithProperty(name, s)
+	if required {
+		op.params.Required = append(op.params.Required, name)
+	}
+	return nil
+}
+
+// fromEndpoint converts an Endpoint of the config.
+func fromEndpoint(e *Endpoint) (*operation, error) {
+	if e.Name == "" || e.Path == "" {
+		return nil, fmt.Errorf("endpoint %q: name and path are required", e.Name)
+	}
+	method := e.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	op := newOperation(e.Name, e.Description, method, e.Path)
+	for _, p := range e.Params {
+		in := p.In
+		if in == "" {
+			switch {
+			case strings.Contains(e.Path, "{"+p.Name+"}"):
+				in = inPath
+			case op.method == http.MethodGet || op.method == http.MethodDelete:
+				in = inQuery
+			default:
+				in = inBody
+			}
+		}
+		if !slices.Contains([]string{inPath, inQuery, inHeader, inBody}, in) {
+			return nil, fmt.Errorf("endpoint %s: parameter %s has unknown location %s", e.Name, p.Name, in)
+		}
+		s, err := paramSchema(p)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", e.Name, err)
+		}
+		if err := op.addParam(p.Name, in, s, p.Required || in == inPath); err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+func paramSchema(p *Param) (*openapi3.Schema, error) {
+	var s *openapi3.Schema
+	switch p.Type {
+	case "", "string":
+		s = openapi3.NewStringSchema()
+	case "integer":
+		s = openapi3.NewIntegerSchema()
+	case "number":
+		s = openapi3.NewFloat64Schema()
+	case "boolean":
+		s = openapi3.NewBoolSchema()
+	case "array":
+		s = openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())
+	case "object":
+		s = openapi3.NewObjectSchema()
+	default:
+		return nil, fmt.Errorf("parameter %s has unknown type %s", p.Name, p.Type)
+	}
+	s.Description = p.Description
+	for _, v := range p.Enum {
+		s.Enum = append(s.Enum, v)
+	}
+	return s, nil
+}
+
+// loadSpec converts the operations of an OpenAPI 3 spec, keeping only the listed tool names if any.
+func loadSpec(ctx context.Context, path string, only []string) ([]*operation, string, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load spec %s: %w", path, err)
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, "", fmt.Errorf("invalid spec %s: %w", path, err)
+	}
+	var baseURL string
+	if len(doc.Servers) > 0 {
+		baseURL = doc.Servers[0].URL
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var ops []*operation
+	for _, p := range paths {
+		item := doc.Paths[p]
+		methods := make([]string, 0, len(item.Operations()))
+		for m := range item.Operations() {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		for _, m := range methods {
+			o := item.Operations()[m]
+			if len(only) > 0 && !slices.Contains(only, specName(m, p, o)) {
+				continue
+			}
+			op, err := fromSpec(m, p, item, o)
+			if err != nil {
+				return nil, "", err
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, baseURL, nil
+}
+
+// specName returns the tool name of an operation of a spec.
+func specName(method, path string, o *openapi3.Operation) string {
+	if o.OperationID == "" {
+		return operationName(method, path)
+	}
+	return toolName.ReplaceAllString(o.OperationID, "_")
+}
+
+func fromSpec(method, path string, item *openapi3.PathItem, o *openapi3.Operation) (*operation, error) {
+	description := o.Summary
+	if o.Description != "" {
+		description = strings.TrimSpace(strings.Join([]string{o.Summary, o.Description}, "\n"))
+	}
+	op := newOperation(specName(method, path, o), description, method, path)
+
+	// 路径级参数可以被操作级同名参数覆盖
+	params := map[string]*openapi3.Parameter{}
+	var order []string
+	for _, ref := range slices.Concat(item.Parameters, o.Parameters) {
+		p := ref.Value
+		if p == nil || p.In == openapi3.ParameterInCookie {
+			continue
+		}
+		if _, ok := params[p.Name]; !ok {
+			order = append(order, p.Name)
+		}
+		params[p.Name] = p
+	}
+	for _, n := range order {
+		p := params[n]
+		s := openapi3.NewStringSchema()
+		if p.Schema != nil && p.Schema.Value != nil {
+			copied := *p.Schema.Value
+			s = &copied
+		}
+		if p.Description != "" {
+			s.Description = p.Description
+		}
+		if err := op.addParam(p.Name, p.In, s, p.Required); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.RequestBody == nil || o.RequestBody.Value == nil {
+		return op, nil
+	}
+	media := o.RequestBody.Value.Content.Get("application/json")
+	if media == nil || media.Schema == nil || media.Schema.Value == nil {
+		return nil, fmt.Errorf("operation %s: only JSON request bodies are supported", op.name)
+	}
+	body := media.Schema.Value
+	// JSON 对象的字段直接作为工具参数，其它类型的请求体作为 body 参数
+	if body.Type != openapi3.TypeObject || len(body.Properties) == 0 {
+		return op, op.addParam(rawBodyParam, inRawBody, body, o.RequestBody.Value.Required)
+	}
+	names := make([]string, 0, len(body.Properties))
+	for n := range body.Properties {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := op.addParam(n, inBody, body.Properties[n].Value, slices.Contains(body.Required, n)); err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
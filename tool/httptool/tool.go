@@ -0,0 +1,292 @@
+package httptool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	// maxRawBytes caps the response read from the service, before trimming.
+	maxRawBytes = 4 << 20
+	// maxStringRunes caps the strings of a JSON response.
+	maxStringRunes = 2000
+)
+
+// NewTools creates one tool per operation of the service.
+func NewTools(ctx context.Context, config *Config) ([]tool.InvokableTool, error) {
+	c := *config
+	if c.MaxResponseBytes <= 0 {
+		c.MaxResponseBytes = 16 << 10
+	}
+	if c.MaxItems <= 0 {
+		c.MaxItems = 20
+	}
+	if c.HTTPClient == nil {
+		timeout := 30 * time.Second
+		if c.Timeout != "" {
+			d, err := time.ParseDuration(c.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout %q: %w", c.Timeout, err)
+			}
+			timeout = d
+		}
+		c.HTTPClient = &http.Client{Timeout: timeout}
+	}
+	headers := http.Header{}
+	for k, v := range c.Headers {
+		headers.Set(k, os.ExpandEnv(v))
+	}
+
+	var ops []*operation
+	if c.Spec != "" {
+		specOps, specURL, err := loadSpec(ctx, c.Spec, c.Operations)
+		if err != nil {
+			return nil, err
+		}
+		if c.BaseURL == "" {
+			c.BaseURL = specURL
+		}
+		ops = append(ops, specOps...)
+	}
+	for _, e := range c.Endpoints {
+		op, err := fromEndpoint(e)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	base, err := url.Parse(c.BaseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q", c.BaseURL)
+	}
+
+	tools := make([]tool.InvokableTool, 0, len(ops))
+	seen := map[string]bool{}
+	for _, op := range ops {
+		if seen[op.name] {
+			return nil, fmt.Errorf("operation %s is defined twice", op.name)
+		}
+		seen[op.name] = true
+		tools = append(tools, &endpointTool{op: op, base: base, headers: headers, config: &c})
+	}
+	return tools, nil
+}
+
+// endpointTool calls one operation.
+type endpointTool struct {
+	op      *operation
+	base    *url.URL
+	headers http.Header
+	config  *Config
+}
+
+func (t *endpointTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name:        t.op.name,
+		Desc:        t.op.description,
+		ParamsOneOf: schema.NewParamsOneOfByOpenAPIV3(t.op.params),
+	}, nil
+}
+
+// result is returned to the model, failures of the service are results too so that it can react.
+type result struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Body   any    `json:"body,omitempty"`
+	// Truncated reports that Body was cut to fit MaxResponseBytes.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func (t *endpointTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	req, err := t.newRequest(ctx, argumentsInJSON)
+	if err != nil {
+		return marshalResult(&result{Error: err.Error()}), nil
+	}
+	resp, err := t.config.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return marshalResult(&result{Error: fmt.Sprintf("%s %s failed: %v", req.Method, req.URL.Path, err)}), nil
+	}
+	defer resp.Body.Close()
+
+	// 多读一个字节用于判断是否超出上限
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRawBytes+1))
+	if err != nil {
+		return marshalResult(&result{Status: resp.StatusCode, Error: fmt.Sprintf("failed to read the response: %v", err)}), nil
+	}
+	res := &result{Status: resp.StatusCode}
+	if resp.StatusCode >= 300 {
+		res.Error = http.StatusText(resp.StatusCode)
+	}
+	res.Body, res.Truncated = t.trimBody(data)
+	return marshalResult(res), nil
+}
+
+func (t *endpointTool) newRequest(ctx context.Context, argumentsInJSON string) (*http.Request, error) {
+	args := map[string]any{}
+	if strings.TrimSpace(argumentsInJSON) != "" {
+		dec := json.NewDecoder(strings.NewReader(argumentsInJSON))
+		dec.UseNumber()
+		if err := dec.Decode(&args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+	for _, name := range t.op.params.Required {
+		if _, ok := args[name]; !ok {
+			return nil, fmt.Errorf("missing required parameter %s", name)
+		}
+	}
+
+	path := t.op.path
+	query := url.Values{}
+	header := t.headers.Clone()
+	fields := map[string]any{}
+	var body any
+	for name, value := range args {
+		in, ok := t.op.in[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+		switch in {
+		case inPath:
+			// 路径参数不能跳出操作的路径
+			v := stringify(value)
+			if v == "" || v == "." || v == ".." {
+				return nil, fmt.Errorf("invalid value %q for parameter %s", v, name)
+			}
+			path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(v))
+		case inQuery:
+			if values, ok := value.([]any); ok {
+				for _, v := range values {
+					query.Add(name, stringify(v))
+				}
+			} else {
+				query.Set(name, stringify(value))
+			}
+		case inHeader:
+			header.Set(name, stringify(value))
+		case inBody:
+			fields[name] = value
+		case inRawBody:
+			body = value
+		}
+	}
+	if len(fields) > 0 {
+		body = fields
+	}
+
+	u := t.base.JoinPath(path)
+	u.RawQuery = query.Encode()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, t.op.method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func stringify(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// trimBody shortens a response for the model: nulls are dropped, arrays keep MaxItems elements
+// and long strings are cut. What is still larger than MaxResponseBytes, or is not JSON, is cut as text.
+func (t *endpointTool) trimBody(data []byte) (any, bool) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, false
+	}
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if len(data) <= maxRawBytes && dec.Decode(&v) == nil {
+		trimmed, err := json.Marshal(trimJSON(v, t.config.MaxItems))
+		if err == nil && len(trimmed) <= t.config.MaxResponseBytes {
+			return json.RawMessage(trimmed), false
+		}
+		if err == nil {
+			data = trimmed
+		}
+	}
+	if len(data) > t.config.MaxResponseBytes {
+		return strings.ToValidUTF8(string(data[:t.config.MaxResponseBytes]), ""), true
+	}
+	return string(data), false
+}
+
+func trimJSON(v any, maxItems int) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if e == nil {
+				delete(v, k)
+				continue
+			}
+			v[k] = trimJSON(e, maxItems)
+		}
+		return v
+	case []any:
+		if len(v) > maxItems {
+			v = append(v[:maxItems:maxItems], fmt.Sprintf("... %d more items", len(v)-maxItems))
+		}
+		for i := range v {
+			v[i] = trimJSON(v[i], maxItems)
+		}
+		return v
+	case string:
+		if utf8.RuneCountInString(v) > maxStringRunes {
+			return string([]rune(v)[:maxStringRunes]) + "..."
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func marshalResult(r *result) string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q}`, err.Error())
+	}
+	return string(data)
+}
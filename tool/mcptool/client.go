@@ -0,0 +1,319 @@
+package mcptool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ErrClosed is returned by a Client after Close.
+var ErrClosed = errors.New("mcp client closed")
+
+// Reconnection attempts of a server that failed to connect are spaced by a doubling delay.
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// Client keeps the connection to one MCP server. It connects on first use and again after
+// the connection failed, so that a restarted server is picked up without restarting the agent.
+// A stdio server exiting during a call is noticed when the call times out.
+type Client struct {
+	name   string
+	config *ServerConfig
+
+	mu         sync.Mutex
+	conn       *client.Client
+	tools      []tool.BaseTool
+	retryDelay time.Duration
+	retryAt    time.Time
+	closed     bool
+}
+
+func NewClient(name string, config *ServerConfig) *Client {
+	return &Client{name: name, config: config}
+}
+
+// Name returns the name of the server in the config.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Tools returns the tools of the server, connecting first if needed.
+func (c *Client) Tools(ctx context.Context) ([]tool.BaseTool, error) {
+	_, tools, err := c.connection(ctx)
+	return tools, err
+}
+
+// Close disconnects from the server, stopping a stdio server.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.tools = nil, nil
+	return err
+}
+
+func (c *Client) connection(ctx context.Context) (*client.Client, []tool.BaseTool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, nil, ErrClosed
+	}
+	if c.conn != nil {
+		return c.conn, c.tools, nil
+	}
+	if wait := time.Until(c.retryAt); wait > 0 {
+		return nil, nil, fmt.Errorf("mcp server %s is unavailable, retrying in %s", c.name, wait.Round(time.Second))
+	}
+
+	conn, tools, err := c.connect(ctx)
+	if err != nil {
+		c.retryDelay = min(max(c.retryDelay*2, minRetryDelay), maxRetryDelay)
+		c.retryAt = time.Now().Add(c.retryDelay)
+		log.Printf("[MCP] Failed to connect to %s, retrying in %s: %v", c.name, c.retryDelay, err)
+		return nil, nil, fmt.Errorf("mcp server %s is unavailable: %w", c.name, err)
+	}
+	c.retryDelay, c.retryAt = 0, time.Time{}
+	c.conn, c.tools = conn, tools
+	log.Printf("[MCP] Connected to %s, %d tools", c.name, len(tools))
+	return conn, tools, nil
+}
+
+func (c *Client) connect(ctx context.Context) (*client.Client, []tool.BaseTool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.timeout())
+	defer cancel()
+
+	var conn *client.Client
+	if c.config.Command != "" {
+		env := make([]string, 0, len(c.config.Env))
+		for k, v := range c.config.Env {
+			env = append(env, k+"="+os.ExpandEnv(v))
+		}
+		conn = client.NewClient(transport.NewStdioWithOptions(c.config.Command, env, c.config.Args))
+	} else {
+		headers := make(map[string]string, len(c.config.Headers))
+		for k, v := range c.config.Headers {
+			headers[k] = os.ExpandEnv(v)
+		}
+		t, err := transport.NewStreamableHTTP(c.config.URL, transport.WithHTTPHeaders(headers))
+		if err != nil {
+			return nil, nil, err
+		}
+		conn = client.NewClient(t)
+	}
+	// 子进程和连接的生命周期与单次请求无关
+	if err := conn.Start(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	if stderr, ok := client.GetStderr(conn); ok {
+		go c.logStderr(stderr)
+	}
+
+	init := mcp.InitializeRequest{}
+	init.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	init.Params.ClientInfo = mcp.Implementation{Name: "myeino", Version: "1.0.0"}
+	if _, err := conn.Initialize(ctx, init); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("initialize: %w", err)
+	}
+	list, err := conn.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("list tools: %w", err)
+	}
+
+	var tools []tool.BaseTool
+	for _, t := range list.Tools {
+		if len(c.config.Tools) > 0 && !slices.Contains(c.config.Tools, t.Name) {
+			continue
+		}
+		info, err := toolInfo(c.config.Prefix, t)
+		if err != nil {
+			log.Printf("[MCP] Skipping tool %s of %s: %v", t.Name, c.name, err)
+			continue
+		}
+		tools = append(tools, &mcpTool{client: c, name: t.Name, info: info})
+	}
+	return conn, tools, nil
+}
+
+// logStderr forwards the log of a stdio server, the server would block once the pipe is full.
+func (c *Client) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.Printf("[MCP] %s: %s", c.name, scanner.Text())
+	}
+}
+
+// drop forgets a failed connection, the next use reconnects.
+func (c *Client) drop(conn *client.Client, cause error) {
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn, c.tools = nil, nil
+	}
+	c.mu.Unlock()
+	conn.Close()
+	log.Printf("[MCP] Connection to %s lost: %v", c.name, cause)
+}
+
+func (c *Client) call(ctx context.Context, name, argumentsInJSON string) (*mcp.CallToolResult, error) {
+	conn, _, err := c.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	callCtx, cancel := context.WithTimeout(ctx, c.config.timeout())
+	defer cancel()
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = name
+	req.Params.Arguments = json.RawMessage(argumentsInJSON)
+	res, err := conn.CallTool(callCtx, req)
+	// 传输错误或服务端无响应时断开，下次调用重新连接；调用方取消不算
+	var transportErr *transport.Error
+	if err != nil && ctx.Err() == nil && (errors.As(err, &transportErr) || callCtx.Err() != nil) {
+		c.drop(conn, err)
+	}
+	return res, err
+}
+
+func toolInfo(prefix string, t mcp.Tool) (*schema.ToolInfo, error) {
+	// Tool.MarshalJSON 会选择 InputSchema 或 RawInputSchema
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		InputSchema json.RawMessage `json:"inputSchema"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	params := &jsonschema.Schema{}
+	if err := json.Unmarshal(raw.InputSchema, params); err != nil {
+		return nil, fmt.Errorf("invalid input schema: %w", err)
+	}
+	return &schema.ToolInfo{
+		Name:        prefix + t.Name,
+		Desc:        t.Description,
+		ParamsOneOf: schema.NewParamsOneOfByJSONSchema(params),
+	}, nil
+}
+
+// mcpTool calls a tool of an MCP server.
+type mcpTool struct {
+	client *Client
+	// name is the name of the tool on the server, without prefix
+	name string
+	info *schema.ToolInfo
+}
+
+func (t *mcpTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return t.info, nil
+}
+
+// InvokableRun reports failures of the server in the result, the model can try again or do without.
+func (t *mcpTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	res, err := t.client.call(ctx, t.name, argumentsInJSON)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return fmt.Sprintf("The tool %s failed: %v", t.info.Name, err), nil
+	}
+	text := resultText(res)
+	if res.IsError {
+		return fmt.Sprintf("The tool %s returned an error: %s", t.info.Name, text), nil
+	}
+	return text, nil
+}
+
+// resultText converts a tool result for the model. Binary content is only described.
+func resultText(res *mcp.CallToolResult) string {
+	var parts []string
+	for _, content := range res.Content {
+		switch c := content.(type) {
+		case mcp.TextContent:
+			parts = append(parts, c.Text)
+		case mcp.ImageContent:
+			parts = append(parts, fmt.Sprintf("[image %s]", c.MIMEType))
+		case mcp.AudioContent:
+			parts = append(parts, fmt.Sprintf("[audio %s]", c.MIMEType))
+		case mcp.ResourceLink:
+			parts = append(parts, fmt.Sprintf("[resource %s %s]", c.Name, c.URI))
+		case mcp.EmbeddedResource:
+			if r, ok := c.Resource.(mcp.TextResourceContents); ok {
+				parts = append(parts, r.Text)
+			} else if r, ok := c.Resource.(mcp.BlobResourceContents); ok {
+				parts = append(parts, fmt.Sprintf("[resource %s]", r.URI))
+			}
+		}
+	}
+	if len(parts) == 0 && res.StructuredContent != nil {
+		if data, err := json.Marshal(res.StructuredContent); err == nil {
+			parts = append(parts, string(data))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Manager holds the clients of the configured servers.
+type Manager struct {
+	clients map[string]*Client
+}
+
+func NewManager(config *Config) *Manager {
+	m := &Manager{clients: map[string]*Client{}}
+	if config == nil {
+		return m
+	}
+	for name, s := range config.Servers {
+		m.clients[name] = NewClient(name, s)
+	}
+	return m
+}
+
+// Servers returns the names of the servers, sorted.
+func (m *Manager) Servers() []string {
+	names := make([]string, 0, len(m.clients))
+	for name := range m.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Client returns the client of a server, nil for an unknown name.
+func (m *Manager) Client(name string) *Client {
+	return m.clients[name]
+}
+
+// Close disconnects from every server.
+func (m *Manager) Close() error {
+	var errs []error
+	for _, c := range m.clients {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,79 @@
+// Package mcptool connects the agent to Model Context Protocol servers. The tools of every
+// configured server are discovered when it connects and adapted to eino tools; a server that
+// goes away is reconnected on the next use.
+package mcptool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ServerConfig configures an MCP server, either a command speaking MCP over stdio or a
+// streamable HTTP endpoint.
+type ServerConfig struct {
+	// Command starts a stdio server, with Args and Env added to the environment of this process.
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+
+	// URL is the endpoint of a streamable HTTP server.
+	URL string `json:"url,omitempty"`
+	// Headers are sent to an HTTP server, ${VAR} is replaced with the environment variable VAR.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Tools keeps only these tools of the server, empty keeps all.
+	Tools []string `json:"tools,omitempty"`
+	// Prefix is prepended to the tool names, to tell apart servers offering tools of the same name.
+	Prefix string `json:"prefix,omitempty"`
+	// Timeout bounds connecting and every tool call, e.g. "30s", default 60s.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Config lists the servers by name, in the mcpServers format used by most MCP clients:
+//
+//	{"mcpServers": {
+//	  "filesystem": {"command": "npx", "args": ["-y", "@modelcontextprotocol/server-filesystem", "/data"]},
+//	  "search": {"url": "http://search.internal/mcp", "headers": {"Authorization": "Bearer ${SEARCH_TOKEN}"}}
+//	}}
+type Config struct {
+	Servers map[string]*ServerConfig `json:"mcpServers"`
+}
+
+// LoadConfig reads a JSON server config.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mcp config: %w", err)
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid mcp config %s: %w", path, err)
+	}
+	for name, s := range c.Servers {
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("mcp server %s: %w", name, err)
+		}
+	}
+	return &c, nil
+}
+
+func (s *ServerConfig) validate() error {
+	if (s.Command == "") == (s.URL == "") {
+		return fmt.Errorf("set either command or url")
+	}
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", s.Timeout, err)
+		}
+	}
+	return nil
+}
+
+func (s *ServerConfig) timeout() time.Duration {
+	if d, err := time.ParseDuration(s.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return time.Minute
+}
@@ -0,0 +1,180 @@
+package mcptool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// stubServerEnv makes the test binary run the stub server instead of the tests.
+const stubServerEnv = "MCPTOOL_STUB_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(stubServerEnv) == "1" {
+		if err := server.ServeStdio(newStubServer()); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// newStubServer offers echo, pid, which tells apart restarted processes, and crash.
+func newStubServer() *server.MCPServer {
+	s := server.NewMCPServer("stub", "1.0.0")
+	s.AddTool(mcp.NewTool("echo",
+		mcp.WithDescription("Echo the text"),
+		mcp.WithString("text", mcp.Required(), mcp.Description("The text to echo")),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		text, err := req.RequireString("text")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(text), nil
+	})
+	s.AddTool(mcp.NewTool("pid"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(strconv.Itoa(os.Getpid())), nil
+	})
+	s.AddTool(mcp.NewTool("crash"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		os.Exit(2)
+		return nil, nil
+	})
+	return s
+}
+
+func stdioConfig(t *testing.T) *ServerConfig {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ServerConfig{Command: exe, Args: []string{"-test.run=^$"}, Env: map[string]string{stubServerEnv: "1"}, Timeout: "10s"}
+}
+
+func toolNamed(t *testing.T, c *Client, name string) tool.InvokableTool {
+	t.Helper()
+	tools, err := c.Tools(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tl := range tools {
+		info, _ := tl.Info(context.Background())
+		if info.Name == name {
+			return tl.(tool.InvokableTool)
+		}
+	}
+	t.Fatalf("tool %s not found", name)
+	return nil
+}
+
+func call(t *testing.T, tl tool.InvokableTool, args string) string {
+	t.Helper()
+	out, err := tl.InvokableRun(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestStdioServer(t *testing.T) {
+	config := stdioConfig(t)
+	config.Prefix = "stub_"
+	c := NewClient("stub", config)
+	defer c.Close()
+
+	echo := toolNamed(t, c, "stub_echo")
+	info, _ := echo.Info(context.Background())
+	params, err := info.ParamsOneOf.ToJSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Desc != "Echo the text" || len(params.Required) != 1 || params.Required[0] != "text" {
+		t.Errorf("echo info = %+v, params %+v", info, params)
+	}
+	if out := call(t, echo, `{"text":"hello"}`); out != "hello" {
+		t.Errorf("echo = %q", out)
+	}
+	if out := call(t, echo, `{}`); !strings.Contains(out, "returned an error") {
+		t.Errorf("tool error not reported: %q", out)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	config := stdioConfig(t)
+	// 进程退出后调用要等到超时才失败
+	config.Timeout = "2s"
+	c := NewClient("stub", config)
+	defer c.Close()
+
+	pid := call(t, toolNamed(t, c, "pid"), `{}`)
+	// 服务进程退出，本次调用失败，下次调用重新启动进程
+	if out := call(t, toolNamed(t, c, "crash"), `{}`); !strings.Contains(out, "failed") {
+		t.Errorf("crash = %q", out)
+	}
+	if out := call(t, toolNamed(t, c, "pid"), `{}`); out == pid || out == "" || strings.Contains(out, "failed") {
+		t.Errorf("not reconnected: pid %s, then %q", pid, out)
+	}
+}
+
+func TestUnavailableServer(t *testing.T) {
+	c := NewClient("missing", &ServerConfig{Command: filepath.Join(t.TempDir(), "missing"), Timeout: "5s"})
+	defer c.Close()
+	if _, err := c.Tools(context.Background()); err == nil {
+		t.Fatal("connected to a missing server")
+	}
+	if _, err := c.Tools(context.Background()); err == nil || !strings.Contains(err.Error(), "retrying in") {
+		t.Errorf("reconnected without delay: %v", err)
+	}
+}
+
+func TestStreamableHTTPServer(t *testing.T) {
+	srv := server.NewTestStreamableHTTPServer(newStubServer())
+	defer srv.Close()
+
+	c := NewClient("http", &ServerConfig{URL: srv.URL + "/mcp", Tools: []string{"echo"}})
+	defer c.Close()
+	tools, err := c.Tools(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 1 {
+		t.Fatalf("tools not filtered: %d tools", len(tools))
+	}
+	if out := call(t, tools[0].(tool.InvokableTool), `{"text":"over http"}`); out != "over http" {
+		t.Errorf("echo = %q", out)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.json")
+	config := map[string]any{"mcpServers": map[string]any{
+		"fs":     map[string]any{"command": "npx", "args": []string{"server-filesystem"}},
+		"search": map[string]any{"url": "http://search/mcp", "timeout": "5s"},
+	}}
+	data, _ := json.Marshal(config)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := NewManager(c); strings.Join(m.Servers(), ",") != "fs,search" {
+		t.Errorf("servers = %v", m.Servers())
+	}
+
+	if err := os.WriteFile(path, []byte(`{"mcpServers": {"both": {"command": "x", "url": "http://x"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("server with command and url accepted")
+	}
+}
@@ -0,0 +1,200 @@
+// Package registry builds the tools of the agent by name. Tools register a factory, a Config
+// chooses which of them are enabled, with which settings, per tenant and per conversation.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/cloudwego/eino/components/tool"
+	"myeino/util"
+)
+
+// Factory builds a tool from its settings in the Config, settings is nil when none are configured.
+type Factory func(ctx context.Context, settings json.RawMessage) (tool.BaseTool, error)
+
+// GroupFactory builds a set of tools enabled together, e.g. the tools of an MCP server.
+type GroupFactory func(ctx context.Context, settings json.RawMessage) ([]tool.BaseTool, error)
+
+// Registry holds the tool factories by name.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]GroupFactory
+}
+
+func New() *Registry {
+	return &Registry{factories: map[string]GroupFactory{}}
+}
+
+// Register adds a factory, names are unique.
+func (r *Registry) Register(name string, factory Factory) error {
+	return r.RegisterGroup(name, func(ctx context.Context, settings json.RawMessage) ([]tool.BaseTool, error) {
+		t, err := factory(ctx, settings)
+		if err != nil {
+			return nil, err
+		}
+		return []tool.BaseTool{t}, nil
+	})
+}
+
+// RegisterGroup adds a factory of several tools under one name.
+func (r *Registry) RegisterGroup(name string, factory GroupFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[name]; ok {
+		return fmt.Errorf("tool %s is already registered", name)
+	}
+	r.factories[name] = factory
+	return nil
+}
+
+// MustRegister is Register for the built-in tools, it panics on duplicate names.
+func (r *Registry) MustRegister(name string, factory Factory) {
+	if err := r.Register(name, factory); err != nil {
+		panic(err)
+	}
+}
+
+// Names returns the registered names, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build builds the named tools and groups in order with their settings from config.
+func (r *Registry) Build(ctx context.Context, config *Config, names []string) ([]tool.BaseTool, error) {
+	tools := make([]tool.BaseTool, 0, len(names))
+	for _, name := range names {
+		r.mu.RLock()
+		factory, ok := r.factories[name]
+		r.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("tool %s is not registered", name)
+		}
+		built, err := factory(ctx, config.Settings[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to build tool %s: %w", name, err)
+		}
+		tools = append(tools, built...)
+	}
+	return tools, nil
+}
+
+// Selection lists the tools of a deployment or a tenant.
+type Selection struct {
+	// Enabled tools are given to the agent unless the conversation chooses otherwise.
+	Enabled []string `json:"enabled"`
+	// Optional tools are off unless a conversation enables them.
+	Optional []string `json:"optional,omitempty"`
+}
+
+// Config chooses the tools, e.g.
+//
+//	{"enabled": ["eino_tool", "open", "task_manager"], "optional": ["duckduckgo_text_search"],
+//	 "settings": {"duckduckgo_text_search": {"max_results": 5}},
+//	 "tenants": {"acme": {"enabled": ["eino_tool"]}}}
+type Config struct {
+	Selection
+	// Settings are passed to the factory of each tool.
+	Settings map[string]json.RawMessage `json:"settings,omitempty"`
+	// Tenants replace the selection for the requests of a tenant.
+	Tenants map[string]*Selection `json:"tenants,omitempty"`
+}
+
+// LoadConfig reads a JSON tool config.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tool config: %w", err)
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid tool config %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Validate checks that every tool named by the config is registered in r.
+func (c *Config) Validate(r *Registry) error {
+	registered := r.Names()
+	check := func(where string, s *Selection) error {
+		for _, name := range slices.Concat(s.Enabled, s.Optional) {
+			if _, ok := slices.BinarySearch(registered, name); !ok {
+				return fmt.Errorf("%s: unknown tool %s", where, name)
+			}
+		}
+		return nil
+	}
+	if err := check("tools", &c.Selection); err != nil {
+		return err
+	}
+	for tenant, s := range c.Tenants {
+		if err := check("tenant "+tenant, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectionFor returns the selection of the tenant of ctx.
+func (c *Config) selectionFor(ctx context.Context) *Selection {
+	if s, ok := c.Tenants[util.TenantIDFromContext(ctx)]; ok && s != nil {
+		return s
+	}
+	return &c.Selection
+}
+
+// Available returns the tools the conversation of ctx may use, and whether each is on by default.
+func (c *Config) Available(ctx context.Context) map[string]bool {
+	s := c.selectionFor(ctx)
+	available := make(map[string]bool, len(s.Enabled)+len(s.Optional))
+	for _, name := range s.Optional {
+		available[name] = false
+	}
+	for _, name := range s.Enabled {
+		available[name] = true
+	}
+	return available
+}
+
+// EnabledFor returns the tools of the conversation of ctx: the tools chosen with WithTools
+// that are available to the tenant, or the enabled tools of the tenant.
+func (c *Config) EnabledFor(ctx context.Context) []string {
+	s := c.selectionFor(ctx)
+	chosen, ok := ToolsFromContext(ctx)
+	if !ok {
+		return slices.Clone(s.Enabled)
+	}
+	// 会话只能在租户可用的工具中选择
+	var names []string
+	for _, name := range slices.Concat(s.Enabled, s.Optional) {
+		if slices.Contains(chosen, name) && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+type toolsKey struct{}
+
+// WithTools chooses the tools of the conversation, an empty list disables all of them.
+func WithTools(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, toolsKey{}, names)
+}
+
+// ToolsFromContext returns the tools chosen with WithTools, and whether any choice was made.
+func ToolsFromContext(ctx context.Context) ([]string, bool) {
+	names, ok := ctx.Value(toolsKey{}).([]string)
+	return names, ok
+}
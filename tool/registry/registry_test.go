@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"myeino/util"
+)
+
+type namedTool struct {
+	name     string
+	settings json.RawMessage
+}
+
+func (t *namedTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: t.name}, nil
+}
+
+func newTestRegistry(t *testing.T, names ...string) *Registry {
+	t.Helper()
+	r := New()
+	for _, name := range names {
+		r.MustRegister(name, func(ctx context.Context, settings json.RawMessage) (tool.BaseTool, error) {
+			return &namedTool{name: name, settings: settings}, nil
+		})
+	}
+	return r
+}
+
+func TestRegister(t *testing.T) {
+	r := newTestRegistry(t, "b", "a")
+	if err := r.Register("a", nil); err == nil {
+		t.Error("duplicate name accepted")
+	}
+	if got := r.Names(); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("Names() = %v", got)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	r := newTestRegistry(t, "search", "open")
+	config := &Config{Settings: map[string]json.RawMessage{"search": json.RawMessage(`{"max_results":5}`)}}
+
+	tools, err := r.Build(context.Background(), config, []string{"search", "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 2 {
+		t.Fatalf("built %d tools", len(tools))
+	}
+	if got := string(tools[0].(*namedTool).settings); got != `{"max_results":5}` {
+		t.Errorf("settings = %s", got)
+	}
+	if tools[1].(*namedTool).settings != nil {
+		t.Error("settings passed to a tool without settings")
+	}
+
+	if _, err := r.Build(context.Background(), config, []string{"missing"}); err == nil {
+		t.Error("unregistered tool built")
+	}
+}
+
+func TestEnabledFor(t *testing.T) {
+	config := &Config{
+		Selection: Selection{Enabled: []string{"kb", "open"}, Optional: []string{"search"}},
+		Tenants: map[string]*Selection{
+			"acme": {Enabled: []string{"kb"}},
+		},
+	}
+	acme := util.WithTenantID(context.Background(), "acme")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []string
+	}{
+		{"default", context.Background(), []string{"kb", "open"}},
+		{"tenant", acme, []string{"kb"}},
+		{"conversation enables optional", WithTools(context.Background(), []string{"search", "kb"}), []string{"kb", "search"}},
+		{"conversation cannot add tools", WithTools(context.Background(), []string{"shell", "open"}), []string{"open"}},
+		{"conversation limited by tenant", WithTools(acme, []string{"search", "open", "kb"}), []string{"kb"}},
+		{"conversation disables all", WithTools(context.Background(), []string{}), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.EnabledFor(tt.ctx); !slices.Equal(got, tt.want) {
+				t.Errorf("EnabledFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := config.Available(context.Background()); len(got) != 3 || !got["kb"] || got["search"] {
+		t.Errorf("Available() = %v", got)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.json")
+	data := `{"enabled": ["open"], "optional": ["search"], "settings": {"search": {"region": "cn-zh"}},
+		"tenants": {"acme": {"enabled": ["unknown"]}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.Enabled, []string{"open"}) || string(config.Settings["search"]) != `{"region": "cn-zh"}` {
+		t.Errorf("config not loaded: %+v", config)
+	}
+
+	r := newTestRegistry(t, "open", "search")
+	if err := config.Validate(r); err == nil {
+		t.Error("unknown tenant tool accepted")
+	}
+	delete(config.Tenants, "acme")
+	if err := config.Validate(r); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuildGroup(t *testing.T) {
+	r := newTestRegistry(t, "open")
+	r.RegisterGroup("mcp:fs", func(ctx context.Context, settings json.RawMessage) ([]tool.BaseTool, error) {
+		return []tool.BaseTool{&namedTool{name: "read_file"}, &namedTool{name: "write_file"}}, nil
+	})
+	if err := r.Register("mcp:fs", nil); err == nil {
+		t.Error("tool registered with the name of a group")
+	}
+	tools, err := r.Build(context.Background(), &Config{}, []string{"mcp:fs", "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tl := range tools {
+		names = append(names, tl.(*namedTool).name)
+	}
+	if !slices.Equal(names, []string{"read_file", "write_file", "open"}) {
+		t.Errorf("built %v", names)
+	}
+}
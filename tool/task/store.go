@@ -0,0 +1,336 @@
+package task
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	rds "github.com/redis/go-redis/v9"
+	"myeino/util"
+)
+
+// FileStore keeps the tasks in a JSONL file. Adding a task appends a line, updating and deleting rewrite
+// the file. Deleted tasks are kept with is_deleted set. The file is reloaded when another process changed it.
+type FileStore struct {
+	path string
+
+	mu      sync.Mutex
+	tasks   []*Task
+	modTime time.Time
+	size    int64
+}
+
+// NewFileStore opens dir/tasks.jsonl, creating dir if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create task directory: %w", err)
+	}
+	s := &FileStore{path: filepath.Join(dir, "tasks.jsonl")}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the file unless it is unchanged since the last read.
+func (s *FileStore) load() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.tasks, s.modTime, s.size = nil, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tasks: %w", err)
+	}
+	if s.tasks != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read tasks: %w", err)
+	}
+
+	tasks := []*Task{}
+	index := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var t Task
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			log.Printf("[Task] Skipping line %d of %s: %v", line, s.path, err)
+			continue
+		}
+		// 同一 id 出现多次时以最后一行为准
+		if i, ok := index[t.ID]; ok {
+			tasks[i] = &t
+			continue
+		}
+		index[t.ID] = len(tasks)
+		tasks = append(tasks, &t)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read tasks: %w", err)
+	}
+	s.tasks, s.modTime, s.size = tasks, info.ModTime(), info.Size()
+	return nil
+}
+
+// remember records the state of the file written by this store, so that it is not read again.
+func (s *FileStore) remember() {
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+}
+
+func (s *FileStore) Add(ctx context.Context, task *Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	task.TenantID, task.UserID = util.TenantIDFromContext(ctx), util.UserIDFromContext(ctx)
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write task: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write task: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write task: %w", err)
+	}
+	copied := *task
+	s.tasks = append(s.tasks, &copied)
+	s.remember()
+	return nil
+}
+
+// owned tells whether the task belongs to the tenant and the user of ctx.
+func owned(ctx context.Context, t *Task) bool {
+	return t.TenantID == util.TenantIDFromContext(ctx) && t.UserID == util.UserIDFromContext(ctx)
+}
+
+// find returns the index of a task of the user of ctx, -1 when there is none.
+func (s *FileStore) find(ctx context.Context, id string) int {
+	for i, t := range s.tasks {
+		if t.ID == id && !t.IsDeleted && owned(ctx, t) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *FileStore) Get(ctx context.Context, id string) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	i := s.find(ctx, id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	copied := *s.tasks[i]
+	return &copied, nil
+}
+
+func (s *FileStore) Update(ctx context.Context, task *Task) error {
+	return s.replace(ctx, task.ID, func(old *Task) *Task {
+		updated := *task
+		updated.TenantID, updated.UserID, updated.IsDeleted = old.TenantID, old.UserID, false
+		return &updated
+	})
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	return s.replace(ctx, id, func(old *Task) *Task {
+		deleted := *old
+		deleted.IsDeleted = true
+		return &deleted
+	})
+}
+
+// replace changes a task and rewrites the file.
+func (s *FileStore) replace(ctx context.Context, id string, change func(*Task) *Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	i := s.find(ctx, id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	tasks := make([]*Task, len(s.tasks))
+	copy(tasks, s.tasks)
+	tasks[i] = change(tasks[i])
+	if err := s.write(tasks); err != nil {
+		return err
+	}
+	s.tasks = tasks
+	s.remember()
+	return nil
+}
+
+// write replaces the file through a temporary file, a crash leaves the previous version.
+func (s *FileStore) write(tasks []*Task) error {
+	var buf bytes.Buffer
+	for _, t := range tasks {
+		data, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write tasks: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write tasks: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) List(ctx context.Context) ([]*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	var tasks []*Task
+	for _, t := range s.tasks {
+		if !t.IsDeleted && owned(ctx, t) {
+			copied := *t
+			tasks = append(tasks, &copied)
+		}
+	}
+	return tasks, nil
+}
+
+// RedisStore keeps the tasks of each user of a tenant in a Redis hash from id to task JSON, deleted tasks
+// are removed.
+type RedisStore struct {
+	client *rds.Client
+	prefix string
+}
+
+// NewRedisStore creates a store keeping tasks under prefix, e.g. "eino:task:".
+func NewRedisStore(client *rds.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "eino:task:"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// key returns the hash of the user of ctx, e.g. "eino:task:acme:alice", or of the tenant for the
+// tasks created without user.
+func (r *RedisStore) key(ctx context.Context) string {
+	tenant := util.TenantIDFromContext(ctx)
+	if tenant == "" {
+		tenant = "default"
+	}
+	if user := util.UserIDFromContext(ctx); user != "" {
+		return r.prefix + tenant + ":" + user
+	}
+	return r.prefix + tenant
+}
+
+// updateScript sets a field only if it exists, so that an update does not recreate a deleted task.
+var updateScript = rds.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+  return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1`)
+
+func (r *RedisStore) Add(ctx context.Context, task *Task) error {
+	task.TenantID, task.UserID = util.TenantIDFromContext(ctx), util.UserIDFromContext(ctx)
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	if err := r.client.HSet(ctx, r.key(ctx), task.ID, data).Err(); err != nil {
+		return fmt.Errorf("failed to store task: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisStore) Get(ctx context.Context, id string) (*Task, error) {
+	data, err := r.client.HGet(ctx, r.key(ctx), id).Bytes()
+	if err == rds.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task: %w", err)
+	}
+	var t Task
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid task %s: %w", id, err)
+	}
+	return &t, nil
+}
+
+func (r *RedisStore) Update(ctx context.Context, task *Task) error {
+	task.TenantID, task.UserID = util.TenantIDFromContext(ctx), util.UserIDFromContext(ctx)
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	updated, err := updateScript.Run(ctx, r.client, []string{r.key(ctx)}, task.ID, data).Int()
+	if err != nil {
+		return fmt.Errorf("failed to store task: %w", err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *RedisStore) Delete(ctx context.Context, id string) error {
+	n, err := r.client.HDel(ctx, r.key(ctx), id).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete task: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *RedisStore) List(ctx context.Context) ([]*Task, error) {
+	items, err := r.client.HGetAll(ctx, r.key(ctx)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tasks: %w", err)
+	}
+	tasks := make([]*Task, 0, len(items))
+	for id, data := range items {
+		var t Task
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			log.Printf("[Task] Skipping invalid task %s: %v", id, err)
+			continue
+		}
+		tasks = append(tasks, &t)
+	}
+	return tasks, nil
+}
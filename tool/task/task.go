@@ -0,0 +1,78 @@
+// Package task is a persistent task list for the agent: tools to add, update, list and delete tasks
+// with due dates, stored in a JSONL file or in Redis.
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for a task that does not exist, was deleted, or belongs to another tenant.
+var ErrNotFound = errors.New("task not found")
+
+// Task is stored as one line of tasks.jsonl, the format of the task tool of the Eino assistant.
+type Task struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	Completed bool   `json:"completed"`
+	// Deadline is written as "2006-01-02 15:04:05" in the location of the tools, empty without due date.
+	Deadline  string `json:"deadline"`
+	IsDeleted bool   `json:"is_deleted"`
+	CreatedAt string `json:"created_at"`
+	// TenantID is the tenant owning the task, empty for the tasks created without tenant.
+	TenantID string `json:"tenant_id,omitempty"`
+	// UserID is the user owning the task within the tenant, empty for the tasks created without user.
+	UserID string `json:"user_id,omitempty"`
+}
+
+// Store keeps the tasks. Every method only sees the tasks of the tenant of ctx.
+type Store interface {
+	Add(ctx context.Context, task *Task) error
+	Get(ctx context.Context, id string) (*Task, error)
+	// Update replaces a task, it returns ErrNotFound when the task does not exist.
+	Update(ctx context.Context, task *Task) error
+	Delete(ctx context.Context, id string) error
+	// List returns the tasks not deleted, in no particular order.
+	List(ctx context.Context) ([]*Task, error)
+}
+
+const deadlineLayout = "2006-01-02 15:04:05"
+
+// deadlineLayouts are accepted from the model and in existing files, e.g. "2025-3-01 19:00:00".
+var deadlineLayouts = []string{
+	time.RFC3339,
+	"2006-1-2 15:04:05",
+	"2006-1-2 15:04",
+	"2006-1-2T15:04:05",
+	"2006-1-2T15:04",
+	"2006/1/2 15:04:05",
+	"2006/1/2 15:04",
+}
+
+// dateLayouts are due dates without time, due at the end of the day.
+var dateLayouts = []string{"2006-1-2", "2006/1/2"}
+
+// parseDeadline parses a due date in loc.
+func parseDeadline(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range deadlineLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.In(loc), nil
+		}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.Add(24*time.Hour - time.Second), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD or YYYY-MM-DD HH:MM", s)
+}
+
+// formatDeadline writes a due date the way it is stored.
+func formatDeadline(t time.Time) string {
+	return t.Format(deadlineLayout)
+}
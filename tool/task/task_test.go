@@ -0,0 +1,209 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"myeino/util"
+)
+
+// legacyTask is a line written by the task tool of the Eino assistant.
+const legacyTask = `{"id":"a13f1db5-0a00-4a9f-8151-52fdc097b11a","title":"阅读 Eino example","content":"把 Eino 的 example 通读一遍","completed":false,"deadline":"2025-3-01 19:00:00","is_deleted":false,"created_at":"2025-02-25T14:45:13+08:00"}`
+
+func newTestTools(t *testing.T, dir string) map[string]tool.InvokableTool {
+	t.Helper()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)
+	tools, err := NewTools(context.Background(), &Config{Store: store, Location: time.UTC, Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]tool.InvokableTool{}
+	for _, tl := range tools {
+		info, _ := tl.Info(context.Background())
+		byName[info.Name] = tl
+	}
+	return byName
+}
+
+func run[R any](t *testing.T, ctx context.Context, tl tool.InvokableTool, args string) *R {
+	t.Helper()
+	out, err := tl.InvokableRun(ctx, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res R
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("invalid result %q: %v", out, err)
+	}
+	return &res
+}
+
+func TestTools(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tasks.jsonl"), []byte(legacyTask+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tools := newTestTools(t, dir)
+	ctx := context.Background()
+
+	added := run[Result](t, ctx, tools[ToolAdd], `{"title":"Write the demo","content":"slides","deadline":"2025-03-05"}`)
+	if added.Error != "" || added.Task.Deadline != "2025-03-05 23:59:59" {
+		t.Fatalf("add = %+v", added)
+	}
+	if res := run[Result](t, ctx, tools[ToolAdd], `{"deadline":"tomorrow"}`); res.Error == "" {
+		t.Error("task without title added")
+	}
+	if res := run[Result](t, ctx, tools[ToolAdd], `{"title":"x","deadline":"next week"}`); !strings.Contains(res.Error, "invalid date") {
+		t.Errorf("invalid deadline accepted: %+v", res)
+	}
+
+	list := run[ListResult](t, ctx, tools[ToolList], `{}`)
+	if list.Total != 2 || list.Tasks[0].Title != "阅读 Eino example" || !list.Tasks[0].Overdue || list.Tasks[1].Overdue {
+		t.Errorf("list = %+v", list.Tasks)
+	}
+	if list := run[ListResult](t, ctx, tools[ToolList], `{"overdue":true}`); list.Total != 1 {
+		t.Errorf("overdue = %+v", list.Tasks)
+	}
+	if list := run[ListResult](t, ctx, tools[ToolList], `{"due_after":"2025-03-02","query":"DEMO"}`); list.Total != 1 || list.Tasks[0].ID != added.Task.ID {
+		t.Errorf("due_after = %+v", list.Tasks)
+	}
+	if list := run[ListResult](t, ctx, tools[ToolList], `{"due_before":"2025-03-02","limit":1}`); list.Total != 1 || len(list.Tasks) != 1 {
+		t.Errorf("due_before = %+v", list)
+	}
+
+	updated := run[Result](t, ctx, tools[ToolUpdate], `{"id":"a13f1db5-0a00-4a9f-8151-52fdc097b11a","completed":true,"deadline":""}`)
+	if updated.Error != "" || !updated.Task.Completed || updated.Task.Deadline != "" || updated.Task.Content == "" {
+		t.Errorf("update = %+v", updated)
+	}
+	if res := run[Result](t, ctx, tools[ToolUpdate], `{"id":"missing","completed":true}`); !strings.Contains(res.Error, "not found") {
+		t.Errorf("missing task updated: %+v", res)
+	}
+	if list := run[ListResult](t, ctx, tools[ToolList], `{"completed":false}`); list.Total != 1 || list.Tasks[0].ID != added.Task.ID {
+		t.Errorf("open tasks = %+v", list.Tasks)
+	}
+
+	if res := run[Result](t, ctx, tools[ToolDelete], `{"id":"`+added.Task.ID+`"}`); res.Error != "" {
+		t.Error(res.Error)
+	}
+	if res := run[Result](t, ctx, tools[ToolDelete], `{"id":"`+added.Task.ID+`"}`); res.Error == "" {
+		t.Error("task deleted twice")
+	}
+
+	// 重新打开文件，更新和删除都已写入，格式保持兼容
+	list = run[ListResult](t, ctx, newTestTools(t, dir)[ToolList], `{}`)
+	if list.Total != 1 || !list.Tasks[0].Completed {
+		t.Errorf("reloaded = %+v", list.Tasks)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "tasks.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"is_deleted":true`) {
+		t.Errorf("tasks.jsonl = %s", data)
+	}
+}
+
+func TestFileStoreTenants(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := util.WithTenantID(context.Background(), "acme")
+	if err := store.Add(acme, &Task{ID: "1", Title: "acme task"}); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, _ := store.List(context.Background()); len(tasks) != 0 {
+		t.Errorf("task of acme listed without tenant: %+v", tasks)
+	}
+	if _, err := store.Get(util.WithTenantID(context.Background(), "other"), "1"); err != ErrNotFound {
+		t.Errorf("task of acme read by another tenant: %v", err)
+	}
+	if err := store.Delete(context.Background(), "1"); err != ErrNotFound {
+		t.Errorf("task of acme deleted without tenant: %v", err)
+	}
+	if tasks, _ := store.List(acme); len(tasks) != 1 {
+		t.Errorf("acme tasks = %+v", tasks)
+	}
+}
+
+func TestFileStoreUsers(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := util.WithTenantID(context.Background(), "acme")
+	alice, bob := util.WithUserID(acme, "alice"), util.WithUserID(acme, "bob")
+	if err := store.Add(alice, &Task{ID: "1", Title: "alice task"}); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, _ := store.List(bob); len(tasks) != 0 {
+		t.Errorf("task of alice listed by bob: %+v", tasks)
+	}
+	if tasks, _ := store.List(acme); len(tasks) != 0 {
+		t.Errorf("task of alice listed without user: %+v", tasks)
+	}
+	if _, err := store.Get(bob, "1"); err != ErrNotFound {
+		t.Errorf("task of alice read by bob: %v", err)
+	}
+	if err := store.Update(bob, &Task{ID: "1", Title: "taken"}); err != ErrNotFound {
+		t.Errorf("task of alice updated by bob: %v", err)
+	}
+	if err := store.Delete(bob, "1"); err != ErrNotFound {
+		t.Errorf("task of alice deleted by bob: %v", err)
+	}
+	if err := store.Update(alice, &Task{ID: "1", Title: "done"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get(alice, "1"); err != nil || got.Title != "done" || got.UserID != "alice" {
+		t.Errorf("alice task = %+v, %v", got, err)
+	}
+}
+
+func TestFileStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := first.Add(ctx, &Task{ID: "1", Title: "from the first process"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Get(ctx, "1"); err != nil {
+		t.Errorf("task added by another store not seen: %v", err)
+	}
+}
+
+func TestParseDeadline(t *testing.T) {
+	tests := map[string]string{
+		"2025-3-01 19:00:00":        "2025-03-01 19:00:00",
+		"2025-03-01 19:00":          "2025-03-01 19:00:00",
+		"2025-03-01":                "2025-03-01 23:59:59",
+		"2025/3/1":                  "2025-03-01 23:59:59",
+		"2025-03-01T10:00:00+08:00": "2025-03-01 02:00:00",
+	}
+	for in, want := range tests {
+		due, err := parseDeadline(in, time.UTC)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if got := formatDeadline(due); got != want {
+			t.Errorf("%s = %s, want %s", in, got, want)
+		}
+	}
+}
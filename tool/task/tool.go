@@ -0,0 +1,306 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/google/uuid"
+)
+
+// Names of the task tools.
+const (
+	ToolAdd    = "add_task"
+	ToolUpdate = "update_task"
+	ToolList   = "list_tasks"
+	ToolDelete = "delete_task"
+)
+
+// defaultListLimit bounds the tasks listed when the model sets no limit.
+const defaultListLimit = 50
+
+// Config configures the task tools.
+type Config struct {
+	Store Store
+	// Location interprets due dates without time zone, default time.Local.
+	Location *time.Location
+	// Now is the current time, to tell overdue tasks, default time.Now.
+	Now func() time.Time
+}
+
+// AddParams are the arguments of add_task.
+type AddParams struct {
+	Title    string `json:"title" jsonschema:"description=Short title of the task"`
+	Content  string `json:"content,omitempty" jsonschema:"description=Details of the task"`
+	Deadline string `json:"deadline,omitempty" jsonschema:"description=Due date, e.g. 2025-03-01 or 2025-03-01 18:00"`
+}
+
+// UpdateParams are the arguments of update_task, fields left out are unchanged.
+type UpdateParams struct {
+	ID        string  `json:"id" jsonschema:"description=Id of the task"`
+	Title     *string `json:"title,omitempty" jsonschema:"description=New title"`
+	Content   *string `json:"content,omitempty" jsonschema:"description=New details"`
+	Deadline  *string `json:"deadline,omitempty" jsonschema:"description=New due date, e.g. 2025-03-01 18:00, an empty string removes it"`
+	Completed *bool   `json:"completed,omitempty" jsonschema:"description=Whether the task is done"`
+}
+
+// ListParams are the arguments of list_tasks, filters left out match every task.
+type ListParams struct {
+	Query     string `json:"query,omitempty" jsonschema:"description=Text to find in the title or details"`
+	Completed *bool  `json:"completed,omitempty" jsonschema:"description=Only done or only open tasks"`
+	DueBefore string `json:"due_before,omitempty" jsonschema:"description=Only tasks due before this date, e.g. 2025-03-01"`
+	DueAfter  string `json:"due_after,omitempty" jsonschema:"description=Only tasks due after this date"`
+	Overdue   bool   `json:"overdue,omitempty" jsonschema:"description=Only open tasks past their due date"`
+	Limit     int    `json:"limit,omitempty" jsonschema:"description=Maximum number of tasks, default 50"`
+}
+
+// DeleteParams are the arguments of delete_task.
+type DeleteParams struct {
+	ID string `json:"id" jsonschema:"description=Id of the task"`
+}
+
+// TaskView is a task as shown to the model.
+type TaskView struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Content   string `json:"content,omitempty"`
+	Completed bool   `json:"completed"`
+	Deadline  string `json:"deadline,omitempty"`
+	Overdue   bool   `json:"overdue,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Result is returned by add_task, update_task and delete_task. Invalid arguments and store failures
+// are reported in Error, so that the model can correct the call.
+type Result struct {
+	Task  *TaskView `json:"task,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// ListResult is returned by list_tasks.
+type ListResult struct {
+	Tasks []*TaskView `json:"tasks"`
+	// Total counts the matching tasks, before the limit.
+	Total int    `json:"total"`
+	Error string `json:"error,omitempty"`
+}
+
+type tasks struct {
+	config Config
+}
+
+// NewTools creates add_task, update_task, list_tasks and delete_task.
+func NewTools(ctx context.Context, config *Config) ([]tool.InvokableTool, error) {
+	if config == nil || config.Store == nil {
+		return nil, fmt.Errorf("task store is required")
+	}
+	t := &tasks{config: *config}
+	if t.config.Location == nil {
+		t.config.Location = time.Local
+	}
+	if t.config.Now == nil {
+		t.config.Now = time.Now
+	}
+
+	add, err := utils.InferTool(ToolAdd, "Add a task to the task list of the user, with an optional due date.", t.add)
+	if err != nil {
+		return nil, err
+	}
+	update, err := utils.InferTool(ToolUpdate, "Change a task, e.g. mark it as done or move its due date.", t.update)
+	if err != nil {
+		return nil, err
+	}
+	list, err := utils.InferTool(ToolList, "List the tasks of the user, open tasks first by due date.", t.list)
+	if err != nil {
+		return nil, err
+	}
+	del, err := utils.InferTool(ToolDelete, "Delete a task.", t.delete)
+	if err != nil {
+		return nil, err
+	}
+	return []tool.InvokableTool{add, update, list, del}, nil
+}
+
+// failed reports err to the model, only a cancelled call fails the tool.
+func failed(ctx context.Context, err error) (*Result, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return &Result{Error: err.Error()}, nil
+}
+
+func (t *tasks) add(ctx context.Context, p *AddParams) (*Result, error) {
+	if strings.TrimSpace(p.Title) == "" {
+		return &Result{Error: "title is required"}, nil
+	}
+	task := &Task{
+		ID:        uuid.New().String(),
+		Title:     strings.TrimSpace(p.Title),
+		Content:   p.Content,
+		CreatedAt: t.config.Now().In(t.config.Location).Format(time.RFC3339),
+	}
+	if p.Deadline != "" {
+		due, err := parseDeadline(p.Deadline, t.config.Location)
+		if err != nil {
+			return &Result{Error: err.Error()}, nil
+		}
+		task.Deadline = formatDeadline(due)
+	}
+	if err := t.config.Store.Add(ctx, task); err != nil {
+		return failed(ctx, err)
+	}
+	return &Result{Task: t.view(task)}, nil
+}
+
+func (t *tasks) update(ctx context.Context, p *UpdateParams) (*Result, error) {
+	task, err := t.config.Store.Get(ctx, p.ID)
+	if errors.Is(err, ErrNotFound) {
+		return &Result{Error: fmt.Sprintf("task %s not found", p.ID)}, nil
+	}
+	if err != nil {
+		return failed(ctx, err)
+	}
+	if p.Title != nil {
+		if strings.TrimSpace(*p.Title) == "" {
+			return &Result{Error: "title cannot be empty"}, nil
+		}
+		task.Title = strings.TrimSpace(*p.Title)
+	}
+	if p.Content != nil {
+		task.Content = *p.Content
+	}
+	if p.Deadline != nil {
+		task.Deadline = ""
+		if *p.Deadline != "" {
+			due, err := parseDeadline(*p.Deadline, t.config.Location)
+			if err != nil {
+				return &Result{Error: err.Error()}, nil
+			}
+			task.Deadline = formatDeadline(due)
+		}
+	}
+	if p.Completed != nil {
+		task.Completed = *p.Completed
+	}
+	if err := t.config.Store.Update(ctx, task); err != nil {
+		return failed(ctx, err)
+	}
+	return &Result{Task: t.view(task)}, nil
+}
+
+func (t *tasks) delete(ctx context.Context, p *DeleteParams) (*Result, error) {
+	task, err := t.config.Store.Get(ctx, p.ID)
+	if err == nil {
+		err = t.config.Store.Delete(ctx, p.ID)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return &Result{Error: fmt.Sprintf("task %s not found", p.ID)}, nil
+	}
+	if err != nil {
+		return failed(ctx, err)
+	}
+	return &Result{Task: t.view(task)}, nil
+}
+
+func (t *tasks) list(ctx context.Context, p *ListParams) (*ListResult, error) {
+	var before, after time.Time
+	var err error
+	if p.DueBefore != "" {
+		if before, err = parseDeadline(p.DueBefore, t.config.Location); err != nil {
+			return &ListResult{Error: "due_before: " + err.Error()}, nil
+		}
+	}
+	if p.DueAfter != "" {
+		if after, err = parseDeadline(p.DueAfter, t.config.Location); err != nil {
+			return &ListResult{Error: "due_after: " + err.Error()}, nil
+		}
+	}
+	all, err := t.config.Store.List(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return &ListResult{Error: err.Error()}, nil
+	}
+
+	query := strings.ToLower(p.Query)
+	var views []*TaskView
+	for _, task := range all {
+		if query != "" && !strings.Contains(strings.ToLower(task.Title), query) && !strings.Contains(strings.ToLower(task.Content), query) {
+			continue
+		}
+		if p.Completed != nil && task.Completed != *p.Completed {
+			continue
+		}
+		v := t.view(task)
+		if p.Overdue && !v.Overdue {
+			continue
+		}
+		if !before.IsZero() || !after.IsZero() {
+			due, ok := t.deadline(task)
+			if !ok || !before.IsZero() && !due.Before(before) || !after.IsZero() && !due.After(after) {
+				continue
+			}
+		}
+		views = append(views, v)
+	}
+
+	// 未完成的在前，按截止时间排序，没有截止时间的排在后面，其余按创建时间倒序
+	sort.SliceStable(views, func(i, j int) bool {
+		a, b := views[i], views[j]
+		if a.Completed != b.Completed {
+			return !a.Completed
+		}
+		dueA, okA := t.deadline(&Task{Deadline: a.Deadline})
+		dueB, okB := t.deadline(&Task{Deadline: b.Deadline})
+		if okA != okB {
+			return okA
+		}
+		if okA && !dueA.Equal(dueB) {
+			return dueA.Before(dueB)
+		}
+		return a.CreatedAt > b.CreatedAt
+	})
+
+	limit := p.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	res := &ListResult{Tasks: views, Total: len(views)}
+	if len(views) > limit {
+		res.Tasks = views[:limit]
+	}
+	if res.Tasks == nil {
+		res.Tasks = []*TaskView{}
+	}
+	return res, nil
+}
+
+// deadline parses the due date of a task, tasks written by other versions may have any format.
+func (t *tasks) deadline(task *Task) (time.Time, bool) {
+	if task.Deadline == "" {
+		return time.Time{}, false
+	}
+	due, err := parseDeadline(task.Deadline, t.config.Location)
+	return due, err == nil
+}
+
+func (t *tasks) view(task *Task) *TaskView {
+	v := &TaskView{
+		ID:        task.ID,
+		Title:     task.Title,
+		Content:   task.Content,
+		Completed: task.Completed,
+		Deadline:  task.Deadline,
+		CreatedAt: task.CreatedAt,
+	}
+	if due, ok := t.deadline(task); ok && !task.Completed && due.Before(t.config.Now()) {
+		v.Overdue = true
+	}
+	return v
+}
@@ -0,0 +1,252 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+)
+
+type GitCloneAction string
+
+const (
+	GitCloneActionClone GitCloneAction = "clone"
+	GitCloneActionPull  GitCloneAction = "pull"
+)
+
+// GitCloneRequest keeps the parameters of the eino_assistant gitclone tool.
+type GitCloneRequest struct {
+	Url    string         `json:"url" jsonschema_description:"The URL of the repository to clone"`
+	Action GitCloneAction `json:"action" jsonschema_description:"The action to perform, 'clone' or 'pull'"`
+}
+
+type GitCloneResponse struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+var repoSegment = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// parseRepoURL accepts https URLs and host/group/repo shorthands of public hosts. It returns the
+// URL to clone and the directory of the repository in the workspace. Local paths, other transports
+// (http, ssh, ext) and private hosts are rejected, they would let git read outside the workspace
+// or reach the internal network of the server.
+func parseRepoURL(raw string) (cloneURL, dir string, err error) {
+	raw = strings.TrimSpace(raw)
+	var host, repoPath string
+	switch {
+	case strings.HasPrefix(raw, "https://"):
+		host, repoPath, _ = strings.Cut(strings.TrimPrefix(raw, "https://"), "/")
+	case strings.Contains(raw, "://"), strings.HasPrefix(raw, "git@"):
+		return "", "", fmt.Errorf("unsupported protocol in %s, use https", raw)
+	default:
+		host, repoPath, _ = strings.Cut(raw, "/")
+		raw = "https://" + raw
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	segments := strings.Split(repoPath, "/")
+	if !repoSegment.MatchString(host) || len(segments) < 2 {
+		return "", "", fmt.Errorf("invalid repository url %s", raw)
+	}
+	if privateHost(host) {
+		return "", "", fmt.Errorf("%s is not a public host", host)
+	}
+	for _, s := range segments {
+		if !repoSegment.MatchString(s) || strings.Contains(s, "..") {
+			return "", "", fmt.Errorf("invalid repository url %s", raw)
+		}
+	}
+
+	if !strings.HasSuffix(raw, ".git") {
+		raw = strings.TrimSuffix(raw, "/") + ".git"
+	}
+	return raw, path.Join("repos", host, repoPath), nil
+}
+
+// NewGitCloneFile replaces the eino_assistant gitclone tool: public repositories are cloned over https
+// into the workspace of the conversation, without symlinks, and removed as soon as they grow larger
+// than MaxRepoBytes.
+func NewGitCloneFile(ctx context.Context, w *Workspace) (tool.InvokableTool, error) {
+	return utils.InferTool("gitclone", "git clone or pull a repository into the workspace of the conversation", func(ctx context.Context, req *GitCloneRequest) (*GitCloneResponse, error) {
+		msg, err := w.gitClone(ctx, req)
+		if err != nil {
+			return &GitCloneResponse{Error: err.Error()}, nil
+		}
+		return &GitCloneResponse{Message: msg}, nil
+	})
+}
+
+func (w *Workspace) gitClone(ctx context.Context, req *GitCloneRequest) (string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", errors.New("git is not installed on the server")
+	}
+	cloneURL, rel, err := parseRepoURL(req.Url)
+	if err != nil {
+		return "", err
+	}
+	dir, err := w.Dir(ctx)
+	if err != nil {
+		return "", fmt.Errorf("workspace unavailable: %w", err)
+	}
+	repoPath, err := Resolve(dir, rel)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.config.CloneTimeout)
+	defer cancel()
+	host, _, _ := strings.Cut(strings.TrimPrefix(cloneURL, "https://"), "/")
+	if err := checkPublicHost(ctx, host); err != nil {
+		return "", err
+	}
+	// 不创建符号链接，也不允许通过子模块、重定向等方式读取本地仓库或访问内网
+	args := []string{"-c", "core.symlinks=false", "-c", "protocol.file.allow=never",
+		"-c", "protocol.allow=never", "-c", "protocol.https.allow=always", "-c", "http.followRedirects=false"}
+	switch req.Action {
+	case GitCloneActionClone, "":
+		if _, err := os.Stat(repoPath); err == nil {
+			return "", fmt.Errorf("repository already exists at %s, use pull", rel)
+		}
+		if err := os.MkdirAll(filepath.Dir(repoPath), 0o755); err != nil {
+			return "", err
+		}
+		args = append(args, "clone", "--depth", "1", "--no-tags", "--", cloneURL, repoPath)
+	case GitCloneActionPull:
+		if _, err := os.Stat(repoPath); err != nil {
+			return "", fmt.Errorf("repository does not exist at %s, use clone", rel)
+		}
+		args = append(args, "-C", repoPath, "pull", "--ff-only")
+	default:
+		return "", fmt.Errorf("unknown action %q, use clone or pull", req.Action)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := runBounded(ctx, cmd, repoPath, w.config.MaxRepoBytes)
+	if errors.Is(err, errTooLarge) {
+		_ = os.RemoveAll(repoPath)
+		return "", fmt.Errorf("repository is larger than the limit of %d bytes, it was removed", w.config.MaxRepoBytes)
+	}
+	if err != nil {
+		if req.Action != GitCloneActionPull {
+			_ = os.RemoveAll(repoPath)
+		}
+		return "", fmt.Errorf("git %s failed: %v, output: %s", req.Action, err, strings.TrimSpace(output))
+	}
+	return fmt.Sprintf("success, repo path: %s", rel), nil
+}
+
+// privateHost tells whether host is an IP address or a name of the local or internal network.
+func privateHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip := net.ParseIP(host); ip != nil {
+		return !publicIP(ip)
+	}
+	if !strings.Contains(host, ".") {
+		return true
+	}
+	for _, suffix := range []string{".localhost", ".local", ".internal", ".lan", ".home.arpa"} {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// checkPublicHost resolves host and rejects it when one of its addresses is not public, a public
+// name may point to the internal network.
+func checkPublicHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Errorf("%s resolves to %s, which is not a public address", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// sizePollInterval is how often the size of a repository is checked while git runs.
+var sizePollInterval = 500 * time.Millisecond
+
+// errTooLarge is returned by runBounded when the directory exceeded its limit.
+var errTooLarge = errors.New("directory too large")
+
+// runBounded runs cmd, killing it as soon as dir is larger than maxBytes, so that a large repository
+// does not fill the disk before its size is checked. It returns the output of cmd.
+func runBounded(ctx context.Context, cmd *exec.Cmd, dir string, maxBytes int64) (string, error) {
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	ticker := time.NewTicker(sizePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				if size, sizeErr := dirSize(dir); sizeErr != nil {
+					err = sizeErr
+				} else if size > maxBytes {
+					err = errTooLarge
+				}
+			}
+			return output.String(), err
+		case <-ticker.C:
+			if size, err := dirSize(dir); err == nil && size > maxBytes {
+				_ = cmd.Process.Kill()
+				<-done
+				return output.String(), errTooLarge
+			}
+		case <-ctx.Done():
+			// CommandContext 已经结束了进程
+			return output.String(), <-done
+		}
+	}
+}
+
+func dirSize(root string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	return size, err
+}
@@ -0,0 +1,113 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+)
+
+// maxDirEntries caps the entries listed for a directory.
+const maxDirEntries = 200
+
+// OpenReq keeps the parameters of the eino_assistant open tool, so that prompts written for it still work.
+type OpenReq struct {
+	URI string `json:"uri" jsonschema_description:"The path of the file or directory to open, relative to the workspace of the conversation"`
+}
+
+type DirEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir,omitempty"`
+	Size  int64  `json:"size,omitempty"`
+}
+
+type OpenRes struct {
+	Path      string     `json:"path,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	Entries   []DirEntry `json:"entries,omitempty"`
+	Truncated bool       `json:"truncated,omitempty"`
+	Message   string     `json:"message,omitempty"`
+}
+
+// NewOpenFileTool replaces the eino_assistant open tool, which opened anything with the default
+// application of the server. It reads files and lists directories of the conversation workspace.
+func NewOpenFileTool(ctx context.Context, w *Workspace) (tool.InvokableTool, error) {
+	return utils.InferTool("open", "read a file or list a directory in the workspace of the conversation, e.g. a cloned repository", func(ctx context.Context, req *OpenReq) (*OpenRes, error) {
+		return w.open(ctx, req), nil
+	})
+}
+
+// open reports failures in the result, the model can correct its request.
+func (w *Workspace) open(ctx context.Context, req *OpenReq) *OpenRes {
+	if req.URI == "" {
+		return &OpenRes{Message: "uri is required"}
+	}
+	if strings.HasPrefix(req.URI, "http://") || strings.HasPrefix(req.URI, "https://") {
+		return &OpenRes{Message: "web urls cannot be opened, only files of the workspace"}
+	}
+
+	dir, err := w.Dir(ctx)
+	if err != nil {
+		return &OpenRes{Message: fmt.Sprintf("workspace unavailable: %v", err)}
+	}
+	path, err := Resolve(dir, req.URI)
+	if err != nil {
+		return &OpenRes{Message: fmt.Sprintf("cannot open %s: %v", req.URI, err)}
+	}
+	rel, _ := filepath.Rel(dir, path)
+
+	// os.Root 再次限制访问范围，避免检查之后路径被替换为符号链接
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return &OpenRes{Message: fmt.Sprintf("workspace unavailable: %v", err)}
+	}
+	defer root.Close()
+
+	f, err := root.Open(rel)
+	if err != nil {
+		return &OpenRes{Message: fmt.Sprintf("cannot open %s: %v", rel, err)}
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return &OpenRes{Message: fmt.Sprintf("cannot open %s: %v", rel, err)}
+	}
+
+	res := &OpenRes{Path: filepath.ToSlash(rel)}
+	if info.IsDir() {
+		entries, err := f.ReadDir(maxDirEntries + 1)
+		if err != nil && err != io.EOF {
+			return &OpenRes{Message: fmt.Sprintf("cannot list %s: %v", rel, err)}
+		}
+		if len(entries) > maxDirEntries {
+			entries, res.Truncated = entries[:maxDirEntries], true
+		}
+		for _, e := range entries {
+			entry := DirEntry{Name: e.Name(), IsDir: e.IsDir()}
+			if fi, err := e.Info(); err == nil && !e.IsDir() {
+				entry.Size = fi.Size()
+			}
+			res.Entries = append(res.Entries, entry)
+		}
+		return res
+	}
+	if !info.Mode().IsRegular() {
+		return &OpenRes{Message: fmt.Sprintf("%s is not a regular file", rel)}
+	}
+
+	content, err := io.ReadAll(io.LimitReader(f, w.config.MaxFileBytes))
+	if err != nil {
+		return &OpenRes{Message: fmt.Sprintf("cannot read %s: %v", rel, err)}
+	}
+	res.Content = string(content)
+	if info.Size() > w.config.MaxFileBytes {
+		res.Truncated = true
+		res.Message = fmt.Sprintf("only the first %d of %d bytes are returned", w.config.MaxFileBytes, info.Size())
+	}
+	return res
+}
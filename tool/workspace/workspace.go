@@ -0,0 +1,218 @@
+// Package workspace confines the file and git tools of the agent to a directory on the server.
+// Every conversation works in its own directory under the workspace root, paths given by the
+// model are relative to it and can neither leave it with ".." nor through symlinks.
+package workspace
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"myeino/util"
+)
+
+// ErrOutsideWorkspace is returned for paths leaving the conversation directory.
+var ErrOutsideWorkspace = errors.New("path is outside the workspace")
+
+// Config configures a Workspace, zero values use the defaults.
+type Config struct {
+	// Root holds the conversation directories, default data/workspace.
+	Root string
+	// MaxFileBytes caps the content returned when reading a file, default 256 KiB.
+	MaxFileBytes int64
+	// MaxRepoBytes caps the size of a cloned repository, default 200 MiB.
+	MaxRepoBytes int64
+	// CloneTimeout bounds git clone and pull, default 2m.
+	CloneTimeout time.Duration
+	// TTL removes conversation directories left untouched for that long, default 7 days, negative keeps them.
+	TTL time.Duration
+}
+
+// Workspace hands out the per-conversation directories.
+type Workspace struct {
+	root   string
+	config Config
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// New creates the workspace root and starts removing expired directories unless TTL is negative.
+func New(config *Config) (*Workspace, error) {
+	c := Config{}
+	if config != nil {
+		c = *config
+	}
+	if c.Root == "" {
+		c.Root = "data/workspace"
+	}
+	if c.MaxFileBytes <= 0 {
+		c.MaxFileBytes = 256 << 10
+	}
+	if c.MaxRepoBytes <= 0 {
+		c.MaxRepoBytes = 200 << 20
+	}
+	if c.CloneTimeout <= 0 {
+		c.CloneTimeout = 2 * time.Minute
+	}
+	if c.TTL == 0 {
+		c.TTL = 7 * 24 * time.Hour
+	}
+
+	if err := os.MkdirAll(c.Root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace root: %w", err)
+	}
+	// 解析根目录本身的符号链接，后续的包含关系检查都基于真实路径
+	root, err := filepath.Abs(c.Root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace root: %w", err)
+	}
+
+	w := &Workspace{root: root, config: c, stop: make(chan struct{})}
+	if c.TTL > 0 {
+		go w.janitor()
+	}
+	return w, nil
+}
+
+// Root returns the resolved workspace root.
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// Close stops removing expired directories.
+func (w *Workspace) Close() error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	return nil
+}
+
+// dirName maps the conversation of ctx to its directory. Conversation IDs are chosen by clients,
+// the tenant and user are hashed in so that users cannot reach each other's directories.
+func dirName(ctx context.Context) string {
+	id := util.ConversationIDFromContext(ctx)
+	if id == "" {
+		id = "default"
+	}
+	sum := sha256.Sum256([]byte(util.TenantIDFromContext(ctx) + "\x00" + util.UserIDFromContext(ctx) + "\x00" + id))
+
+	var b strings.Builder
+	for _, r := range id {
+		if b.Len() >= 32 {
+			break
+		}
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String() + "-" + hex.EncodeToString(sum[:8])
+}
+
+// Dir returns the directory of the conversation of ctx, creating it if needed.
+func (w *Workspace) Dir(ctx context.Context) (string, error) {
+	dir := filepath.Join(w.root, dirName(ctx))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_ = os.Chtimes(dir, now, now)
+	return dir, nil
+}
+
+// Remove deletes the directory of the conversation of ctx, once the conversation is deleted.
+func (w *Workspace) Remove(ctx context.Context) error {
+	return os.RemoveAll(filepath.Join(w.root, dirName(ctx)))
+}
+
+// Resolve returns the absolute path of name inside dir. name is relative to dir, an absolute path is
+// accepted when it lies inside dir. Symlinks on the way are followed and must stay inside dir;
+// the path itself does not need to exist.
+func Resolve(dir, name string) (string, error) {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	name = strings.TrimPrefix(name, "file://")
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return "", ErrOutsideWorkspace
+		}
+		name = rel
+	}
+	name = filepath.Clean(name)
+	if name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) || filepath.IsAbs(name) {
+		return "", ErrOutsideWorkspace
+	}
+
+	path := filepath.Join(dir, name)
+	// 找到已存在的最长前缀并解析其中的符号链接
+	existing, rest := path, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if !within(dir, real) {
+		return "", ErrOutsideWorkspace
+	}
+	return filepath.Join(real, rest), nil
+}
+
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Sweep removes the conversation directories not used since olderThan.
+func (w *Workspace) Sweep(olderThan time.Duration) {
+	entries, err := os.ReadDir(w.root)
+	if err != nil {
+		log.Printf("[Workspace] Failed to list %s: %v", w.root, err)
+		return
+	}
+	deadline := time.Now().Add(-olderThan)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !e.IsDir() || info.ModTime().After(deadline) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(w.root, e.Name())); err != nil {
+			log.Printf("[Workspace] Failed to remove %s: %v", e.Name(), err)
+		}
+	}
+}
+
+func (w *Workspace) janitor() {
+	interval := min(w.config.TTL, time.Hour)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.Sweep(w.config.TTL)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"myeino/util"
+)
+
+func newTestWorkspace(t *testing.T, config *Config) *Workspace {
+	t.Helper()
+	if config == nil {
+		config = &Config{}
+	}
+	config.Root = t.TempDir()
+	w, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "conv")
+	outside := filepath.Join(base, "secret")
+	writeFile(t, filepath.Join(dir, "repo", "main.go"), "package main")
+	writeFile(t, filepath.Join(outside, "key"), "secret")
+	for name, target := range map[string]string{
+		"escape":      outside,
+		"escape-file": filepath.Join(outside, "key"),
+		"inside":      filepath.Join(dir, "repo"),
+		"relative":    "../secret",
+		"dangling":    filepath.Join(outside, "missing"),
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "file", path: "repo/main.go", want: "repo/main.go"},
+		{name: "dot", path: ".", want: ""},
+		{name: "cleaned", path: "repo/../repo/./main.go", want: "repo/main.go"},
+		{name: "not existing", path: "repo/new/file.txt", want: "repo/new/file.txt"},
+		{name: "absolute inside", path: filepath.Join(dir, "repo"), want: "repo"},
+		{name: "file url", path: "file://repo/main.go", want: "repo/main.go"},
+		{name: "symlink inside", path: "inside/main.go", want: "repo/main.go"},
+		{name: "parent", path: "..", wantErr: true},
+		{name: "traversal", path: "../secret/key", wantErr: true},
+		{name: "deep traversal", path: "repo/../../secret/key", wantErr: true},
+		{name: "absolute outside", path: "/etc/passwd", wantErr: true},
+		{name: "symlink dir escape", path: "escape/key", wantErr: true},
+		{name: "symlink file escape", path: "escape-file", wantErr: true},
+		{name: "relative symlink escape", path: "relative/key", wantErr: true},
+		{name: "symlink escape to new file", path: "escape/new.txt", wantErr: true},
+		{name: "dangling symlink", path: "dangling", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(dir, tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Resolve(%q) = %s, want an error", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("Resolve(%q) = %s, want %s", tt.path, got, want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	w := newTestWorkspace(t, &Config{MaxFileBytes: 8})
+	ctx := util.WithConversationID(context.Background(), "c1")
+	dir, err := w.Dir(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "small.txt"), "hello")
+	writeFile(t, filepath.Join(dir, "big.txt"), "0123456789")
+	writeFile(t, filepath.Join(dir, "sub", "a.txt"), "a")
+	if err := os.Symlink("/etc", filepath.Join(dir, "etc")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		uri  string
+		// check returns a description of what is wrong with res
+		check func(res *OpenRes) string
+	}{
+		{"file", "small.txt", func(res *OpenRes) string {
+			if res.Content != "hello" || res.Truncated {
+				return "content not returned"
+			}
+			return ""
+		}},
+		{"size cap", "big.txt", func(res *OpenRes) string {
+			if res.Content != "01234567" || !res.Truncated {
+				return "content not truncated"
+			}
+			return ""
+		}},
+		{"directory", ".", func(res *OpenRes) string {
+			if len(res.Entries) != 4 {
+				return "entries not listed"
+			}
+			return ""
+		}},
+		{"symlink escape", "etc/passwd", func(res *OpenRes) string {
+			if res.Content != "" || !strings.Contains(res.Message, ErrOutsideWorkspace.Error()) {
+				return "escape not rejected"
+			}
+			return ""
+		}},
+		{"traversal", "../../etc/passwd", func(res *OpenRes) string {
+			if res.Content != "" || res.Message == "" {
+				return "traversal not rejected"
+			}
+			return ""
+		}},
+		{"web url", "https://example.com", func(res *OpenRes) string {
+			if res.Message == "" {
+				return "url accepted"
+			}
+			return ""
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := w.open(ctx, &OpenReq{URI: tt.uri})
+			if problem := tt.check(res); problem != "" {
+				t.Errorf("%s: %+v", problem, res)
+			}
+		})
+	}
+}
+
+func TestParseRepoURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		clone   string
+		dir     string
+		wantErr bool
+	}{
+		{url: "https://github.com/cloudwego/eino", clone: "https://github.com/cloudwego/eino.git", dir: "repos/github.com/cloudwego/eino"},
+		{url: "github.com/cloudwego/eino.git", clone: "https://github.com/cloudwego/eino.git", dir: "repos/github.com/cloudwego/eino"},
+		{url: "git@github.com:cloudwego/eino.git", wantErr: true},
+		{url: "http://github.com/cloudwego/eino", wantErr: true},
+		{url: "ssh://git@github.com/cloudwego/eino", wantErr: true},
+		{url: "https://127.0.0.1/group/repo", wantErr: true},
+		{url: "https://10.0.0.8/group/repo", wantErr: true},
+		{url: "https://169.254.169.254/group/repo", wantErr: true},
+		{url: "https://localhost/group/repo", wantErr: true},
+		{url: "https://gitlab/group/repo", wantErr: true},
+		{url: "gitlab.corp.internal/group/repo", wantErr: true},
+		{url: "file:///etc", wantErr: true},
+		{url: "ext::sh -c touch% /tmp/pwned", wantErr: true},
+		{url: "/home/user/repo", wantErr: true},
+		{url: "../other/repo", wantErr: true},
+		{url: "https://github.com/../../etc", wantErr: true},
+		{url: "https://github.com/cloudwego/-upload-pack=evil", wantErr: true},
+		{url: "https://github.com/eino", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			clone, dir, err := parseRepoURL(tt.url)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("accepted as %s in %s", clone, dir)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clone != tt.clone || dir != tt.dir {
+				t.Errorf("got %s in %s, want %s in %s", clone, dir, tt.clone, tt.dir)
+			}
+		})
+	}
+}
+
+func TestRunBounded(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	defer func(interval time.Duration) { sizePollInterval = interval }(sizePollInterval)
+	sizePollInterval = 10 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		script  string
+		wantErr error
+	}{
+		{"small", "head -c 1024 /dev/zero > f", nil},
+		// 一直写下去的进程在超过上限时被结束，不会等到超时
+		{"growing", "while :; do head -c 65536 /dev/zero >> f; sleep 0.01; done", errTooLarge},
+		{"large at exit", "head -c 2097152 /dev/zero > f", errTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			cmd := exec.CommandContext(ctx, "sh", "-c", tt.script)
+			cmd.Dir = dir
+			_, err := runBounded(ctx, cmd, dir, 1<<20)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if ctx.Err() != nil {
+				t.Error("the command was only stopped by the timeout")
+			}
+		})
+	}
+}
+
+func TestDirPerConversationAndSweep(t *testing.T) {
+	w := newTestWorkspace(t, nil)
+	ctx := util.WithConversationID(context.Background(), "same-id")
+	alice, err := w.Dir(util.WithUserID(ctx, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := w.Dir(util.WithUserID(ctx, "bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice == bob || filepath.Dir(alice) != w.Root() {
+		t.Fatalf("directories not separated: %s, %s", alice, bob)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(alice, old, old); err != nil {
+		t.Fatal(err)
+	}
+	w.Sweep(time.Hour)
+	if _, err := os.Stat(alice); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired directory kept: %v", err)
+	}
+	if _, err := os.Stat(bob); err != nil {
+		t.Errorf("recent directory removed: %v", err)
+	}
+}
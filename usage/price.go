@@ -0,0 +1,77 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Price is the cost of a model per million tokens.
+type Price struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+// PriceTable maps model names to prices. The optional "*" model is used for unknown models.
+type PriceTable struct {
+	Currency string           `json:"currency"`
+	Models   map[string]Price `json:"models"`
+}
+
+// DefaultPriceTable returns list prices of the models this project is usually configured with.
+func DefaultPriceTable() *PriceTable {
+	return &PriceTable{
+		Currency: "USD",
+		Models: map[string]Price{
+			"claude-4.0-sonnet": {InputPerMillion: 3, OutputPerMillion: 15},
+			"gpt-4o":            {InputPerMillion: 2.5, OutputPerMillion: 10},
+			"gpt-4o-mini":       {InputPerMillion: 0.15, OutputPerMillion: 0.6},
+		},
+	}
+}
+
+// LoadPriceTable reads a JSON price file:
+//
+//	{"currency": "USD", "models": {"claude-4.0-sonnet": {"input_per_million": 3, "output_per_million": 15}}}
+func LoadPriceTable(path string) (*PriceTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price file: %w", err)
+	}
+
+	var t PriceTable
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid price file %s: %w", path, err)
+	}
+	if len(t.Models) == 0 {
+		return nil, fmt.Errorf("price file %s defines no models", path)
+	}
+	if t.Currency == "" {
+		t.Currency = "USD"
+	}
+	return &t, nil
+}
+
+// Lookup returns the price of a model, matching case-insensitively and falling back to "*".
+func (t *PriceTable) Lookup(model string) (Price, bool) {
+	if p, ok := t.Models[model]; ok {
+		return p, true
+	}
+	for name, p := range t.Models {
+		if strings.EqualFold(name, model) {
+			return p, true
+		}
+	}
+	p, ok := t.Models["*"]
+	return p, ok
+}
+
+// Cost returns the cost of a call, zero if the model has no price.
+func (t *PriceTable) Cost(model string, promptTokens, completionTokens int) float64 {
+	p, ok := t.Lookup(model)
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*p.InputPerMillion + float64(completionTokens)*p.OutputPerMillion) / 1e6
+}
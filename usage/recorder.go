@@ -0,0 +1,130 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"myeino/telemetry"
+	"myeino/util"
+)
+
+// Recorder is an eino callbacks.Handler storing the token usage of every chat model call,
+// including the calls made inside the ReAct loop. The conversation, user, request and caller are
+// taken from the context, see util.WithConversationID, util.WithUserID, util.WithRequestID and WithCaller.
+type Recorder struct {
+	store *Store
+}
+
+type modelNameKey struct{}
+
+type callerKey struct{}
+
+// WithCaller stores the caller charged for the tokens of the request, see Record.Caller.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the caller stored by WithCaller, or an empty string.
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// NewRecorder creates a Recorder writing to store.
+func NewRecorder(store *Store) *Recorder {
+	return &Recorder{store: store}
+}
+
+func (r *Recorder) OnStart(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
+	if info == nil || info.Component != components.ComponentOfChatModel {
+		return ctx
+	}
+	// The model name is only known from the input config when the component reports its own callbacks.
+	if mi := model.ConvCallbackInput(input); mi != nil && mi.Config != nil && mi.Config.Model != "" {
+		return context.WithValue(ctx, modelNameKey{}, mi.Config.Model)
+	}
+	return ctx
+}
+
+func (r *Recorder) OnEnd(ctx context.Context, info *callbacks.RunInfo, output callbacks.CallbackOutput) context.Context {
+	if info == nil || info.Component != components.ComponentOfChatModel {
+		return ctx
+	}
+	r.record(ctx, info, telemetry.TokenUsageOf(output))
+	return ctx
+}
+
+func (r *Recorder) OnError(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+	return ctx
+}
+
+func (r *Recorder) OnStartWithStreamInput(ctx context.Context, info *callbacks.RunInfo, input *schema.StreamReader[callbacks.CallbackInput]) context.Context {
+	input.Close()
+	return ctx
+}
+
+func (r *Recorder) OnEndWithStreamOutput(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[callbacks.CallbackOutput]) context.Context {
+	if info == nil || info.Component != components.ComponentOfChatModel {
+		output.Close()
+		return ctx
+	}
+
+	// Providers report usage on the last chunk, so the stream has to be drained first.
+	go func() {
+		defer output.Close()
+		var usage *model.TokenUsage
+		for {
+			chunk, err := output.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				break
+			}
+			if u := telemetry.TokenUsageOf(chunk); u != nil {
+				usage = u
+			}
+		}
+		r.record(ctx, info, usage)
+	}()
+	return ctx
+}
+
+func (r *Recorder) record(ctx context.Context, info *callbacks.RunInfo, tu *model.TokenUsage) {
+	if tu == nil {
+		return
+	}
+	conversationID := util.ConversationIDFromContext(ctx)
+	if conversationID == "" {
+		return
+	}
+
+	modelName, _ := ctx.Value(modelNameKey{}).(string)
+	if modelName == "" {
+		modelName = info.Type
+	}
+
+	rec := &Record{
+		Time:             time.Now(),
+		ConversationID:   conversationID,
+		TenantID:         util.TenantIDFromContext(ctx),
+		UserID:           util.UserIDFromContext(ctx),
+		Caller:           CallerFromContext(ctx),
+		RequestID:        util.RequestIDFromContext(ctx),
+		Provider:         info.Type,
+		Model:            modelName,
+		PromptTokens:     tu.PromptTokens,
+		CompletionTokens: tu.CompletionTokens,
+		TotalTokens:      tu.TotalTokens,
+	}
+	if err := r.store.Add(rec); err != nil {
+		log.Printf("[Usage] Failed to record usage for chat ID: %s: %v", conversationID, err)
+	}
+}
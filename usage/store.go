@@ -0,0 +1,393 @@
+package usage
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DayLayout is the format of the day used to aggregate usage, days are in UTC.
+const DayLayout = "2006-01-02"
+
+// AnonymousUser is recorded when a request carries no user ID.
+const AnonymousUser = "anonymous"
+
+// Record is the token usage of one chat model call.
+type Record struct {
+	Time           time.Time `json:"time"`
+	ConversationID string    `json:"conversation_id"`
+	TenantID       string    `json:"tenant_id,omitempty"`
+	UserID         string    `json:"user_id"`
+	// Caller is who daily quotas charge the tokens to: the authenticated user, else the API key
+	// or client IP of the request. It is empty when no quota applied.
+	Caller           string  `json:"caller,omitempty"`
+	RequestID        string  `json:"request_id,omitempty"`
+	Provider         string  `json:"provider,omitempty"`
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Day returns the UTC day the record belongs to.
+func (r *Record) Day() string {
+	return r.Time.UTC().Format(DayLayout)
+}
+
+// Totals aggregates a set of records.
+type Totals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (t *Totals) add(r *Record) {
+	t.Calls++
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	t.TotalTokens += r.TotalTokens
+	t.Cost += r.Cost
+}
+
+// Filter selects records, empty fields match everything. From and To are inclusive days (YYYY-MM-DD).
+// User and conversation IDs are only unique within a tenant, filter by TenantID when serving a tenant.
+type Filter struct {
+	TenantID       string `json:"tenant_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	UserID         string `json:"user_id,omitempty"`
+	Caller         string `json:"caller,omitempty"`
+	From           string `json:"from,omitempty"`
+	To             string `json:"to,omitempty"`
+}
+
+func (f *Filter) match(r *Record) bool {
+	if f.TenantID != "" && r.TenantID != f.TenantID {
+		return false
+	}
+	if f.ConversationID != "" && r.ConversationID != f.ConversationID {
+		return false
+	}
+	if f.UserID != "" && r.UserID != f.UserID {
+		return false
+	}
+	if f.Caller != "" && r.Caller != f.Caller {
+		return false
+	}
+	day := r.Day()
+	if f.From != "" && day < f.From {
+		return false
+	}
+	if f.To != "" && day > f.To {
+		return false
+	}
+	return true
+}
+
+// Report is the aggregated usage matching a Filter.
+type Report struct {
+	Filter         Filter             `json:"filter"`
+	Currency       string             `json:"currency"`
+	Total          Totals             `json:"total"`
+	ByDay          map[string]*Totals `json:"by_day"`
+	ByModel        map[string]*Totals `json:"by_model"`
+	ByUser         map[string]*Totals `json:"by_user"`
+	ByConversation map[string]*Totals `json:"by_conversation"`
+	Records        []*Record          `json:"records,omitempty"`
+}
+
+// DefaultRetention is how long records are kept in memory for queries by default.
+const DefaultRetention = 31 * 24 * time.Hour
+
+// maxFileNameBytes bounds the file names of conversations, longer IDs are hashed.
+const maxFileNameBytes = 128
+
+// StoreConfig configures a Store.
+type StoreConfig struct {
+	// Dir holds one JSONL file of records per conversation.
+	Dir    string
+	Prices *PriceTable
+	// Retention is how long records can be queried, DefaultRetention if zero. Older records stay
+	// on disk, the totals of their conversations are kept.
+	Retention time.Duration
+}
+
+// Store persists usage records per conversation and aggregates them.
+// Records are appended to <Dir>/<conversation_id>.jsonl and kept in memory for queries during
+// the retention period. The totals of conversations and of users and callers per day are kept
+// up to date as records are added, quotas read them on every request.
+type Store struct {
+	mu        sync.RWMutex
+	dir       string
+	prices    *PriceTable
+	retention time.Duration
+	records   []*Record
+
+	conversations map[string]*Totals
+	userDays      map[string]*Totals
+	callerDays    map[string]*Totals
+	adds          int
+	now           func() time.Time
+}
+
+// GetDefaultStore returns a store next to the conversation memory, in data/usage.
+func GetDefaultStore() (*Store, error) {
+	return NewStore(&StoreConfig{Dir: "data/usage", Prices: DefaultPriceTable()})
+}
+
+// NewStore creates the store directory if needed and loads existing records.
+func NewStore(config *StoreConfig) (*Store, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+	if config.Dir == "" {
+		config.Dir = "/tmp/eino/usage"
+	}
+	if config.Prices == nil {
+		config.Prices = DefaultPriceTable()
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create usage directory: %w", err)
+	}
+
+	if config.Retention <= 0 {
+		config.Retention = DefaultRetention
+	}
+
+	s := &Store{
+		dir:           config.Dir,
+		prices:        config.Prices,
+		retention:     config.Retention,
+		conversations: map[string]*Totals{},
+		userDays:      map[string]*Totals{},
+		callerDays:    map[string]*Totals{},
+		now:           time.Now,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Prices returns the price table used to compute costs.
+func (s *Store) Prices() *PriceTable {
+	return s.prices
+}
+
+// Add prices the record if it has no cost yet, then persists it. The record counts towards the
+// totals even if it cannot be written, so that a failing disk does not lift quotas.
+func (s *Store) Add(r *Record) error {
+	if r.ConversationID == "" {
+		return fmt.Errorf("conversation id cannot be empty")
+	}
+	if r.UserID == "" {
+		r.UserID = AnonymousUser
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if r.TotalTokens == 0 {
+		r.TotalTokens = r.PromptTokens + r.CompletionTokens
+	}
+	if r.Cost == 0 {
+		r.Cost = s.prices.Cost(r.Model, r.PromptTokens, r.CompletionTokens)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(r)
+	if s.adds++; s.adds%256 == 0 {
+		s.evict()
+	}
+
+	f, err := os.OpenFile(s.filePath(r.ConversationID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open usage file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage record: %w", err)
+	}
+	return nil
+}
+
+// add counts r in the totals, and keeps it for queries if it is within the retention period.
+func (s *Store) add(r *Record) {
+	addTo(s.conversations, tenantKey(r.TenantID, r.ConversationID), r)
+	if r.Time.Before(s.now().Add(-s.retention)) {
+		return
+	}
+	day := r.Day()
+	addTo(s.userDays, tenantKey(r.TenantID, r.UserID)+"/"+day, r)
+	if r.Caller != "" {
+		addTo(s.callerDays, r.Caller+"/"+day, r)
+	}
+	s.records = append(s.records, r)
+}
+
+// evict drops the records and daily totals older than the retention period. Records are mostly
+// added in time order, a late one is dropped with the records after it.
+func (s *Store) evict() {
+	cutoff := s.now().Add(-s.retention)
+	i := sort.Search(len(s.records), func(i int) bool {
+		return !s.records[i].Time.Before(cutoff)
+	})
+	if i > 0 {
+		s.records = append([]*Record(nil), s.records[i:]...)
+	}
+	day := cutoff.UTC().Format(DayLayout)
+	for _, totals := range []map[string]*Totals{s.userDays, s.callerDays} {
+		for key := range totals {
+			if key[strings.LastIndexByte(key, '/')+1:] < day {
+				delete(totals, key)
+			}
+		}
+	}
+}
+
+// tenantKey identifies a user or conversation, IDs are only unique within a tenant.
+func tenantKey(tenantID, id string) string {
+	return tenantID + "\x00" + id
+}
+
+// Query aggregates the records of the retention period matching filter, includeRecords adds the
+// raw records to the report.
+func (s *Store) Query(filter Filter, includeRecords bool) *Report {
+	report := &Report{
+		Filter:         filter,
+		Currency:       s.prices.Currency,
+		ByDay:          map[string]*Totals{},
+		ByModel:        map[string]*Totals{},
+		ByUser:         map[string]*Totals{},
+		ByConversation: map[string]*Totals{},
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.records {
+		if !filter.match(r) {
+			continue
+		}
+		report.Total.add(r)
+		addTo(report.ByDay, r.Day(), r)
+		addTo(report.ByModel, r.Model, r)
+		addTo(report.ByUser, r.UserID, r)
+		addTo(report.ByConversation, r.ConversationID, r)
+		if includeRecords {
+			cp := *r
+			report.Records = append(report.Records, &cp)
+		}
+	}
+	return report
+}
+
+// Conversation returns the totals of a single conversation of a tenant.
+func (s *Store) Conversation(tenantID, id string) Totals {
+	return s.totals(s.conversations, tenantKey(tenantID, id))
+}
+
+// UserDay returns the totals of a user of a tenant on a day (YYYY-MM-DD) of the retention period.
+func (s *Store) UserDay(tenantID, userID, day string) Totals {
+	return s.totals(s.userDays, tenantKey(tenantID, userID)+"/"+day)
+}
+
+// CallerDay returns the totals charged to a caller on a day (YYYY-MM-DD) of the retention period,
+// see Record.Caller.
+func (s *Store) CallerDay(caller, day string) Totals {
+	return s.totals(s.callerDays, caller+"/"+day)
+}
+
+func (s *Store) totals(m map[string]*Totals, key string) Totals {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if t, ok := m[key]; ok {
+		return *t
+	}
+	return Totals{}
+}
+
+func addTo(m map[string]*Totals, key string, r *Record) {
+	t, ok := m[key]
+	if !ok {
+		t = &Totals{}
+		m[key] = t
+	}
+	t.add(r)
+}
+
+func (s *Store) filePath(conversationID string) string {
+	// conversation IDs come from clients, keep them inside the store directory and within the
+	// limits of file names; records carry their conversation ID, the name is only a hint
+	name := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(conversationID)
+	if len(name) > maxFileNameBytes {
+		sum := sha256.Sum256([]byte(conversationID))
+		name = "sha256-" + hex.EncodeToString(sum[:])
+	}
+	return filepath.Join(s.dir, name+".jsonl")
+}
+
+func (s *Store) load() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read usage directory: %w", err)
+	}
+
+	var records []*Record
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".jsonl") {
+			continue
+		}
+		if records, err = loadFile(filepath.Join(s.dir, file.Name()), records); err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	for _, r := range records {
+		s.add(r)
+	}
+	return nil
+}
+
+func loadFile(path string, records []*Record) ([]*Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			log.Printf("[Usage] Skipping malformed record in %s: %v", path, err)
+			continue
+		}
+		records = append(records, &r)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,264 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"myeino/util"
+)
+
+type fakeChatModel struct{}
+
+func (f *fakeChatModel) Generate(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	msg := schema.AssistantMessage("hello", nil)
+	msg.ResponseMeta = &schema.ResponseMeta{Usage: &schema.TokenUsage{PromptTokens: 1000, CompletionTokens: 200, TotalTokens: 1200}}
+	return msg, nil
+}
+
+func (f *fakeChatModel) Stream(ctx context.Context, in []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, _ := f.Generate(ctx, in, opts...)
+	return schema.StreamReaderFromArray([]*schema.Message{schema.AssistantMessage("he", nil), msg}), nil
+}
+
+func (f *fakeChatModel) BindTools(tools []*schema.ToolInfo) error { return nil }
+
+func newTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := NewStore(&StoreConfig{Dir: dir, Prices: &PriceTable{
+		Currency: "USD",
+		Models:   map[string]Price{"fakeChatModel": {InputPerMillion: 3, OutputPerMillion: 15}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func runModel(t *testing.T, ctx context.Context, rec *Recorder, stream bool) {
+	t.Helper()
+	g := compose.NewGraph[[]*schema.Message, *schema.Message]()
+	_ = g.AddChatModelNode("ChatModel", &fakeChatModel{})
+	_ = g.AddEdge(compose.START, "ChatModel")
+	_ = g.AddEdge("ChatModel", compose.END)
+	r, err := g.Compile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := []*schema.Message{schema.UserMessage("hi")}
+	if !stream {
+		if _, err := r.Invoke(ctx, in, compose.WithCallbacks(rec)); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	sr, err := r.Stream(ctx, in, compose.WithCallbacks(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sr.Close()
+	for {
+		if _, err := sr.Recv(); errors.Is(err, io.EOF) {
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecorderAggregatesPerConversationAndUser(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+	rec := NewRecorder(store)
+
+	ctx := util.WithConversationID(context.Background(), "conv-1")
+	ctx = util.WithUserID(ctx, "alice")
+	ctx = WithCaller(ctx, "alice")
+	runModel(t, ctx, rec, false)
+	runModel(t, ctx, rec, true)
+
+	other := util.WithConversationID(context.Background(), "conv-2")
+	runModel(t, other, rec, false)
+
+	// Streaming usage is recorded once the callback copy of the stream is drained.
+	deadline := time.Now().Add(2 * time.Second)
+	for store.Conversation("", "conv-1").Calls < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("stream usage not recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	conv := store.Conversation("", "conv-1")
+	if conv.PromptTokens != 2000 || conv.CompletionTokens != 400 || conv.TotalTokens != 2400 {
+		t.Errorf("unexpected conversation totals: %+v", conv)
+	}
+	// 1000 prompt tokens at 3/M + 200 completion tokens at 15/M per call
+	if want := 2 * 0.006; math.Abs(conv.Cost-want) > 1e-9 {
+		t.Errorf("cost = %v, want %v", conv.Cost, want)
+	}
+
+	today := time.Now().UTC().Format(DayLayout)
+	if got := store.UserDay("", "alice", today); got.Calls != 2 {
+		t.Errorf("alice calls today = %d", got.Calls)
+	}
+	if got := store.UserDay("", AnonymousUser, today); got.Calls != 1 {
+		t.Errorf("anonymous calls today = %d", got.Calls)
+	}
+	if got := store.CallerDay("alice", today); got.Calls != 2 {
+		t.Errorf("calls charged to alice today = %d", got.Calls)
+	}
+
+	report := store.Query(Filter{From: today, To: today}, true)
+	if report.Total.Calls != 3 || len(report.ByConversation) != 2 || len(report.Records) != 3 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.ByModel["fakeChatModel"] == nil || report.Currency != "USD" {
+		t.Errorf("unexpected model breakdown: %+v", report.ByModel)
+	}
+	if got := store.Query(Filter{To: "2000-01-01"}, false).Total.Calls; got != 0 {
+		t.Errorf("expected no records before 2000, got %d", got)
+	}
+
+	// Records survive a restart.
+	reloaded := newTestStore(t, dir)
+	if got := reloaded.Conversation("", "conv-1"); got != conv {
+		t.Errorf("reloaded totals %+v, want %+v", got, conv)
+	}
+}
+
+func TestRecorderSeparatesTenants(t *testing.T) {
+	store := newTestStore(t, t.TempDir())
+	rec := NewRecorder(store)
+	for _, tenant := range []string{"acme", "globex"} {
+		// 两个租户的用户和会话 ID 相同
+		ctx := util.WithConversationID(context.Background(), "conv-1")
+		ctx = util.WithTenantID(util.WithUserID(ctx, "alice"), tenant)
+		runModel(t, ctx, rec, false)
+	}
+	runModel(t, util.WithTenantID(util.WithConversationID(context.Background(), "conv-1"), "acme"), rec, false)
+
+	today := time.Now().UTC().Format(DayLayout)
+	if got := store.UserDay("acme", "alice", today); got.Calls != 1 {
+		t.Errorf("alice of acme calls = %d", got.Calls)
+	}
+	if got := store.Conversation("acme", "conv-1"); got.Calls != 2 {
+		t.Errorf("conv-1 of acme calls = %d", got.Calls)
+	}
+	report := store.Query(Filter{TenantID: "globex"}, true)
+	if report.Total.Calls != 1 || report.Records[0].TenantID != "globex" {
+		t.Errorf("globex report = %+v", report)
+	}
+}
+
+func TestRecorderSkipsRunsWithoutConversation(t *testing.T) {
+	store := newTestStore(t, t.TempDir())
+	runModel(t, context.Background(), NewRecorder(store), false)
+	if got := store.Query(Filter{}, false).Total.Calls; got != 0 {
+		t.Errorf("expected no records, got %d", got)
+	}
+}
+
+func TestStoreLongConversationID(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+	id := strings.Repeat("x", 1000)
+	if err := store.Add(&Record{ConversationID: id, Caller: "ip:10.0.0.1", Model: "fakeChatModel", TotalTokens: 10}); err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().UTC().Format(DayLayout)
+	if got := store.CallerDay("ip:10.0.0.1", today); got.TotalTokens != 10 {
+		t.Errorf("caller totals = %+v", got)
+	}
+	if got := newTestStore(t, dir).Conversation("", id); got.TotalTokens != 10 {
+		t.Errorf("reloaded totals = %+v", got)
+	}
+}
+
+func TestStoreKeepsTotalsWhenWriteFails(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(&Record{ConversationID: "conv-1", Caller: "alice", TotalTokens: 10}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := store.CallerDay("alice", time.Now().UTC().Format(DayLayout)); got.TotalTokens != 10 {
+		t.Errorf("caller totals = %+v", got)
+	}
+}
+
+func TestStoreEvictsOldRecords(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(&StoreConfig{Dir: dir, Retention: 48 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	old := now.Add(-24 * time.Hour)
+	for i := range 256 {
+		if err := store.Add(&Record{Time: old, ConversationID: fmt.Sprintf("conv-%d", i%2), Caller: "alice", TotalTokens: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := store.CallerDay("alice", old.Format(DayLayout)); got.TotalTokens != 256 {
+		t.Fatalf("caller totals = %+v", got)
+	}
+
+	now = now.Add(72 * time.Hour)
+	for range 256 {
+		if err := store.Add(&Record{Time: now, ConversationID: "conv-0", Caller: "alice", TotalTokens: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := store.CallerDay("alice", old.Format(DayLayout)); got.Calls != 0 {
+		t.Errorf("expired caller totals = %+v", got)
+	}
+	if got := store.Query(Filter{}, false).Total.Calls; got != 256 {
+		t.Errorf("queried calls = %d, want 256", got)
+	}
+	// conversations keep the totals of expired records
+	if got := store.Conversation("", "conv-0"); got.Calls != 128+256 {
+		t.Errorf("conversation calls = %d", got.Calls)
+	}
+}
+
+func TestPriceTable(t *testing.T) {
+	table := &PriceTable{Models: map[string]Price{
+		"GPT-4o": {InputPerMillion: 2.5, OutputPerMillion: 10},
+		"*":      {InputPerMillion: 1, OutputPerMillion: 1},
+	}}
+
+	tests := []struct {
+		model      string
+		prompt     int
+		completion int
+		want       float64
+	}{
+		{"GPT-4o", 1_000_000, 0, 2.5},
+		{"gpt-4o", 0, 1_000_000, 10},
+		{"unknown", 500_000, 500_000, 1},
+	}
+	for _, tt := range tests {
+		if got := table.Cost(tt.model, tt.prompt, tt.completion); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cost(%s) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+
+	delete(table.Models, "*")
+	if got := table.Cost("unknown", 1000, 1000); got != 0 {
+		t.Errorf("unpriced model cost = %v", got)
+	}
+}
@@ -0,0 +1,96 @@
+package util
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type requestIDKey struct{}
+
+type conversationIDKey struct{}
+
+type userIDKey struct{}
+
+type tenantIDKey struct{}
+
+type logFieldsKey struct{}
+
+// NewRequestID 生成新的请求ID
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// WithRequestID 将请求ID写入ctx，WithContext 派生的logger会自动携带 request_id 字段
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext 读取ctx中的请求ID，不存在时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithConversationID 将会话ID写入ctx，WithContext 派生的logger会自动携带 conversation_id 字段
+func WithConversationID(ctx context.Context, conversationID string) context.Context {
+	return context.WithValue(ctx, conversationIDKey{}, conversationID)
+}
+
+// ConversationIDFromContext 读取ctx中的会话ID，不存在时返回空字符串
+func ConversationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(conversationIDKey{}).(string)
+	return id
+}
+
+// WithUserID 将用户ID写入ctx，用于按用户统计和隔离数据
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFromContext 读取ctx中的用户ID，不存在时返回空字符串
+func UserIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(userIDKey{}).(string)
+	return id
+}
+
+// WithTenantID 将租户ID写入ctx，用于隔离会话、缓存和知识库检索
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDKey{}, tenantID)
+}
+
+// TenantIDFromContext 读取ctx中的租户ID，不存在时返回空字符串
+func TenantIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(tenantIDKey{}).(string)
+	return id
+}
+
+// ContextWithFields 将日志字段追加到ctx，WithContext 派生的logger会自动携带这些字段
+func ContextWithFields(ctx context.Context, fields ...Field) context.Context {
+	existing := FieldsFromContext(ctx)
+	merged := make([]Field, 0, len(existing)+len(fields))
+	merged = append(merged, existing...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, logFieldsKey{}, merged)
+}
+
+// FieldsFromContext 读取ctx中的日志字段
+func FieldsFromContext(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(logFieldsKey{}).([]Field)
+	return fields
+}
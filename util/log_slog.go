@@ -0,0 +1,106 @@
+package util
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// SlogHandler 将 log/slog 的记录写入 Logger，使 slog 以及标准库 log 的输出与 Logger 保持同一格式和输出目标
+type SlogHandler struct {
+	logger *Logger
+	prefix string // WithGroup 产生的字段名前缀
+}
+
+// SlogHandler 返回写入当前logger的 slog.Handler
+func (logger *Logger) SlogHandler() *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+// InstallAsSlogDefault 将全局logger安装为 slog 默认处理器，
+// 之后 slog.Info 和标准库 log.Printf 的输出都会经过全局logger
+func InstallAsSlogDefault() {
+	// 让 slog 为标准库 log 的调用捕获调用位置
+	log.SetFlags(log.Lshortfile)
+	slog.SetDefault(slog.New(defaultLogger.SlogHandler()))
+}
+
+// Enabled 实现 slog.Handler
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return fromSlogLevel(level) >= h.logger.Level()
+}
+
+// Handle 实现 slog.Handler，调用位置取自 slog.Record.PC
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	logger := h.logger.WithContext(ctx)
+
+	fields := make([]Field, 0, len(logger.fields)+record.NumAttrs())
+	fields = append(fields, logger.fields...)
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, attr)
+		return true
+	})
+
+	file, line := "unknown", 0
+	if record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		if frame.File != "" {
+			file, line = filepath.Base(frame.File), frame.Line
+		}
+	}
+
+	logger.write(record.Time, fromSlogLevel(record.Level), file, line, strings.TrimSuffix(record.Message, "\n"), fields)
+	return nil
+}
+
+// WithAttrs 实现 slog.Handler
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]Field, 0, len(attrs))
+	for _, attr := range attrs {
+		fields = appendAttr(fields, h.prefix, attr)
+	}
+	return &SlogHandler{logger: h.logger.With(fields...), prefix: h.prefix}
+}
+
+// WithGroup 实现 slog.Handler，分组以 "group.key" 的形式展开
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{logger: h.logger, prefix: h.prefix + name + "."}
+}
+
+func appendAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix = prefix + attr.Key + "."
+		}
+		for _, child := range attr.Value.Group() {
+			fields = appendAttr(fields, groupPrefix, child)
+		}
+		return fields
+	}
+	return append(fields, F(prefix+attr.Key, attr.Value.Any()))
+}
+
+// fromSlogLevel 将 slog 等级映射到 LogLevel
+func fromSlogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return DEBUG
+	case level < slog.LevelWarn:
+		return INFO
+	case level < slog.LevelError:
+		return WARN
+	default:
+		return ERROR
+	}
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSlogHandler 测试 slog 记录经由 Logger 输出
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(INFO)
+	logger.SetFormat(JSONFormat)
+	logger.SetOutput(&buf)
+
+	sl := slog.New(logger.SlogHandler()).With("component", "test").WithGroup("req")
+	ctx := WithRequestID(context.Background(), "req-9")
+	sl.DebugContext(ctx, "filtered")
+	sl.InfoContext(ctx, "handled", "status", 200, slog.Group("user", "id", "u1"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %d: %s", len(lines), buf.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := map[string]interface{}{
+		"level":       "INFO",
+		"msg":         "handled",
+		"component":   "test",
+		"req.status":  float64(200),
+		"req.user.id": "u1",
+		"request_id":  "req-9",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s = %v, want %v", k, entry[k], v)
+		}
+	}
+	if !strings.HasPrefix(entry["caller"].(string), "log_slog_test.go:") {
+		t.Errorf("unexpected caller: %v", entry["caller"])
+	}
+}
+
+// TestInstallAsSlogDefault 测试安装为默认处理器后标准库 log 的输出也经过 Logger
+func TestInstallAsSlogDefault(t *testing.T) {
+	var buf bytes.Buffer
+	prevSlog := slog.Default()
+	prevOut := defaultLogger.core.out
+	defer func() {
+		slog.SetDefault(prevSlog)
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+		SetOutput(prevOut)
+		SetFormat(TextFormat)
+	}()
+
+	SetOutput(&buf)
+	SetFormat(JSONFormat)
+	InstallAsSlogDefault()
+
+	log.Printf("[Chat] Starting chat with ID: %s", "c1")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid JSON: %v, output: %s", err, buf.String())
+	}
+	if entry["msg"] != "[Chat] Starting chat with ID: c1" {
+		t.Errorf("unexpected msg: %v", entry["msg"])
+	}
+	if !strings.HasPrefix(entry["caller"].(string), "log_slog_test.go:") {
+		t.Errorf("unexpected caller: %v", entry["caller"])
+	}
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRotatingFileWriter 测试按大小滚动及备份数量限制
+func TestRotatingFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "app.log")
+	w, err := NewRotatingFileWriter(path, 10, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingFileWriter: %v", err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	cases := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for file, want := range cases {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", file, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, stat .3 err: %v", err)
+	}
+}
+
+// TestLoggerToRotatingFile 测试logger写入文件
+func TestLoggerToRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingFileWriter(path, 0, 0)
+	if err != nil {
+		t.Fatalf("NewRotatingFileWriter: %v", err)
+	}
+	logger := NewLogger(INFO)
+	logger.SetFormat(JSONFormat)
+	logger.SetOutput(w)
+	logger.Info("to file")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(data), `"msg":"to file"`) {
+		t.Errorf("unexpected file content: %s", data)
+	}
+}
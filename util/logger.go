@@ -1,9 +1,17 @@
 package util
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -54,28 +62,128 @@ func (l LogLevel) Color() string {
 	}
 }
 
-// Logger 日志记录器结构体
+// Format 日志输出格式
+type Format int
+
+const (
+	// TextFormat 文本格式，字段以 key=value 追加在消息后
+	TextFormat Format = iota
+	// JSONFormat JSON格式，每条日志一行JSON对象
+	JSONFormat
+)
+
+// Field 结构化日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F 创建结构化日志字段
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger 日志记录器结构体，可安全地被多个goroutine并发使用
 type Logger struct {
-	level        LogLevel
-	colorEnabled bool
+	core   *loggerCore
+	fields []Field
+}
+
+// loggerCore 父子logger共享的配置，等级等开关使用原子变量，输出由互斥锁串行化
+type loggerCore struct {
+	level        atomic.Int32
+	colorEnabled atomic.Bool
+	format       atomic.Int32
+	exitOnFatal  atomic.Bool
+
+	mu  sync.Mutex // 保护 out 并保证单条日志完整写出
+	out io.Writer
 }
 
+// exitFunc FATAL 日志在退出模式下调用的退出函数，测试中可替换
+var exitFunc = os.Exit
+
 // NewLogger 创建新的日志记录器
 func NewLogger(level LogLevel) *Logger {
-	return &Logger{
-		level:        level,
-		colorEnabled: true,
-	}
+	core := &loggerCore{out: os.Stdout}
+	core.level.Store(int32(level))
+	core.colorEnabled.Store(true)
+	core.format.Store(int32(TextFormat))
+	return &Logger{core: core}
 }
 
 // SetLevel 设置日志等级
 func (logger *Logger) SetLevel(level LogLevel) {
-	logger.level = level
+	logger.core.level.Store(int32(level))
+}
+
+// Level 返回当前日志等级
+func (logger *Logger) Level() LogLevel {
+	return LogLevel(logger.core.level.Load())
+}
+
+// Enabled 判断指定等级的日志是否会输出，用于避免构建代价较高的日志内容
+func (logger *Logger) Enabled(level LogLevel) bool {
+	return level >= logger.Level()
 }
 
 // SetColorEnabled 设置是否启用颜色输出
 func (logger *Logger) SetColorEnabled(enabled bool) {
-	logger.colorEnabled = enabled
+	logger.core.colorEnabled.Store(enabled)
+}
+
+// SetFormat 设置输出格式（文本或JSON）
+func (logger *Logger) SetFormat(format Format) {
+	logger.core.format.Store(int32(format))
+}
+
+// SetExitOnFatal 设置 FATAL 日志写出后是否以状态码1退出进程
+func (logger *Logger) SetExitOnFatal(enabled bool) {
+	logger.core.exitOnFatal.Store(enabled)
+}
+
+// SetOutput 设置输出目标，传入多个writer时同时写入所有目标
+func (logger *Logger) SetOutput(writers ...io.Writer) {
+	var out io.Writer
+	switch len(writers) {
+	case 0:
+		out = os.Stdout
+	case 1:
+		out = writers[0]
+	default:
+		out = io.MultiWriter(writers...)
+	}
+
+	logger.core.mu.Lock()
+	logger.core.out = out
+	logger.core.mu.Unlock()
+}
+
+// With 返回携带额外字段的子logger，子logger与父logger共享等级、格式和输出配置
+func (logger *Logger) With(fields ...Field) *Logger {
+	child := &Logger{
+		core:   logger.core,
+		fields: make([]Field, 0, len(logger.fields)+len(fields)),
+	}
+	child.fields = append(child.fields, logger.fields...)
+	child.fields = append(child.fields, fields...)
+	return child
+}
+
+// WithContext 返回携带ctx中请求ID、会话ID及上下文字段的子logger
+func (logger *Logger) WithContext(ctx context.Context) *Logger {
+	var fields []Field
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields = append(fields, F("request_id", id))
+	}
+	if id := ConversationIDFromContext(ctx); id != "" {
+		fields = append(fields, F("conversation_id", id))
+	}
+	fields = append(fields, FieldsFromContext(ctx)...)
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.With(fields...)
 }
 
 // getCallerInfo 获取调用者信息（文件名和行号）
@@ -96,95 +204,130 @@ func (logger *Logger) getCallerInfo(skip int) (string, int) {
 
 // logf 格式化日志记录方法
 func (logger *Logger) logf(level LogLevel, format string, args ...interface{}) {
-	if level < logger.level {
+	if level < logger.Level() {
 		return
 	}
+	logger.output(level, fmt.Sprintf(format, args...))
+}
 
-	// 获取调用者信息，skip=3 跳过当前方法、具体日志方法(Debugf/Infof等)和用户调用
-	file, line := logger.getCallerInfo(3)
+// log 简单日志记录方法
+func (logger *Logger) log(level LogLevel, message string) {
+	if level < logger.Level() {
+		return
+	}
+	logger.output(level, message)
+}
 
-	// 格式化时间
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
+// logAny 接受任意类型参数的日志记录方法
+func (logger *Logger) logAny(level LogLevel, args ...interface{}) {
+	if level < logger.Level() {
+		return
+	}
+	logger.output(level, fmt.Sprint(args...))
+}
 
-	// 构建日志消息
-	message := fmt.Sprintf(format, args...)
+// output 构建并写出一条日志
+func (logger *Logger) output(level LogLevel, message string) {
+	// 获取调用者信息，skip=4 跳过当前方法、logf/log/logAny、具体日志方法(Debugf/Info等)和用户调用
+	file, line := logger.getCallerInfo(4)
 
-	// 构建完整的日志行
-	var logLine string
-	if logger.colorEnabled {
-		// 带颜色的输出
-		colorCode := level.Color()
-		resetCode := "\033[0m"
-		logLine = fmt.Sprintf("%s[%s] %s%s %s:%d - %s",
-			colorCode, level.String(), timestamp, resetCode, file, line, message)
+	logger.write(time.Now(), level, file, line, message, logger.fields)
+}
+
+// write 格式化并串行写出一条日志，FATAL 日志在退出模式下写出后退出进程
+func (logger *Logger) write(now time.Time, level LogLevel, file string, line int, message string, fields []Field) {
+	var buf bytes.Buffer
+	if Format(logger.core.format.Load()) == JSONFormat {
+		writeJSON(&buf, now, level, file, line, message, fields)
 	} else {
-		// 无颜色输出
-		logLine = fmt.Sprintf("[%s] %s %s:%d - %s",
-			level.String(), timestamp, file, line, message)
+		writeText(&buf, logger.core.colorEnabled.Load(), now, level, file, line, message, fields)
 	}
+	buf.WriteByte('\n')
 
-	fmt.Println(logLine)
-}
+	logger.core.mu.Lock()
+	_, _ = logger.core.out.Write(buf.Bytes())
+	logger.core.mu.Unlock()
 
-// log 简单日志记录方法
-func (logger *Logger) log(level LogLevel, message string) {
-	if level < logger.level {
-		return
+	if level == FATAL && logger.core.exitOnFatal.Load() {
+		exitFunc(1)
 	}
+}
 
-	// 获取调用者信息，skip=3 跳过当前方法、具体日志方法(Debug/Info等)和用户调用
-	file, line := logger.getCallerInfo(3)
-
+// writeText 构建文本格式日志行
+func writeText(buf *bytes.Buffer, colorEnabled bool, now time.Time, level LogLevel, file string, line int, message string, fields []Field) {
 	// 格式化时间
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
+	timestamp := now.Format("2006-01-02 15:04:05.000")
 
-	// 构建完整的日志行
-	var logLine string
-	if logger.colorEnabled {
+	if colorEnabled {
 		// 带颜色的输出
 		colorCode := level.Color()
 		resetCode := "\033[0m"
-		logLine = fmt.Sprintf("%s[%s] %s%s %s:%d - %s",
+		fmt.Fprintf(buf, "%s[%s] %s%s %s:%d - %s",
 			colorCode, level.String(), timestamp, resetCode, file, line, message)
 	} else {
 		// 无颜色输出
-		logLine = fmt.Sprintf("[%s] %s %s:%d - %s",
+		fmt.Fprintf(buf, "[%s] %s %s:%d - %s",
 			level.String(), timestamp, file, line, message)
 	}
 
-	fmt.Println(logLine)
+	for _, field := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(field.Key)
+		buf.WriteByte('=')
+		buf.WriteString(formatFieldValue(field.Value))
+	}
 }
 
-// logAny 接受任意类型参数的日志记录方法
-func (logger *Logger) logAny(level LogLevel, args ...interface{}) {
-	if level < logger.level {
-		return
+// writeJSON 构建JSON格式日志行，固定字段在前，结构化字段按添加顺序在后
+func writeJSON(buf *bytes.Buffer, now time.Time, level LogLevel, file string, line int, message string, fields []Field) {
+	buf.WriteByte('{')
+	writeJSONField(buf, "time", now.Format(time.RFC3339Nano), true)
+	writeJSONField(buf, "level", level.String(), false)
+	writeJSONField(buf, "caller", fmt.Sprintf("%s:%d", file, line), false)
+	writeJSONField(buf, "msg", message, false)
+	for _, field := range fields {
+		writeJSONField(buf, field.Key, field.Value, false)
 	}
+	buf.WriteByte('}')
+}
 
-	// 获取调用者信息，skip=3 跳过当前方法、具体日志方法和用户调用
-	file, line := logger.getCallerInfo(3)
-
-	// 格式化时间
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-
-	// 将所有参数格式化为字符串
-	message := fmt.Sprint(args...)
-
-	// 构建完整的日志行
-	var logLine string
-	if logger.colorEnabled {
-		// 带颜色的输出
-		colorCode := level.Color()
-		resetCode := "\033[0m"
-		logLine = fmt.Sprintf("%s[%s] %s%s %s:%d - %s",
-			colorCode, level.String(), timestamp, resetCode, file, line, message)
-	} else {
-		// 无颜色输出
-		logLine = fmt.Sprintf("[%s] %s %s:%d - %s",
-			level.String(), timestamp, file, line, message)
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}, first bool) {
+	if !first {
+		buf.WriteByte(',')
 	}
+	keyJSON, _ := json.Marshal(key)
+	buf.Write(keyJSON)
+	buf.WriteByte(':')
 
-	fmt.Println(logLine)
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		valueJSON, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(valueJSON)
+}
+
+// formatFieldValue 文本格式下的字段值，包含空白或引号时加引号
+func formatFieldValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.RawMessage:
+		s = string(v)
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
 }
 
 // Debug 记录调试日志
@@ -227,12 +370,12 @@ func (logger *Logger) Errorf(format string, args ...interface{}) {
 	logger.logf(ERROR, format, args...)
 }
 
-// Fatal 记录致命错误日志
+// Fatal 记录致命错误日志，开启 SetExitOnFatal 后写出日志并退出进程
 func (logger *Logger) Fatal(message string) {
 	logger.log(FATAL, message)
 }
 
-// Fatalf 记录格式化致命错误日志
+// Fatalf 记录格式化致命错误日志，开启 SetExitOnFatal 后写出日志并退出进程
 func (logger *Logger) Fatalf(format string, args ...interface{}) {
 	logger.logf(FATAL, format, args...)
 }
@@ -275,6 +418,36 @@ func SetColorEnabled(enabled bool) {
 	defaultLogger.SetColorEnabled(enabled)
 }
 
+// SetExitOnFatal 设置全局logger在 FATAL 日志后是否退出进程
+func SetExitOnFatal(enabled bool) {
+	defaultLogger.SetExitOnFatal(enabled)
+}
+
+// SetFormat 设置全局输出格式
+func SetFormat(format Format) {
+	defaultLogger.SetFormat(format)
+}
+
+// SetOutput 设置全局输出目标
+func SetOutput(writers ...io.Writer) {
+	defaultLogger.SetOutput(writers...)
+}
+
+// Default 返回全局默认logger，可通过 With 派生带字段的子logger
+func Default() *Logger {
+	return defaultLogger
+}
+
+// With 基于全局logger派生带字段的子logger
+func With(fields ...Field) *Logger {
+	return defaultLogger.With(fields...)
+}
+
+// WithContext 基于全局logger派生携带ctx字段的子logger
+func WithContext(ctx context.Context) *Logger {
+	return defaultLogger.WithContext(ctx)
+}
+
 // Debugf 全局格式化调试日志
 func Debugf(format string, args ...interface{}) {
 	defaultLogger.logf(DEBUG, format, args...)
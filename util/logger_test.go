@@ -1,6 +1,11 @@
 package util
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -89,4 +94,177 @@ func testFunction2() {
 	Error("这是在testFunction2中的错误日志")
 	Debug("testFunction2中的调试信息")
 	Errorf("testFunction2中的格式化错误: %d", 404)
-}
\ No newline at end of file
+}
+
+// TestLoggerJSONWithFields 测试JSON输出及结构化字段
+func TestLoggerJSONWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(DEBUG)
+	logger.SetFormat(JSONFormat)
+	logger.SetOutput(&buf)
+
+	logger.With(F("node", "Retriever"), F("count", 3)).Info("retrieved")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output is not valid JSON: %v, output: %s", err, buf.String())
+	}
+	if entry["level"] != "INFO" || entry["msg"] != "retrieved" {
+		t.Errorf("unexpected level/msg: %v", entry)
+	}
+	if entry["node"] != "Retriever" || entry["count"] != float64(3) {
+		t.Errorf("missing structured fields: %v", entry)
+	}
+	if !strings.HasPrefix(entry["caller"].(string), "logger_test.go:") {
+		t.Errorf("unexpected caller: %v", entry["caller"])
+	}
+}
+
+// TestLoggerTextWithFields 测试文本输出中的字段格式
+func TestLoggerTextWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(DEBUG)
+	logger.SetColorEnabled(false)
+	logger.SetOutput(&buf)
+
+	logger.With(F("query", "what is eino"), F("top_k", 8)).Infof("retrieve %s", "start")
+
+	line := buf.String()
+	if !strings.Contains(line, `- retrieve start query="what is eino" top_k=8`) {
+		t.Errorf("unexpected text line: %s", line)
+	}
+}
+
+// TestLoggerWithSharesConfig 测试子logger共享父logger配置且不影响父logger字段
+func TestLoggerWithSharesConfig(t *testing.T) {
+	var buf bytes.Buffer
+	parent := NewLogger(INFO)
+	child := parent.With(F("component", "child"))
+
+	parent.SetFormat(JSONFormat)
+	parent.SetOutput(&buf)
+	parent.SetLevel(WARN)
+
+	child.Info("filtered")
+	if buf.Len() != 0 {
+		t.Fatalf("child should inherit level WARN, got: %s", buf.String())
+	}
+
+	child.Warn("kept")
+	parent.Warn("parent")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %s", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[0], `"component":"child"`) {
+		t.Errorf("child line missing field: %s", lines[0])
+	}
+	if strings.Contains(lines[1], `"component"`) {
+		t.Errorf("parent line should not carry child fields: %s", lines[1])
+	}
+}
+
+// TestLoggerWithContext 测试从ctx中读取请求ID和字段
+func TestLoggerWithContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(DEBUG)
+	logger.SetFormat(JSONFormat)
+	logger.SetOutput(&buf)
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	ctx = WithConversationID(ctx, "conv-1")
+	ctx = ContextWithFields(ctx, F("node", "Retriever"))
+	logger.WithContext(ctx).Info("hello")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if entry["request_id"] != "req-1" || entry["conversation_id"] != "conv-1" || entry["node"] != "Retriever" {
+		t.Errorf("missing context fields: %v", entry)
+	}
+}
+
+// TestLoggerMultipleOutputs 测试同时写入多个输出目标
+func TestLoggerMultipleOutputs(t *testing.T) {
+	var a, b bytes.Buffer
+	logger := NewLogger(DEBUG)
+	logger.SetColorEnabled(false)
+	logger.SetOutput(&a, &b)
+
+	logger.Error("boom")
+	if a.String() == "" || a.String() != b.String() {
+		t.Errorf("expected identical output in both sinks, got %q and %q", a.String(), b.String())
+	}
+}
+
+// TestLoggerConcurrent 并发写日志同时修改配置，配合 -race 运行；每行必须是完整的JSON
+func TestLoggerConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(DEBUG)
+	logger.SetFormat(JSONFormat)
+	logger.SetOutput(&buf)
+
+	const workers, perWorker = 8, 200
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := logger.With(F("worker", i))
+			for j := 0; j < perWorker; j++ {
+				child.Infof("message %d", j)
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < perWorker; j++ {
+			logger.SetLevel(INFO)
+			logger.SetColorEnabled(j%2 == 0)
+			_ = logger.Level()
+		}
+	}()
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != workers*perWorker {
+		t.Fatalf("expected %d lines, got %d", workers*perWorker, len(lines))
+	}
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Fatalf("interleaved or broken line: %s", line)
+		}
+	}
+}
+
+// TestLoggerExitOnFatal 测试退出模式下 FATAL 日志写出后调用退出函数
+func TestLoggerExitOnFatal(t *testing.T) {
+	var code = -1
+	prev := exitFunc
+	exitFunc = func(c int) { code = c }
+	defer func() { exitFunc = prev }()
+
+	var buf bytes.Buffer
+	logger := NewLogger(DEBUG)
+	logger.SetOutput(&buf)
+
+	logger.Fatal("not exiting")
+	if code != -1 {
+		t.Fatalf("exit should not be called by default, got code %d", code)
+	}
+
+	logger.SetExitOnFatal(true)
+	logger.Error("still running")
+	if code != -1 {
+		t.Fatalf("exit should only be called for FATAL, got code %d", code)
+	}
+	logger.Fatalf("shutting down: %s", "boom")
+	if code != 1 {
+		t.Fatalf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(buf.String(), "shutting down: boom") {
+		t.Errorf("fatal message must be written before exit: %s", buf.String())
+	}
+}
@@ -0,0 +1,138 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// RedactRule 一条脱敏规则，Replacement 支持 ${1} 等分组引用
+type RedactRule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// defaultRedactRules 内置脱敏规则，按顺序执行
+var defaultRedactRules = []RedactRule{
+	{
+		// api_key=xxx、"password": "xxx"、Authorization: Basic xxx 等键值对，保留键名和认证方式，
+		// 也覆盖 http.Header 的输出，例如 map[Authorization:[Bearer xxx]]
+		Name:        "secret_kv",
+		Pattern:     regexp.MustCompile(`(?i)((?:api[_-]?key|access[_-]?token|secret|password|passwd|authorization)"?\s*[:=]\s*\[?"?(?:(?:basic|bearer|token|digest)\s+)?)([^\s"',;&\]]+)`),
+		Replacement: "${1}[REDACTED]",
+	},
+	{
+		Name:        "bearer",
+		Pattern:     regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+		Replacement: "${1}[REDACTED]",
+	},
+	{
+		Name:        "jwt",
+		Pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		Replacement: "[REDACTED:jwt]",
+	},
+	{
+		Name:        "api_key",
+		Pattern:     regexp.MustCompile(`\b(?:sk|pk|ak)-[A-Za-z0-9_\-]{16,}|\bAKIA[0-9A-Z]{16}\b`),
+		Replacement: "[REDACTED:api_key]",
+	},
+	{
+		Name:        "email",
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+		Replacement: "[REDACTED:email]",
+	},
+	{
+		// 中国大陆手机号及 +1 (555) 123-4567 一类的国际格式
+		Name:        "phone",
+		Pattern:     regexp.MustCompile(`(?:\+\d{1,3}[\s-]?)?(?:\b1[3-9]\d{9}\b|\(?\b\d{3}\)?[\s.-]\d{3}[\s.-]\d{4}\b)`),
+		Replacement: "[REDACTED:phone]",
+	},
+}
+
+// Redactor 对日志内容进行脱敏，可并发使用
+type Redactor struct {
+	mu    sync.RWMutex
+	rules []RedactRule
+}
+
+// NewRedactor 创建包含内置规则的脱敏器，patterns 为额外的自定义正则
+func NewRedactor(patterns ...string) (*Redactor, error) {
+	r := &Redactor{rules: append([]RedactRule(nil), defaultRedactRules...)}
+	for i, p := range patterns {
+		if err := r.AddPattern(fmt.Sprintf("custom_%d", i), p); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// AddPattern 追加自定义脱敏正则，匹配内容替换为 [REDACTED:name]
+func (r *Redactor) AddPattern(name, expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid redact pattern %q: %w", expr, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, RedactRule{Name: name, Pattern: re, Replacement: "[REDACTED:" + name + "]"})
+	return nil
+}
+
+// Redact 返回脱敏后的字符串
+func (r *Redactor) Redact(s string) string {
+	if s == "" {
+		return s
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rule := range r.rules {
+		s = rule.Pattern.ReplaceAllString(s, rule.Replacement)
+	}
+	return s
+}
+
+// RedactAny 将任意值序列化为JSON后脱敏，返回可直接作为日志字段的值
+func (r *Redactor) RedactAny(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return r.Redact(fmt.Sprint(v))
+	}
+	redacted := r.Redact(string(data))
+	if !json.Valid([]byte(redacted)) {
+		return redacted
+	}
+	return json.RawMessage(redacted)
+}
+
+// MaskSecret 用于打印配置中的密钥，只保留前3个字符
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return "<empty>"
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return secret[:3] + "****"
+}
+
+// 全局默认脱敏器
+var defaultRedactor, _ = NewRedactor()
+
+// Redact 使用全局脱敏器脱敏字符串
+func Redact(s string) string {
+	return defaultRedactor.Redact(s)
+}
+
+// RedactAny 使用全局脱敏器脱敏任意值
+func RedactAny(v interface{}) interface{} {
+	return defaultRedactor.RedactAny(v)
+}
+
+// AddRedactPattern 向全局脱敏器追加自定义正则
+func AddRedactPattern(name, expr string) error {
+	return defaultRedactor.AddPattern(name, expr)
+}